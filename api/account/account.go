@@ -0,0 +1,302 @@
+// Package account จัดการการรีเซ็ตรหัสผ่านและการยืนยันอีเมลผ่านลิงก์ที่ส่งทางอีเมล
+package account
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang-backend/api/audit"
+	"golang-backend/api/login"
+	"golang-backend/api/password"
+	"golang-backend/api/response"
+	"golang-backend/config"
+	"golang-backend/mail"
+	"golang-backend/middleware"
+	"golang-backend/models"
+	"golang-backend/repository"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// token ที่ส่งทางอีเมลเป็นค่าสุ่มแบบ opaque ใช้ได้ครั้งเดียวและมีอายุจำกัด ฐานข้อมูลเก็บเฉพาะ SHA-256 ของมัน
+// การขอ token ใหม่ไม่ทำให้ token เก่าใช้ไม่ได้ แต่การใช้ token ใดก็ตามจะยกเลิก token อื่นของจุดประสงค์เดียวกันทั้งหมด
+
+// Handler รวม handler ของ /auth/forgot-password, /auth/reset-password และ /auth/verify-email
+type Handler struct {
+	cfg       config.AccountConfig
+	passwords *password.Service
+	users     repository.UserRepository
+	tokens    repository.UserTokenRepository
+	sessions  repository.RefreshTokenRepository
+	apiKeys   repository.APIKeyRepository
+	throttle  *login.Throttle
+	mailer    mail.Mailer
+	audit     *audit.Log
+}
+
+func NewHandler(cfg config.AccountConfig, passwords *password.Service, users repository.UserRepository, tokens repository.UserTokenRepository, sessions repository.RefreshTokenRepository, apiKeys repository.APIKeyRepository, throttle *login.Throttle, mailer mail.Mailer, auditLog *audit.Log) *Handler {
+	return &Handler{cfg: cfg, passwords: passwords, users: users, tokens: tokens, sessions: sessions, apiKeys: apiKeys, throttle: throttle, mailer: mailer, audit: auditLog}
+}
+
+var errInvalidToken = response.New(http.StatusBadRequest, response.CodeInvalidToken, "Invalid or expired token")
+
+// forgotPasswordMessage ตอบเหมือนกันทุกกรณี เพื่อไม่ให้เดาได้ว่าอีเมลใดมีบัญชีอยู่
+const forgotPasswordMessage = "If the email belongs to an account, a password reset link has been sent"
+
+// resetMailTimeout คือเวลาที่ให้สร้าง token และส่งอีเมลรีเซ็ตรหัสผ่านหลังตอบ request ไปแล้ว
+const resetMailTimeout = time.Minute
+
+func newToken() (raw, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	raw = base64.RawURLEncoding.EncodeToString(b)
+	return raw, hashToken(raw), nil
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// link สร้างลิงก์ไปยังหน้า frontend ที่จะส่ง token กลับมาที่ API
+func (h *Handler) link(path, token string) string {
+	return strings.TrimRight(h.cfg.LinkBaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// issue สร้าง token ใหม่ของผู้ใช้แล้วส่งลิงก์ไปยังอีเมลของผู้ใช้
+func (h *Handler) issue(ctx context.Context, user models.User, purpose string, ttl time.Duration, subject, path, text string) error {
+	raw, hash, err := newToken()
+	if err != nil {
+		return err
+	}
+	if err := h.tokens.Create(ctx, user.ID, purpose, hash, ttl); err != nil {
+		return err
+	}
+	return h.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: subject,
+		Body:    fmt.Sprintf("Hello %s,\n\n%s\n\n%s\n\nThis link expires in %s.\n", user.Username, text, h.link(path, raw), ttl),
+	})
+}
+
+// SendVerification ส่งลิงก์ยืนยันอีเมลไปยังอีเมลปัจจุบันของผู้ใช้
+func (h *Handler) SendVerification(ctx context.Context, user models.User) error {
+	return h.issue(ctx, user, repository.TokenEmailVerification, time.Duration(h.cfg.VerifyTTL),
+		"Verify your email address", "/verify-email",
+		"Open the link below to verify your email address.")
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset link
+// @Description Email a single-use password reset link. The response is the same whether or not the email belongs to an account, and the email is sent after responding. Requests are rate limited per email and per client IP (429 with Retry-After).
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Success 202 {object} map[string]string
+// @Router /auth/forgot-password [post]
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Email == "" {
+		response.WriteError(w, r, response.BadRequest("email is required"))
+		return
+	}
+
+	// ทุกคำขอถูกนับทั้งต่ออีเมลและต่อ IP ไม่ว่าอีเมลจะมีบัญชีหรือไม่ เพื่อไม่ให้ใช้ endpoint นี้ส่งอีเมลรัวใส่ผู้อื่น
+	ctx := r.Context()
+	emailKey, ipKey := "reset:"+strings.ToLower(body.Email), "reset-ip:"+response.ClientIP(r)
+	wait, _, err := h.throttle.Check(ctx, emailKey, ipKey)
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		response.WriteError(w, r, response.New(http.StatusTooManyRequests, response.CodeTooManyAttempts, "Too many password reset requests, try again later"))
+		return
+	}
+	if err := h.throttle.Fail(ctx, emailKey, ipKey); err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	// GetByIdentifier ค้นด้วย username ได้ด้วย จึงต้องเทียบอีเมลซ้ำ
+	user, err := h.users.GetByIdentifier(ctx, body.Email)
+	switch {
+	case err == nil && strings.EqualFold(user.Email, body.Email):
+		// สร้าง token และส่งอีเมลหลังตอบกลับ เวลาตอบจึงไม่บอกว่าอีเมลมีบัญชีหรือไม่
+		go h.sendPasswordReset(context.WithoutCancel(ctx), user)
+	case err != nil && !errors.Is(err, repository.ErrNotFound):
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": forgotPasswordMessage})
+}
+
+// sendPasswordReset ส่งลิงก์รีเซ็ตรหัสผ่านนอก request ผู้ใช้ขอใหม่ได้ถ้าส่งไม่สำเร็จ จึงบันทึกเพียง log
+func (h *Handler) sendPasswordReset(ctx context.Context, user models.User) {
+	ctx, cancel := context.WithTimeout(ctx, resetMailTimeout)
+	defer cancel()
+	err := h.issue(ctx, user, repository.TokenPasswordReset, time.Duration(h.cfg.ResetTTL),
+		"Reset your password", "/reset-password",
+		"Someone asked to reset the password of your account. If it was you, open the link below to choose a new password. Otherwise you can ignore this email.")
+	if err != nil {
+		log.Printf("request_id=%s send password reset to user %d: %v", response.RequestID(ctx), user.ID, err)
+	}
+}
+
+// ResetPassword godoc
+// @Summary Reset a password
+// @Description Set a new password with a token from the reset email. Every session of the user is signed out and every API key is revoked.
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} map[string]string
+// @Router /auth/reset-password [post]
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var body struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Token == "" || body.Password == "" {
+		response.WriteError(w, r, response.BadRequest("token and password are required"))
+		return
+	}
+	err := h.audit.Tx(r.Context(), func(ctx context.Context) error {
+		id, err := h.tokens.Consume(ctx, repository.TokenPasswordReset, hashToken(body.Token))
+		if errors.Is(err, repository.ErrNotFound) {
+			return errInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+		// ถ้ารหัสผ่านไม่ผ่านนโยบาย transaction ถูกยกเลิก token จึงยังใช้ได้อีก
+		user, err := h.users.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := h.passwords.Validate(body.Password, user.Username, user.Email); err != nil {
+			return err
+		}
+		// hash หลังใช้ token และตรวจนโยบายแล้ว เพื่อไม่ให้ request ที่ไม่มี token ที่ถูกต้องทำให้ต้อง hash
+		hash, err := h.passwords.Hash(body.Password)
+		if err != nil {
+			return err
+		}
+		if err := h.users.Update(ctx, id, repository.UserUpdate{PasswordHash: &hash}); err != nil {
+			return err
+		}
+		// ถ้ารหัสผ่านเดิมรั่ว session และ API key ที่ผู้อื่นถืออยู่ต้องใช้ไม่ได้อีก
+		if err := h.sessions.RevokeUser(ctx, id); err != nil {
+			return err
+		}
+		if err := h.apiKeys.RevokeUser(ctx, id); err != nil {
+			return err
+		}
+		return h.audit.Record(ctx, r, audit.ActionUserPasswordReset, audit.EntityUser, id, map[string]models.FieldChange{
+			"password": {From: audit.Redacted, To: audit.Redacted},
+		})
+	})
+	if err != nil {
+		response.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password has been reset"})
+}
+
+// VerifyEmail godoc
+// @Summary Verify an email address
+// @Description Mark the user's email as verified with a token from the verification email.
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} map[string]string
+// @Router /auth/verify-email [post]
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Token == "" {
+		response.WriteError(w, r, response.BadRequest("token is required"))
+		return
+	}
+
+	err := h.audit.Tx(r.Context(), func(ctx context.Context) error {
+		id, err := h.tokens.Consume(ctx, repository.TokenEmailVerification, hashToken(body.Token))
+		if errors.Is(err, repository.ErrNotFound) {
+			return errInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+		if err := h.users.VerifyEmail(ctx, id); err != nil {
+			return err
+		}
+		return h.audit.Record(ctx, r, audit.ActionUserEmailVerify, audit.EntityUser, id, audit.Diff(
+			map[string]bool{"email_verified": false},
+			map[string]bool{"email_verified": true},
+		))
+	})
+	if err != nil {
+		response.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified"})
+}
+
+// ResendVerification godoc
+// @Summary Resend the verification email
+// @Tags me
+// @Produce  json
+// @Success 202 {object} map[string]string
+// @Router /me/verify-email [post]
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	principal, ok := middleware.CurrentPrincipal(r)
+	if !ok {
+		response.WriteError(w, r, response.Unauthorized())
+		return
+	}
+	user, err := h.users.GetByID(r.Context(), principal.UserID)
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	if user.EmailVerified {
+		response.WriteError(w, r, response.New(http.StatusConflict, response.CodeEmailAlreadyVerified, "Email is already verified"))
+		return
+	}
+	if err := h.SendVerification(r.Context(), user); err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"})
+}
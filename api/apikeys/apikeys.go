@@ -0,0 +1,238 @@
+// Package apikeys จัดการ API key ที่ผู้ใช้สร้างให้ script และ CI เรียก /api แทนการ login ด้วยรหัสผ่าน
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"golang-backend/api/audit"
+	"golang-backend/api/response"
+	"golang-backend/middleware"
+	"golang-backend/models"
+	"golang-backend/repository"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// key เป็นค่าสุ่มแบบ opaque ที่แสดงเพียงครั้งเดียวตอนสร้าง ฐานข้อมูลเก็บเฉพาะ SHA-256 และส่วนต้นของ key
+// key ได้สิทธิ์เฉพาะ scope ที่ระบุ และไม่เกินสิทธิ์ของ role ปัจจุบันของเจ้าของ
+
+const (
+	defaultExpiryDays = 90
+	maxExpiryDays     = 365
+	maxNameLength     = 100
+	// prefixLength คือความยาวของส่วนต้น key ที่เก็บไว้ให้ผู้ใช้แยกแยะ key (รวม APIKeyPrefix)
+	prefixLength = 12
+)
+
+// Handler รวม handler ของ /api/me/api-keys และ /api/users/{id}/api-keys
+type Handler struct {
+	users repository.UserRepository
+	keys  repository.APIKeyRepository
+	audit *audit.Log
+}
+
+func NewHandler(users repository.UserRepository, keys repository.APIKeyRepository, auditLog *audit.Log) *Handler {
+	return &Handler{users: users, keys: keys, audit: auditLog}
+}
+
+var (
+	errUserNotFound   = response.New(http.StatusNotFound, response.CodeUserNotFound, "User not found")
+	errAPIKeyNotFound = response.New(http.StatusNotFound, response.CodeAPIKeyNotFound, "API key not found")
+)
+
+func newKey() (raw string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return middleware.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// owner คืนเจ้าของ key ตาม URL คือผู้ใช้ {id} หรือผู้เรียกเองสำหรับ /api/me/api-keys
+func (h *Handler) owner(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	principal, ok := middleware.CurrentPrincipal(r)
+	if !ok {
+		response.WriteError(w, r, response.Unauthorized())
+		return models.User{}, false
+	}
+	id := principal.UserID
+	if param, ok := mux.Vars(r)["id"]; ok {
+		var err error
+		if id, err = strconv.Atoi(param); err != nil {
+			response.WriteError(w, r, response.BadRequest("Invalid user ID"))
+			return models.User{}, false
+		}
+	}
+
+	user, err := h.users.GetByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, errUserNotFound)
+		return models.User{}, false
+	}
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return models.User{}, false
+	}
+	return user, true
+}
+
+// GetAPIKeys godoc
+// @Summary List API keys
+// @Description List the API keys of the caller (/me/api-keys) or of a user (/users/{id}/api-keys, requires api_keys:manage). Expired keys are included; revoked keys are not. The keys themselves are never returned.
+// @Tags api-keys
+// @Produce  json
+// @Success 200 {array} models.APIKey
+// @Router /me/api-keys [get]
+// @Router /users/{id}/api-keys [get]
+func (h *Handler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	user, ok := h.owner(w, r)
+	if !ok {
+		return
+	}
+	keys, err := h.keys.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"api_keys": keys})
+}
+
+// CreateAPIKey godoc
+// @Summary Create an API key
+// @Description Create a named API key limited to the given scopes (permissions such as users:read), each of which the owner's role must grant. The key expires after expires_in_days (default 90, at most 365) and is only shown in this response. Send it as "Authorization: ApiKey <key>".
+// @Tags api-keys
+// @Accept  json
+// @Produce  json
+// @Success 201 {object} map[string]interface{}
+// @Router /me/api-keys [post]
+// @Router /users/{id}/api-keys [post]
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var body struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays *int     `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.WriteError(w, r, response.BadRequest("Invalid request payload"))
+		return
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" || len(body.Name) > maxNameLength {
+		response.WriteError(w, r, response.BadRequest("name is required and must be at most 100 characters"))
+		return
+	}
+	days := defaultExpiryDays
+	if body.ExpiresInDays != nil {
+		days = *body.ExpiresInDays
+	}
+	if days < 1 || days > maxExpiryDays {
+		response.WriteError(w, r, response.BadRequest("expires_in_days must be between 1 and 365"))
+		return
+	}
+
+	user, ok := h.owner(w, r)
+	if !ok {
+		return
+	}
+	// key ขอสิทธิ์ได้ไม่เกิน role ของเจ้าของ
+	var scopes []string
+	for _, scope := range body.Scopes {
+		if !middleware.Role(user.Role).Can(middleware.Permission(scope)) {
+			response.WriteError(w, r, response.New(http.StatusBadRequest, response.CodeInvalidScope, "scope "+strconv.Quote(scope)+" is not granted to the user's role"))
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		response.WriteError(w, r, response.New(http.StatusBadRequest, response.CodeInvalidScope, "scopes must list at least one permission"))
+		return
+	}
+
+	raw, err := newKey()
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	key := models.APIKey{UserID: user.ID, Name: body.Name, Prefix: raw[:prefixLength], Scopes: scopes}
+	err = h.audit.Tx(r.Context(), func(ctx context.Context) error {
+		if err := h.keys.Create(ctx, &key, middleware.HashAPIKey(raw), time.Duration(days)*24*time.Hour); err != nil {
+			return err
+		}
+		return h.audit.Record(ctx, r, audit.ActionUserAPIKeyCreate, audit.EntityUser, user.ID, map[string]models.FieldChange{
+			"api_key": {From: nil, To: key},
+		})
+	})
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"api_key": key, "key": raw})
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Description Revoke an API key of the caller (/me/api-keys/{key_id}) or of a user (/users/{id}/api-keys/{key_id}, requires api_keys:manage). The key stops working immediately.
+// @Tags api-keys
+// @Produce  json
+// @Param key_id path int true "API key ID"
+// @Success 200 {object} map[string]string
+// @Router /me/api-keys/{key_id} [delete]
+// @Router /users/{id}/api-keys/{key_id} [delete]
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	keyID, err := strconv.Atoi(mux.Vars(r)["key_id"])
+	if err != nil {
+		response.WriteError(w, r, response.BadRequest("Invalid API key ID"))
+		return
+	}
+	user, ok := h.owner(w, r)
+	if !ok {
+		return
+	}
+
+	err = h.audit.Tx(r.Context(), func(ctx context.Context) error {
+		keys, err := h.keys.ListByUser(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(keys, func(k models.APIKey) bool { return k.ID == keyID })
+		if i < 0 {
+			return errAPIKeyNotFound
+		}
+		if err := h.keys.Revoke(ctx, user.ID, keyID); err != nil {
+			return err
+		}
+		return h.audit.Record(ctx, r, audit.ActionUserAPIKeyRevoke, audit.EntityUser, user.ID, map[string]models.FieldChange{
+			"api_key": {From: keys[i], To: nil},
+		})
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		err = errAPIKeyNotFound
+	}
+	if err != nil {
+		response.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "API key revoked"})
+}
@@ -0,0 +1,116 @@
+// Package audit บันทึกว่าใครเปลี่ยนอะไรในระบบ และให้ admin ค้นหาประวัติผ่าน GET /api/audit
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"golang-backend/api/response"
+	"golang-backend/middleware"
+	"golang-backend/models"
+	"golang-backend/repository"
+	"net/http"
+	"reflect"
+)
+
+// ประเภทของข้อมูลที่ถูกเปลี่ยน (audit_log.entity_type)
+const (
+	EntityUser = "user"
+	EntityTeam = "team"
+)
+
+// การกระทำที่ถูกบันทึก (audit_log.action)
+const (
+	ActionUserCreate           = "user.create"
+	ActionUserUpdate           = "user.update"
+	ActionUserDelete           = "user.delete"
+	ActionUserRestore          = "user.restore"
+	ActionUserUnlock           = "user.unlock"
+	ActionUserTwoFactorEnable  = "user.2fa_enable"
+	ActionUserTwoFactorDisable = "user.2fa_disable"
+	ActionUserPasswordReset    = "user.password_reset"
+	ActionUserEmailVerify      = "user.email_verify"
+	ActionUserAPIKeyCreate     = "user.api_key_create"
+	ActionUserAPIKeyRevoke     = "user.api_key_revoke"
+	// ActionUserRefreshTokenReuse คือ refresh token ที่ถูก rotate แล้วถูกนำมาใช้ซ้ำ (session ถูก revoke ทั้ง family)
+	ActionUserRefreshTokenReuse = "user.refresh_token_reuse"
+	ActionTeamCreate            = "team.create"
+	ActionTeamUpdate            = "team.update"
+	ActionTeamDelete            = "team.delete"
+	ActionTeamRestore           = "team.restore"
+	ActionTeamMemberAdd         = "team.member_add"
+	ActionTeamMemberRemove      = "team.member_remove"
+)
+
+// Redacted ใช้แทนค่าของฟิลด์ลับ เช่นรหัสผ่าน เพื่อบอกว่ามีการเปลี่ยนโดยไม่เก็บค่าจริง
+const Redacted = "[redacted]"
+
+// ignoredFields คือฟิลด์ที่ไม่ถูกนำมา diff
+var ignoredFields = map[string]bool{
+	"memberships": true, // บันทึกเป็น team.member_add และ team.member_remove อยู่แล้ว
+	"password":    true, // handler บันทึกเป็น Redacted เอง
+}
+
+// Log บันทึก audit entry ใน transaction เดียวกับการเปลี่ยนแปลง
+type Log struct {
+	tx      repository.Transactor
+	entries repository.AuditRepository
+}
+
+func NewLog(tx repository.Transactor, entries repository.AuditRepository) *Log {
+	return &Log{tx: tx, entries: entries}
+}
+
+// Tx รัน fn ใน transaction ถ้า fn คืน error ทั้งการเปลี่ยนแปลงและ audit entry จะถูกยกเลิก
+func (l *Log) Tx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return l.tx.WithinTx(ctx, fn)
+}
+
+// Record บันทึกการกระทำของผู้เรียก request r โดยต้องเรียกด้วย ctx ที่ได้จาก Tx
+func (l *Log) Record(ctx context.Context, r *http.Request, action, entityType string, entityID int, changes map[string]models.FieldChange) error {
+	entry := models.AuditEntry{
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Changes:    changes,
+		IP:         response.ClientIP(r),
+	}
+	if entry.Changes == nil {
+		entry.Changes = map[string]models.FieldChange{}
+	}
+	if p, ok := middleware.PrincipalFromContext(ctx); ok {
+		entry.ActorID = &p.UserID
+		entry.ActorUsername = p.Username
+	}
+	return l.entries.Record(ctx, &entry)
+}
+
+// Diff เปรียบเทียบ before กับ after ทีละฟิลด์ตามชื่อใน JSON และคืนเฉพาะฟิลด์ที่ต่างกัน
+// before เป็น nil สำหรับการสร้าง และ after เป็น nil สำหรับการลบ
+func Diff(before, after interface{}) map[string]models.FieldChange {
+	from, to := fields(before), fields(after)
+	changes := map[string]models.FieldChange{}
+	for key := range from {
+		if _, ok := to[key]; !ok {
+			to[key] = nil
+		}
+	}
+	for key, value := range to {
+		if ignoredFields[key] || reflect.DeepEqual(from[key], value) {
+			continue
+		}
+		changes[key] = models.FieldChange{From: from[key], To: value}
+	}
+	return changes
+}
+
+// fields แปลง v เป็น map ตามชื่อฟิลด์ใน JSON เพื่อให้ diff ใช้ชื่อเดียวกับ API
+func fields(v interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	if v == nil {
+		return m
+	}
+	if data, err := json.Marshal(v); err == nil {
+		json.Unmarshal(data, &m)
+	}
+	return m
+}
@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"golang-backend/api/response"
+	"golang-backend/repository"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Handler ให้บริการ GET /api/audit
+type Handler struct {
+	entries repository.AuditRepository
+}
+
+func NewHandler(entries repository.AuditRepository) *Handler {
+	return &Handler{entries: entries}
+}
+
+// GetAudit godoc
+// @Summary List audit log entries
+// @Description Newest first. Only admins can read the audit log.
+// @Tags audit
+// @Produce  json
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param offset query int false "Number of entries to skip"
+// @Param actor_id query int false "Filter by the user who made the change"
+// @Param action query string false "Filter by action, e.g. user.update"
+// @Param entity_type query string false "user or team"
+// @Param entity_id query int false "Filter by the changed user or team"
+// @Param from query string false "Created at or after (YYYY-MM-DD or RFC3339)"
+// @Param to query string false "Created at or before (YYYY-MM-DD or RFC3339)"
+// @Success 200 {array} models.AuditEntry
+// @Router /audit [get]
+func (h *Handler) GetAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	page, err := response.ParsePage(r)
+	if err != nil {
+		response.WriteError(w, r, response.New(http.StatusBadRequest, response.CodeInvalidQuery, err.Error()))
+		return
+	}
+	filter, err := auditFilter(r)
+	if err != nil {
+		response.WriteError(w, r, response.New(http.StatusBadRequest, response.CodeInvalidQuery, err.Error()))
+		return
+	}
+	filter.Limit, filter.Offset = page.Limit, page.Offset
+
+	entries, total, err := h.entries.List(r.Context(), filter)
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	page.Total = total
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response.List(r, "entries", entries, page))
+}
+
+// auditFilter สร้าง filter จาก query string ของ GetAudit
+func auditFilter(r *http.Request) (repository.AuditFilter, error) {
+	q := r.URL.Query()
+	filter := repository.AuditFilter{
+		Action:     q.Get("action"),
+		EntityType: q.Get("entity_type"),
+	}
+
+	for name, dst := range map[string]**int{"actor_id": &filter.ActorID, "entity_id": &filter.EntityID} {
+		if v := q.Get(name); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				return filter, errors.New(name + " must be an integer")
+			}
+			*dst = &id
+		}
+	}
+	if from := q.Get("from"); from != "" {
+		t, _, err := parseDateParam(from)
+		if err != nil {
+			return filter, errors.New("from must be YYYY-MM-DD or RFC3339")
+		}
+		filter.CreatedFrom = &t
+	}
+	if to := q.Get("to"); to != "" {
+		t, dateOnly, err := parseDateParam(to)
+		if err != nil {
+			return filter, errors.New("to must be YYYY-MM-DD or RFC3339")
+		}
+		// วันที่แบบไม่มีเวลาให้นับรวมทั้งวัน
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		} else {
+			t = t.Add(time.Second)
+		}
+		filter.CreatedBefore = &t
+	}
+	return filter, nil
+}
+
+func parseDateParam(v string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	return t, false, err
+}
@@ -1,67 +1,85 @@
 package login
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
-	"fmt"
-	"golang-backend/database"
+	"errors"
+	"golang-backend/api/password"
+	"golang-backend/api/response"
+	"golang-backend/config"
+	"golang-backend/models"
+	"golang-backend/repository"
+	"golang-backend/signing"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // User struct สำหรับจัดการข้อมูลผู้ใช้
-type User struct {
-	ID        int     `json:"id"`
-	Username  string  `json:"username"`
-	FirstName string  `json:"firstname"`
-	LastName  string  `json:"lastname"`
-	Email     string  `json:"email"`
-	Phone     string  `json:"phone"`
-	Role      string  `json:"role"`
-	Password  string  `json:"password,omitempty"` // Exclude password from being output in JSON
-	CreatedAt string  `json:"created_at"`
-	TeamId    *int    `json:"team_id"`
-	TeamName  *string `json:"team_name"`
+type User = models.User
+
+// Handler จัดการการเข้าสู่ระบบและออก JWT ที่เซ็นด้วย key ปัจจุบันของ keys
+type Handler struct {
+	jwt       config.JWTConfig
+	keys      *signing.KeySet
+	passwords *password.Service
+	users     repository.UserRepository
+	tokens    repository.RefreshTokenRepository
+	twoFactor repository.TwoFactorRepository
+	throttle  *Throttle
+	audit     auditor
 }
 
-var jwtKey = []byte("c52d0fb7e13a8db018af68aff4c2684162cd9b641fe4d22180eae5d7499a329b074ddebcc254a58539e5c5eea9a0d8fb4c7c1123d2996bd219b4738ae5ce91f8e9bfdfa0d851f7ace899ba4c292c3ebfd0da11063531f0b8805748409df7324367053f71c62be461107dda56a81600a8db34762efc458bf25bf7c31f5e39e411fc247dd9926ee6bd40b56c6fedc4b602a2a67941ddbd9bd739f7573bb23c099466d1b7c8a219721af7122ab9e5fa3207c490ce2476e784b1d719b2ff6c8d371a39ccf60a2c7a974d3b7a25fe1d61aeb4912a005c6a58c561110aa34fe3e1ed2242ee53661ae57bda286d6d365a0ef14e5c2a59e67f4db6148d495042fe6b634f") // อย่าลืมเปลี่ยนเป็นคีย์ที่ปลอดภัย
+// auditor คือ *audit.Log ประกาศเป็น interface เพราะ package audit import middleware ซึ่ง import login
+type auditor interface {
+	Tx(ctx context.Context, fn func(ctx context.Context) error) error
+	Record(ctx context.Context, r *http.Request, action, entityType string, entityID int, changes map[string]models.FieldChange) error
+}
+
+func NewHandler(cfg config.JWTConfig, keys *signing.KeySet, loginCfg config.LoginConfig, passwords *password.Service, users repository.UserRepository, tokens repository.RefreshTokenRepository, attempts repository.LoginAttemptRepository, twoFactor repository.TwoFactorRepository, auditLog auditor) *Handler {
+	return &Handler{
+		jwt:       cfg,
+		keys:      keys,
+		passwords: passwords,
+		users:     users,
+		tokens:    tokens,
+		twoFactor: twoFactor,
+		throttle:  NewThrottle(loginCfg, attempts),
+		audit:     auditLog,
+	}
+}
+
+// errInvalidCredentials ใช้ทั้งกรณีไม่พบผู้ใช้และรหัสผ่านผิด เพื่อไม่ให้เดาได้ว่าบัญชีใดมีอยู่
+var errInvalidCredentials = response.New(http.StatusUnauthorized, response.CodeInvalidCredentials, "Invalid credentials")
 
 // โครงสร้างของ JWT Claims
 type Claims struct {
+	UserID   int    `json:"user_id"`
 	Username string `json:"username"`
+	Role     string `json:"role"`
+	TeamID   *int   `json:"team_id,omitempty"`
+	// SessionID คือ family ของ refresh token ที่ออก access token นี้
+	SessionID string `json:"sid"`
 	jwt.StandardClaims
 }
 
-func CreateToken(username string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour) // ตั้งเวลาหมดอายุของ JWT
-
+func (h *Handler) CreateToken(user User, sessionID string) (string, error) {
 	claims := &Claims{
-		Username: username,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-		},
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		TeamID:    user.TeamId,
+		SessionID: sessionID,
+		// iss, aud, iat, nbf และ exp ตาม config
+		StandardClaims: h.keys.Registered(h.keys.Audience(), time.Duration(h.jwt.TTL)),
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey) // เซ็นชื่อด้วยคีย์ลับ
-}
-
-func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
-}
-
-// ฟังก์ชันสำหรับตรวจสอบรหัสผ่าน
-func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+	return h.keys.Sign(claims)
 }
 
 // ฟังก์ชันสำหรับ login
-func Login(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	var loginData struct {
@@ -70,54 +88,101 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&loginData); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		response.WriteError(w, r, response.BadRequest("Invalid input"))
 		return
 	}
 
 	// ตรวจสอบว่าค่าที่ได้รับไม่เป็นค่าว่าง
 	if loginData.Identifier == "" || loginData.Password == "" {
-		http.Error(w, "Username/email and password are required", http.StatusBadRequest)
+		response.WriteError(w, r, response.BadRequest("Username/email and password are required"))
 		return
 	}
 
-	var user User
-	query := `
-		SELECT id, username, firstname, lastname, email, phone, role, password, created_at 
-		FROM users 
-		WHERE username = ? OR email = ?
-	`
-	row := database.DB.QueryRow(query, loginData.Identifier, loginData.Identifier)
+	ctx := r.Context()
+	ip := response.ClientIP(r)
+	user, err := h.users.GetByIdentifier(ctx, loginData.Identifier)
+	found := err == nil
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	account := identifierKey(loginData.Identifier)
+	if found {
+		account = AccountKey(user.ID)
+	}
 
-	if err := row.Scan(&user.ID, &user.Username, &user.FirstName, &user.LastName, &user.Email, &user.Phone, &user.Role, &user.Password, &user.CreatedAt); err != nil {
-		if err == sql.ErrNoRows {
-			// บันทึกเหตุการณ์การเข้าสู่ระบบที่ล้มเหลว
-			fmt.Println("Invalid login attempt for identifier:", loginData.Identifier)
-			http.Error(w, "Invalid username or email", http.StatusUnauthorized)
-			return
-		}
-		http.Error(w, "Query error: "+err.Error(), http.StatusInternalServerError)
+	// ระหว่างรอหรือถูกล็อกจะไม่ตรวจรหัสผ่านเลย และไม่นับเป็นการล้มเหลวเพิ่ม
+	wait, locked, err := h.throttle.Check(ctx, account, IPKey(ip))
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	if wait > 0 {
+		WriteThrottled(w, r, wait, locked)
 		return
 	}
 
-	if !CheckPasswordHash(loginData.Password, user.Password) {
+	// hash ว่างเมื่อไม่พบผู้ใช้ Check จะเทียบกับ hash หลอกแทน
+	ok, rehash := h.passwords.Check(loginData.Password, user.Password)
+	if !ok {
 		// บันทึกเหตุการณ์การเข้าสู่ระบบที่ล้มเหลว
-		fmt.Println("Invalid password attempt for identifier:", loginData.Identifier)
-		http.Error(w, "Invalid password", http.StatusUnauthorized)
+		log.Printf("failed login for identifier %q from %s", loginData.Identifier, ip)
+		if err := h.throttle.Fail(ctx, account, IPKey(ip)); err != nil {
+			response.WriteError(w, r, response.Internal(err))
+			return
+		}
+		response.WriteError(w, r, errInvalidCredentials)
+		return
+	}
+	if rehash {
+		h.rehash(r, user.ID, loginData.Password)
+	}
+	// ผู้ใช้ที่เปิด 2FA ยังไม่ได้ login สำเร็จ ตัวนับจึงยังไม่ถูกล้างจนกว่าจะผ่านรหัส 2FA
+	if user.TwoFactorEnabled {
+		h.writeChallenge(w, r, user)
+		return
+	}
+	if err := h.throttle.Succeed(ctx, account); err != nil {
+		response.WriteError(w, r, response.Internal(err))
 		return
 	}
 
-	// สร้าง JWT token
-	token, err := CreateToken(user.Username)
+	h.startSession(w, r, user)
+}
+
+// rehash บันทึก hash ใหม่ด้วยพารามิเตอร์ปัจจุบัน ถ้าไม่สำเร็จจะลองใหม่ใน login ครั้งถัดไป จึงไม่ทำให้ login ล้มเหลว
+func (h *Handler) rehash(r *http.Request, userID int, plain string) {
+	hash, err := h.passwords.Hash(plain)
+	if err == nil {
+		err = h.users.Update(r.Context(), userID, repository.UserUpdate{PasswordHash: &hash})
+	}
+	if err != nil {
+		log.Printf("request_id=%s rehash password of user %d: %v", response.RequestID(r.Context()), userID, err)
+	}
+}
+
+// startSession เริ่ม session ใหม่: refresh token family ใหม่ และ access token ที่อ้างถึง family นั้น
+func (h *Handler) startSession(w http.ResponseWriter, r *http.Request, user User) {
+	familyID, err := newFamilyID()
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	refreshToken, err := h.storeRefreshToken(r.Context(), user.ID, familyID)
 	if err != nil {
-		http.Error(w, "Could not create token", http.StatusInternalServerError)
+		response.WriteError(w, r, response.Internal(err))
 		return
 	}
 
-	// ส่ง JWT token กลับไปยังผู้ใช้
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Login successful",
-		"user":    user,
-		"token":   token, // ส่ง token กลับไป
-	})
+	h.writeSession(w, r, "Login successful", user, familyID, refreshToken)
+}
+
+// SignIn เข้าสู่ระบบให้ผู้ใช้ที่ยืนยันตัวตนแล้วด้วยวิธีอื่น (เช่น single sign-on) และตอบแบบเดียวกับ Login
+// ผู้ใช้ที่เปิด 2FA จะได้ challenge token และต้องยืนยันรหัสที่ /auth/2fa เหมือน login ด้วยรหัสผ่าน
+func (h *Handler) SignIn(w http.ResponseWriter, r *http.Request, user User) {
+	if user.TwoFactorEnabled {
+		h.writeChallenge(w, r, user)
+		return
+	}
+	h.startSession(w, r, user)
 }
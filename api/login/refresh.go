@@ -0,0 +1,225 @@
+package login
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"golang-backend/api/response"
+	"golang-backend/repository"
+	"log"
+	"net/http"
+	"time"
+)
+
+// refresh token เป็นค่าสุ่มแบบ opaque ฐานข้อมูลเก็บเฉพาะ SHA-256 ของมัน
+// token ทุกตัวที่เกิดจากการ login ครั้งเดียวกันอยู่ใน family เดียวกัน (family_id คือ sid ใน access token)
+// การ refresh จะ rotate token เดิมและออก token ใหม่ใน family เดิม ถ้า token ที่ถูก rotate แล้วถูกใช้ซ้ำ
+// ถือว่าถูกขโมยและ revoke ทั้ง family ส่วน token ที่ถูก revoke ด้วยเหตุอื่น (เช่น logout) เป็นเพียง token ที่ใช้ไม่ได้
+
+// ค่าเดียวกับ audit.ActionUserRefreshTokenReuse และ audit.EntityUser (login import audit ไม่ได้)
+const (
+	actionRefreshTokenReuse = "user.refresh_token_reuse"
+	entityUser              = "user"
+)
+
+var (
+	errInvalidRefreshToken = response.New(http.StatusUnauthorized, response.CodeInvalidRefreshToken, "Invalid refresh token")
+	errRefreshTokenReused  = response.New(http.StatusUnauthorized, response.CodeRefreshTokenReused, "Refresh token reuse detected")
+)
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func newFamilyID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// storeRefreshToken สร้าง refresh token ใหม่ใน family และคืนค่า token ดิบให้ client
+func (h *Handler) storeRefreshToken(ctx context.Context, userID int, familyID string) (string, error) {
+	raw, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	if err := h.tokens.Create(ctx, userID, familyID, hashToken(raw), time.Duration(h.jwt.RefreshTTL)); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// writeSession ส่ง access token และ refresh token กลับไปยังผู้ใช้
+func (h *Handler) writeSession(w http.ResponseWriter, r *http.Request, message string, user User, familyID, refreshToken string) {
+	token, err := h.CreateToken(user, familyID)
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	user.Password = "" // ไม่ส่ง password hash กลับไป
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":       message,
+		"user":          user,
+		"token":         token, // access token อายุสั้น
+		"expires_in":    int64(time.Duration(h.jwt.TTL) / time.Second),
+		"refresh_token": refreshToken,
+	})
+}
+
+// Refresh แลก refresh token เป็น access token ใหม่และ rotate refresh token
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RefreshToken == "" {
+		response.WriteError(w, r, response.BadRequest("refresh_token is required"))
+		return
+	}
+
+	stored, err := h.tokens.GetByHash(r.Context(), hashToken(body.RefreshToken))
+	if errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, errInvalidRefreshToken)
+		return
+	}
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	if stored.Revoked && !stored.Rotated {
+		response.WriteError(w, r, errInvalidRefreshToken)
+		return
+	}
+	if stored.Revoked {
+		// token ที่ถูก rotate ไปแล้วถูกนำมาใช้ซ้ำ: revoke ทั้ง family
+		log.Printf("request_id=%s refresh token reuse detected for user %d, revoking session %s", response.RequestID(r.Context()), stored.UserID, stored.FamilyID)
+		err := h.audit.Tx(r.Context(), func(ctx context.Context) error {
+			if err := h.tokens.RevokeFamily(ctx, stored.FamilyID); err != nil {
+				return err
+			}
+			return h.audit.Record(ctx, r, actionRefreshTokenReuse, entityUser, stored.UserID, nil)
+		})
+		if err != nil {
+			response.WriteError(w, r, response.Internal(err))
+			return
+		}
+		response.WriteError(w, r, errRefreshTokenReused)
+		return
+	}
+	if stored.Expired {
+		response.WriteError(w, r, response.New(http.StatusUnauthorized, response.CodeRefreshTokenExpired, "Refresh token expired"))
+		return
+	}
+
+	// โหลดข้อมูลผู้ใช้ใหม่ เพื่อให้ role/team ที่เปลี่ยนไปมีผลใน access token ใหม่
+	user, err := h.users.GetByID(r.Context(), stored.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, errInvalidRefreshToken)
+		return
+	}
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	// ถ้ามี request อื่น rotate token นี้ไปก่อนถือว่าเป็นการใช้ซ้ำ
+	err = h.tokens.Rotate(r.Context(), stored, hashToken(refreshToken), time.Duration(h.jwt.RefreshTTL))
+	if errors.Is(err, repository.ErrTokenReused) {
+		response.WriteError(w, r, errRefreshTokenReused)
+		return
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, errInvalidRefreshToken)
+		return
+	}
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	h.writeSession(w, r, "Token refreshed", user, stored.FamilyID, refreshToken)
+}
+
+// Logout revoke session (family) ของ refresh token ที่ส่งมา
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RefreshToken == "" {
+		response.WriteError(w, r, response.BadRequest("refresh_token is required"))
+		return
+	}
+
+	stored, err := h.tokens.GetByHash(r.Context(), hashToken(body.RefreshToken))
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	if err == nil {
+		if err := h.tokens.RevokeFamily(r.Context(), stored.FamilyID); err != nil {
+			response.WriteError(w, r, response.Internal(err))
+			return
+		}
+	}
+
+	// ตอบสำเร็จเสมอ เพื่อไม่บอกว่า token มีอยู่จริงหรือไม่
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out"})
+}
+
+// LogoutAll revoke ทุก session ของเจ้าของ refresh token ที่ส่งมา (token ต้องยังใช้ได้อยู่)
+func (h *Handler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.RefreshToken == "" {
+		response.WriteError(w, r, response.BadRequest("refresh_token is required"))
+		return
+	}
+
+	stored, err := h.tokens.GetByHash(r.Context(), hashToken(body.RefreshToken))
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && (stored.Revoked || stored.Expired)) {
+		response.WriteError(w, r, errInvalidRefreshToken)
+		return
+	}
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	if err := h.tokens.RevokeUser(r.Context(), stored.UserID); err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out from all sessions"})
+}
@@ -0,0 +1,92 @@
+package login
+
+import (
+	"context"
+	"errors"
+	"golang-backend/config"
+	"golang-backend/repository"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// การ login ที่ล้มเหลวถูกนับด้วย key สองตัวพร้อมกัน: บัญชีที่ถูกเดา และ IP ของผู้เดา
+// identifier ที่ไม่มีในระบบก็ถูกนับและล็อกเหมือนบัญชีจริง เพื่อไม่ให้ใช้การล็อกตรวจว่าบัญชีมีอยู่หรือไม่
+
+// AccountKey คือ key ของตัวนับและการล็อกของผู้ใช้ userID
+func AccountKey(userID int) string {
+	return "user:" + strconv.Itoa(userID)
+}
+
+func identifierKey(identifier string) string {
+	return "identifier:" + strings.ToLower(identifier)
+}
+
+// IPKey คือ key ของตัวนับของ IP ip
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Throttle ตัดสินว่า key ใดต้องรอหรือถูกล็อกตาม config.LoginConfig
+// endpoint อื่นที่ต้องจำกัดการเรียกซ้ำ (เช่น forgot-password) ใช้ร่วมได้โดยใช้ key ของตัวเอง
+type Throttle struct {
+	cfg      config.LoginConfig
+	attempts repository.LoginAttemptRepository
+}
+
+func NewThrottle(cfg config.LoginConfig, attempts repository.LoginAttemptRepository) *Throttle {
+	return &Throttle{cfg: cfg, attempts: attempts}
+}
+
+// Check คืนเวลาที่ต้องรอก่อนลองใหม่ และ locked เป็น true ถ้าบัญชีถูกล็อก
+func (t *Throttle) Check(ctx context.Context, account, ip string) (wait time.Duration, locked bool, err error) {
+	for _, key := range []string{account, ip} {
+		a, err := t.attempts.Get(ctx, key)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		if key == account && a.LockedFor > 0 {
+			return a.LockedFor, true, nil
+		}
+		wait = max(wait, t.backoff(a.Failures)-a.SinceLastFailure)
+	}
+	return wait, false, nil
+}
+
+// backoff คือเวลาที่ต้องรอหลังล้มเหลว failures ครั้งติดกัน
+func (t *Throttle) backoff(failures int) time.Duration {
+	base, limit := time.Duration(t.cfg.BackoffBase), time.Duration(t.cfg.BackoffMax)
+	if failures <= 0 || base <= 0 {
+		return 0
+	}
+	d := base
+	for i := 1; i < failures && d < limit; i++ {
+		d *= 2
+	}
+	return min(d, limit)
+}
+
+// Fail บันทึกการล้มเหลวของทั้งสอง key และล็อกบัญชีเมื่อครบ MaxFailures
+func (t *Throttle) Fail(ctx context.Context, account, ip string) error {
+	window := time.Duration(t.cfg.Lockout)
+	if _, err := t.attempts.RecordFailure(ctx, ip, window); err != nil {
+		return err
+	}
+	failures, err := t.attempts.RecordFailure(ctx, account, window)
+	if err != nil {
+		return err
+	}
+	if failures >= t.cfg.MaxFailures {
+		return t.attempts.Lock(ctx, account, time.Duration(t.cfg.Lockout))
+	}
+	return nil
+}
+
+// Succeed ล้างตัวนับของบัญชีเมื่อ login สำเร็จ ตัวนับของ IP หมดอายุเองตาม Lockout เท่านั้น
+// ไม่เช่นนั้นผู้เดารหัสผ่านจะ login บัญชีของตัวเองเป็นระยะเพื่อล้าง backoff ของ IP ได้
+func (t *Throttle) Succeed(ctx context.Context, account string) error {
+	return t.attempts.Reset(ctx, account)
+}
@@ -0,0 +1,136 @@
+package login
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"golang-backend/repository"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP ตาม RFC 6238 แบบที่แอป authenticator ทั่วไปใช้: HMAC-SHA1, 6 หลัก, ช่วงละ 30 วินาที
+
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew คือจำนวนช่วงก่อนและหลังปัจจุบันที่ยอมรับ เผื่อนาฬิกาของโทรศัพท์คลาดเคลื่อน
+	totpSkew = 1
+	// TOTPIssuer คือชื่อบริการที่แสดงในแอป authenticator
+	TOTPIssuer = "User Management API"
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret สุ่ม secret ขนาด 160 bit ในรูป base32 สำหรับใส่ในแอป authenticator
+func NewTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPURI คือ otpauth:// URI ที่แปลงเป็น QR code ให้แอป authenticator สแกนได้
+func TOTPURI(secret, account string) string {
+	label := url.PathEscape(TOTPIssuer + ":" + account)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", TOTPIssuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// totpCode คำนวณรหัสของ time step หนึ่ง
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// ValidateTOTP ตรวจ code กับ secret ณ เวลา now และคืน time step ที่ตรง
+// ผู้เรียกต้องบันทึก step ที่ใช้แล้ว (TwoFactorRepository.UseStep) เพื่อไม่ให้รหัสเดิมถูกใช้ซ้ำ
+func ValidateTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// RecoveryCodeCount คือจำนวน recovery code ที่ออกให้ต่อการเปิด 2FA หนึ่งครั้ง
+const RecoveryCodeCount = 10
+
+var recoveryEncoding = base32.NewEncoding("abcdefghijkmnpqrstuvwxyz23456789").WithPadding(base32.NoPadding)
+
+// NewRecoveryCodes สุ่ม recovery code แบบ xxxxx-xxxxx และคืนทั้งค่าที่แสดงให้ผู้ใช้และ hash ที่เก็บในฐานข้อมูล
+func NewRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < RecoveryCodeCount; i++ {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := recoveryEncoding.EncodeToString(b)[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, HashRecoveryCode(raw))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode คือ hash ของ recovery code โดยไม่สนตัวพิมพ์ ขีด และช่องว่าง
+// code สุ่มมาจาก 48 bit จึงใช้ SHA-256 ได้เหมือน refresh token
+func HashRecoveryCode(code string) string {
+	code = strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	return hashToken(code)
+}
+
+// TOTPCode คำนวณรหัสของ secret ณ เวลา t (ใช้ในการทดสอบและเครื่องมือฝั่ง client)
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return totpCode(key, t.Unix()/totpPeriod), nil
+}
+
+// CheckTOTP ตรวจรหัส TOTP กับ secret ของผู้ใช้ และบันทึกว่า time step ถูกใช้แล้ว
+// รหัสที่ถูกต้องแต่เคยใช้ไปแล้วถือว่าไม่ผ่าน
+func CheckTOTP(ctx context.Context, twoFactor repository.TwoFactorRepository, userID int, secret, code string) (bool, error) {
+	step, ok := ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return twoFactor.UseStep(ctx, userID, step)
+}
+
+// CheckSecondFactor รับได้ทั้งรหัส TOTP และ recovery code ที่ยังไม่ถูกใช้
+func CheckSecondFactor(ctx context.Context, twoFactor repository.TwoFactorRepository, userID int, secret, code string) (bool, error) {
+	if ok, err := CheckTOTP(ctx, twoFactor, userID, secret, code); ok || err != nil {
+		return ok, err
+	}
+	return twoFactor.UseRecoveryCode(ctx, userID, HashRecoveryCode(code))
+}
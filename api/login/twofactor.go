@@ -0,0 +1,159 @@
+package login
+
+import (
+	"encoding/json"
+	"errors"
+	"golang-backend/api/response"
+	"golang-backend/repository"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ผู้ใช้ที่เปิด 2FA จะได้ challenge token แทน access token เมื่อรหัสผ่านถูกต้อง
+// แล้วต้องนำ challenge token มาแลกพร้อมรหัส TOTP (หรือ recovery code) ที่ /auth/2fa
+// challenge token ไม่มี sid จึงใช้เรียก /api แทน access token ไม่ได้
+
+const (
+	challengePurpose = "2fa"
+	challengeTTL     = 5 * time.Minute
+	// challengeAudience ต่อท้าย aud ของ access token เพื่อให้ challenge token ใช้แทน access token ไม่ได้แม้ไม่ดู sid
+	challengeAudience = "#2fa"
+)
+
+var (
+	errInvalidChallenge     = response.New(http.StatusUnauthorized, response.CodeInvalidChallenge, "Invalid or expired challenge token")
+	errInvalidTwoFactorCode = response.New(http.StatusUnauthorized, response.CodeInvalidTwoFactorCode, "Invalid two-factor code")
+)
+
+type challengeClaims struct {
+	UserID  int    `json:"user_id"`
+	Purpose string `json:"purpose"`
+	jwt.StandardClaims
+}
+
+func (h *Handler) createChallenge(userID int) (string, error) {
+	claims := &challengeClaims{
+		UserID:         userID,
+		Purpose:        challengePurpose,
+		StandardClaims: h.keys.Registered(h.keys.Audience()+challengeAudience, challengeTTL),
+	}
+	return h.keys.Sign(claims)
+}
+
+// parseChallenge คืน user ID จาก challenge token ที่ยังไม่หมดอายุ
+func (h *Handler) parseChallenge(raw string) (int, bool) {
+	claims := &challengeClaims{}
+	err := h.keys.Parse(raw, h.keys.Audience()+challengeAudience, claims)
+	if err != nil || claims.Purpose != challengePurpose {
+		return 0, false
+	}
+	return claims.UserID, true
+}
+
+// writeChallenge ตอบ Login ของผู้ใช้ที่เปิด 2FA
+func (h *Handler) writeChallenge(w http.ResponseWriter, r *http.Request, user User) {
+	challenge, err := h.createChallenge(user.ID)
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":             "Two-factor authentication required",
+		"two_factor_required": true,
+		"challenge_token":     challenge,
+		"expires_in":          int64(challengeTTL / time.Second),
+	})
+}
+
+// VerifyTwoFactor godoc
+// @Summary Complete a two-factor login
+// @Description Exchange the challenge token from /login and a TOTP or recovery code for an access token and refresh token
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} map[string]interface{}
+// @Router /auth/2fa [post]
+func (h *Handler) VerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var body struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.ChallengeToken == "" || body.Code == "" {
+		response.WriteError(w, r, response.BadRequest("challenge_token and code are required"))
+		return
+	}
+
+	userID, ok := h.parseChallenge(body.ChallengeToken)
+	if !ok {
+		response.WriteError(w, r, errInvalidChallenge)
+		return
+	}
+	ctx := r.Context()
+	user, err := h.users.GetByID(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, errInvalidChallenge)
+		return
+	}
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	tf, err := h.twoFactor.Get(ctx, userID)
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	if !tf.Enabled {
+		response.WriteError(w, r, errInvalidChallenge)
+		return
+	}
+
+	// การเดารหัส 2FA ถูกนับรวมกับการเดารหัสผ่านของบัญชีเดียวกัน
+	account, ip := AccountKey(userID), IPKey(response.ClientIP(r))
+	wait, locked, err := h.throttle.Check(ctx, account, ip)
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	if wait > 0 {
+		WriteThrottled(w, r, wait, locked)
+		return
+	}
+
+	ok, err = CheckSecondFactor(ctx, h.twoFactor, userID, tf.Secret, body.Code)
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	if !ok {
+		if err := h.throttle.Fail(ctx, account, ip); err != nil {
+			response.WriteError(w, r, response.Internal(err))
+			return
+		}
+		response.WriteError(w, r, errInvalidTwoFactorCode)
+		return
+	}
+	if err := h.throttle.Succeed(ctx, account); err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	h.startSession(w, r, user)
+}
+
+// WriteThrottled ตอบเมื่อยังต้องรอก่อนลองใหม่หรือบัญชีถูกล็อก
+func WriteThrottled(w http.ResponseWriter, r *http.Request, wait time.Duration, locked bool) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	if locked {
+		response.WriteError(w, r, response.New(http.StatusLocked, response.CodeAccountLocked, "Account is temporarily locked after too many failed attempts"))
+		return
+	}
+	response.WriteError(w, r, response.New(http.StatusTooManyRequests, response.CodeTooManyAttempts, "Too many failed attempts, try again later"))
+}
@@ -0,0 +1,429 @@
+// Package oidc ให้ผู้ใช้ login ผ่าน identity provider ที่รองรับ OpenID Connect
+// ด้วย authorization code flow และ PKCE แล้วออก access token และ refresh token แบบเดียวกับ /login
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang-backend/api/audit"
+	"golang-backend/api/login"
+	"golang-backend/api/response"
+	"golang-backend/config"
+	"golang-backend/middleware"
+	"golang-backend/models"
+	"golang-backend/repository"
+	"golang-backend/signing"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ขั้นตอนการ login:
+//  1. GET /auth/oidc/login สุ่ม state, nonce และ code verifier เก็บไว้ใน cookie ที่เซ็นแล้ว และ redirect ไปยัง provider
+//  2. provider redirect กลับมาที่ GET /auth/oidc/callback พร้อม code และ state ซึ่งต้องตรงกับใน cookie
+//  3. แลก code เป็น ID token ด้วย code verifier ตรวจ ID token แล้วหาผู้ใช้จากอีเมล (หรือสร้างใหม่)
+//  4. ตั้ง role และทีมหลักตามกลุ่มของผู้ใช้ที่ provider แล้วตอบแบบเดียวกับ /login
+
+const (
+	flowCookie = "oidc_flow"
+	flowTTL    = 10 * time.Minute
+	// flowAudience ต่อท้าย aud ของ access token เพื่อให้ cookie ใช้แทน token อื่นไม่ได้
+	flowAudience = "#oidc"
+)
+
+var (
+	errInvalidState     = response.New(http.StatusBadRequest, response.CodeInvalidOIDCState, "Login session is missing, expired or does not match")
+	errLoginFailed      = response.New(http.StatusUnauthorized, response.CodeOIDCLoginFailed, "Single sign-on failed")
+	errUnavailable      = response.New(http.StatusBadGateway, response.CodeOIDCUnavailable, "Identity provider is unavailable")
+	errEmailNotVerified = response.New(http.StatusForbidden, response.CodeOIDCEmailUnverified, "Identity provider has not verified the email address")
+	errAccountNotFound  = response.New(http.StatusForbidden, response.CodeOIDCAccountNotFound, "No account uses this email address")
+)
+
+// Handler รวม handler ของ /auth/oidc/login และ /auth/oidc/callback
+type Handler struct {
+	cfg      config.OIDCConfig
+	provider *provider
+	keys     *signing.KeySet
+	login    *login.Handler
+	users    repository.UserRepository
+	teams    repository.TeamRepository
+	sessions repository.RefreshTokenRepository
+	audit    *audit.Log
+	// mapsRoles เป็น true เมื่อมีกลุ่มที่กำหนด role ไว้ ซึ่งทำให้ provider เป็นผู้กำหนด role ของผู้ใช้
+	mapsRoles bool
+}
+
+func NewHandler(cfg config.OIDCConfig, keys *signing.KeySet, loginHandler *login.Handler, users repository.UserRepository, teams repository.TeamRepository, sessions repository.RefreshTokenRepository, auditLog *audit.Log) *Handler {
+	h := &Handler{cfg: cfg, provider: newProvider(cfg), keys: keys, login: loginHandler, users: users, teams: teams, sessions: sessions, audit: auditLog}
+	// คัดลอกก่อนแก้เพื่อไม่ให้กระทบ slice ใน config
+	h.cfg.Groups = append([]config.OIDCGroup(nil), cfg.Groups...)
+	for i, g := range h.cfg.Groups {
+		if g.Role != "" && !middleware.Role(g.Role).Valid() {
+			log.Printf("oidc: ignoring invalid role %q of group %q", g.Role, g.Group)
+			h.cfg.Groups[i].Role = ""
+		}
+		h.mapsRoles = h.mapsRoles || h.cfg.Groups[i].Role != ""
+	}
+	return h
+}
+
+// flowClaims คือข้อมูลใน cookie ระหว่างขั้นตอนที่ 1 และ 2
+type flowClaims struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.StandardClaims
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// setFlowCookie ตั้งหรือลบ (value ว่าง) cookie ของขั้นตอน login
+func (h *Handler) setFlowCookie(w http.ResponseWriter, value string) {
+	maxAge := int(flowTTL / time.Second)
+	if value == "" {
+		maxAge = -1
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     flowCookie,
+		Value:    value,
+		Path:     "/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.cfg.RedirectURL, "https://"),
+		// provider redirect กลับมาด้วย top-level GET ซึ่ง Lax ยังส่ง cookie ให้
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Login godoc
+// @Summary Start single sign-on
+// @Description Redirect to the identity provider. The provider redirects back to /auth/oidc/callback.
+// @Tags auth
+// @Success 302
+// @Router /auth/oidc/login [get]
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	var flow flowClaims
+	var err error
+	for _, dst := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		if *dst, err = randomString(); err != nil {
+			response.WriteError(w, r, response.Internal(err))
+			return
+		}
+	}
+	// PKCE S256 (RFC 7636): provider ได้เฉพาะ hash ของ verifier
+	sum := sha256.Sum256([]byte(flow.Verifier))
+	authURL, err := h.provider.authCodeURL(r.Context(), flow.State, flow.Nonce, base64.RawURLEncoding.EncodeToString(sum[:]))
+	if err != nil {
+		log.Printf("request_id=%s %v", response.RequestID(r.Context()), err)
+		response.WriteError(w, r, errUnavailable)
+		return
+	}
+
+	flow.StandardClaims = h.keys.Registered(h.keys.Audience()+flowAudience, flowTTL)
+	cookie, err := h.keys.Sign(&flow)
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	h.setFlowCookie(w, cookie)
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback godoc
+// @Summary Finish single sign-on
+// @Description Exchange the authorization code, sign in the user with the verified email (creating the account on first login if enabled) and respond like /login.
+// @Tags auth
+// @Produce  json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State from /auth/oidc/login"
+// @Success 200 {object} map[string]interface{}
+// @Router /auth/oidc/callback [get]
+func (h *Handler) Callback(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	// cookie ใช้ได้ครั้งเดียว ไม่ว่าผลจะเป็นอย่างไร
+	var flow flowClaims
+	cookie, err := r.Cookie(flowCookie)
+	if err == nil {
+		h.setFlowCookie(w, "")
+		err = h.keys.Parse(cookie.Value, h.keys.Audience()+flowAudience, &flow)
+	}
+	if err != nil || subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(flow.State)) != 1 {
+		response.WriteError(w, r, errInvalidState)
+		return
+	}
+
+	if e := q.Get("error"); e != "" {
+		log.Printf("request_id=%s oidc provider error: %s %s", response.RequestID(ctx), e, q.Get("error_description"))
+		response.WriteError(w, r, errLoginFailed.WithDetails([]string{e}))
+		return
+	}
+	if q.Get("code") == "" {
+		response.WriteError(w, r, response.BadRequest("code is required"))
+		return
+	}
+
+	raw, err := h.provider.exchange(ctx, q.Get("code"), flow.Verifier)
+	var claims jwt.MapClaims
+	if err == nil {
+		claims, err = h.provider.verify(ctx, raw, flow.Nonce)
+	}
+	if err != nil {
+		log.Printf("request_id=%s oidc: %v", response.RequestID(ctx), err)
+		response.WriteError(w, r, errLoginFailed)
+		return
+	}
+	id, err := h.identityFrom(claims)
+	if err != nil {
+		response.WriteError(w, r, err)
+		return
+	}
+
+	user, err := h.resolve(r, id)
+	if err != nil {
+		response.WriteError(w, r, err)
+		return
+	}
+	h.login.SignIn(w, r, user)
+}
+
+// identity คือข้อมูลผู้ใช้จาก ID token
+type identity struct {
+	subject   string
+	email     string
+	username  string
+	firstName string
+	lastName  string
+	groups    map[string]bool
+}
+
+func (h *Handler) identityFrom(claims jwt.MapClaims) (identity, error) {
+	str := func(name string) string {
+		s, _ := claims[name].(string)
+		return s
+	}
+	id := identity{
+		subject:   str("sub"),
+		email:     str("email"),
+		username:  str("preferred_username"),
+		firstName: str("given_name"),
+		lastName:  str("family_name"),
+		groups:    map[string]bool{},
+	}
+	if id.email == "" {
+		log.Printf("oidc: ID token of %q has no email claim (is the email scope requested?)", id.subject)
+		return id, errLoginFailed
+	}
+	// อีเมลใช้ระบุบัญชี จึงต้องเป็นอีเมลที่ provider ยืนยันแล้ว (บาง provider ส่งค่าเป็น string)
+	if v := claims["email_verified"]; v != true && v != "true" {
+		return id, errEmailNotVerified
+	}
+	switch groups := claims[h.cfg.GroupsClaim].(type) {
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				id.groups[s] = true
+			}
+		}
+	case string:
+		id.groups[groups] = true
+	}
+	return id, nil
+}
+
+// mapGroups คืน role และทีมหลักจากรายการแรกใน config ที่ผู้ใช้เป็นสมาชิก
+// role ว่างเมื่อไม่ได้กำหนด role ให้กลุ่มใดไว้ และ team เป็น nil เมื่อไม่มีกลุ่มที่ตรงและมี team_id
+func (h *Handler) mapGroups(groups map[string]bool) (role string, team *int) {
+	for _, g := range h.cfg.Groups {
+		if !groups[g.Group] {
+			continue
+		}
+		if role == "" && g.Role != "" {
+			role = g.Role
+		}
+		if team == nil && g.TeamID != 0 {
+			id := g.TeamID
+			team = &id
+		}
+	}
+	if role == "" && h.mapsRoles {
+		role = h.cfg.DefaultRole
+	}
+	return role, team
+}
+
+// teamExists ตรวจว่าทีมที่กำหนดใน config ยังมีอยู่ ทีมที่ถูกลบจะถูกข้ามแทนการทำให้ login ล้มเหลว
+func (h *Handler) teamExists(ctx context.Context, id int) (bool, error) {
+	_, err := h.teams.GetByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		log.Printf("request_id=%s oidc: team %d in oidc.groups does not exist", response.RequestID(ctx), id)
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// resolve หาผู้ใช้ที่ใช้อีเมลเดียวกับ id หรือสร้างใหม่ แล้วปรับ role และทีมหลักตามกลุ่ม
+func (h *Handler) resolve(r *http.Request, id identity) (models.User, error) {
+	var user models.User
+	err := h.audit.Tx(r.Context(), func(ctx context.Context) error {
+		// GetByIdentifier ค้นด้วย username ได้ด้วย จึงต้องเทียบอีเมลซ้ำ
+		existing, err := h.users.GetByIdentifier(ctx, id.email)
+		switch {
+		case err == nil && strings.EqualFold(existing.Email, id.email):
+			user, err = h.sync(ctx, r, existing, id)
+			return err
+		case err != nil && !errors.Is(err, repository.ErrNotFound):
+			return err
+		case !h.cfg.Provision:
+			return errAccountNotFound
+		}
+		user, err = h.provision(ctx, r, id)
+		return err
+	})
+	return user, err
+}
+
+// sync ปรับ role และทีมหลักของผู้ใช้เดิมตามกลุ่ม และบันทึกว่าอีเมลได้รับการยืนยันแล้ว
+func (h *Handler) sync(ctx context.Context, r *http.Request, before models.User, id identity) (models.User, error) {
+	role, team := h.mapGroups(id.groups)
+	var update repository.UserUpdate
+	if role != "" && role != before.Role {
+		update.Role = &role
+	}
+	if team != nil && (before.TeamId == nil || *before.TeamId != *team) {
+		ok, err := h.teamExists(ctx, *team)
+		if err != nil {
+			return before, err
+		}
+		update.SetTeam, update.TeamID = ok, team
+	}
+	if update.Empty() && before.EmailVerified {
+		return before, nil
+	}
+
+	if !update.Empty() {
+		if err := h.users.Update(ctx, before.ID, update); err != nil {
+			return before, err
+		}
+	}
+	// token เดิมของผู้ใช้ยังมี role เก่าอยู่
+	if update.Role != nil {
+		if err := h.sessions.RevokeUser(ctx, before.ID); err != nil {
+			return before, err
+		}
+	}
+	if !before.EmailVerified {
+		if err := h.users.VerifyEmail(ctx, before.ID); err != nil {
+			return before, err
+		}
+	}
+	after, err := h.users.GetByID(ctx, before.ID)
+	if err != nil {
+		return before, err
+	}
+	return after, h.audit.Record(ctx, r, audit.ActionUserUpdate, audit.EntityUser, after.ID, audit.Diff(before, after))
+}
+
+// provision สร้างผู้ใช้ใหม่ที่ login ได้ผ่าน provider เท่านั้น (ไม่มีรหัสผ่านจนกว่าจะรีเซ็ตรหัสผ่าน)
+func (h *Handler) provision(ctx context.Context, r *http.Request, id identity) (models.User, error) {
+	role, team := h.mapGroups(id.groups)
+	if role == "" {
+		role = h.cfg.DefaultRole
+	}
+	if team != nil {
+		if ok, err := h.teamExists(ctx, *team); err != nil || !ok {
+			team = nil
+			if err != nil {
+				return models.User{}, err
+			}
+		}
+	}
+	username, err := h.availableUsername(ctx, id)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user := models.User{
+		Username:  username,
+		FirstName: id.firstName,
+		LastName:  id.lastName,
+		Email:     id.email,
+		Role:      role,
+		TeamId:    team,
+	}
+	if err := h.users.Create(ctx, &user); err != nil {
+		return user, err
+	}
+	if err := h.users.VerifyEmail(ctx, user.ID); err != nil {
+		return user, err
+	}
+	created, err := h.users.GetByID(ctx, user.ID)
+	if err != nil {
+		return user, err
+	}
+	return created, h.audit.Record(ctx, r, audit.ActionUserCreate, audit.EntityUser, created.ID, audit.Diff(nil, created))
+}
+
+// ความยาวของ username ตามกฎ "username" ของ package validate
+const (
+	minUsernameLength = 3
+	maxUsernameLength = 32
+)
+
+// availableUsername คืน username จาก preferred_username (หรือส่วนก่อน @ ของอีเมล) ที่ยังไม่มีผู้ใช้อื่นใช้
+// โดยเติมตัวเลขต่อท้ายถ้าซ้ำ ชื่อที่สั้นเกินจะขึ้นต้นด้วย "user-" และชื่อที่ยาวเกินจะถูกตัด
+// ให้ทุกชื่อรวมตัวเลขต่อท้ายยาวไม่เกิน 32 ตัวอักษร
+func (h *Handler) availableUsername(ctx context.Context, id identity) (string, error) {
+	base := id.username
+	if base == "" || strings.Contains(base, "@") {
+		base, _, _ = strings.Cut(id.email, "@")
+	}
+	base = strings.Map(func(c rune) rune {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-' {
+			return c
+		}
+		return -1
+	}, base)
+	if base == "" {
+		base = "user"
+	} else if len(base) < minUsernameLength {
+		base = "user-" + base
+	}
+	for i := 1; i <= 100; i++ {
+		suffix := ""
+		if i > 1 {
+			suffix = strconv.Itoa(i)
+		}
+		// base มีแต่ตัวอักษร ASCII จึงตัดเป็น byte ได้
+		candidate := base
+		if len(candidate)+len(suffix) > maxUsernameLength {
+			candidate = candidate[:maxUsernameLength-len(suffix)]
+		}
+		candidate += suffix
+		taken, err := h.users.Taken(ctx, repository.FieldUsername, candidate)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no available username for %q", base)
+}
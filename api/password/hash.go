@@ -0,0 +1,124 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang-backend/config"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// hash ที่เก็บไว้อยู่ในรูปแบบ PHC string ซึ่งขึ้นต้นด้วย $<algorithm>$ จึงรู้ได้จาก prefix ว่าต้องตรวจด้วย hasher ใด
+// argon2id: $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key> (base64 ไม่มี padding)
+// bcrypt:   $2a$12$... หรือ $2b$ / $2y$ ตามรูปแบบมาตรฐานของ bcrypt
+
+// hasher คือ algorithm หนึ่งที่ใช้ hash และตรวจรหัสผ่าน
+type hasher interface {
+	hash(password string) (string, error)
+	// verify คืน outdated เป็น true เมื่อรหัสผ่านถูกแต่ hash ใช้พารามิเตอร์ต่างจาก config ปัจจุบัน
+	verify(password, hash string) (ok, outdated bool, err error)
+}
+
+// hasherFor เลือก hasher จาก prefix ของ hash คืน nil ถ้าไม่รู้จัก
+func (s *Service) hasherFor(hash string) (hasher, string) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return argon2idHasher{s.cfg}, config.PasswordArgon2id
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return bcryptHasher{s.cfg}, config.PasswordBcrypt
+	}
+	return nil, ""
+}
+
+type bcryptHasher struct {
+	cfg config.PasswordConfig
+}
+
+func (h bcryptHasher) hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cfg.BcryptCost)
+	return string(hash), err
+}
+
+func (h bcryptHasher) verify(password, hash string) (bool, bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return true, cost != h.cfg.BcryptCost, err
+}
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+var errMalformedHash = errors.New("malformed argon2id hash")
+
+type argon2idHasher struct {
+	cfg config.PasswordConfig
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+}
+
+func (h argon2idHasher) hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	p := argon2Params{memory: h.cfg.Argon2Memory, time: h.cfg.Argon2Time, threads: h.cfg.Argon2Threads}
+	key := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.memory, p.time, p.threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h argon2idHasher) verify(password, hash string) (bool, bool, error) {
+	p, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return false, false, err
+	}
+	got := argon2.IDKey([]byte(password), salt, p.time, p.memory, p.threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(got, key) != 1 {
+		return false, false, nil
+	}
+	outdated := p != argon2Params{memory: h.cfg.Argon2Memory, time: h.cfg.Argon2Time, threads: h.cfg.Argon2Threads} ||
+		len(salt) != argon2SaltLen || len(key) != argon2KeyLen
+	return true, outdated, nil
+}
+
+// parseArgon2id แยก PHC string ของ argon2id เป็นพารามิเตอร์ salt และ key
+func parseArgon2id(hash string) (argon2Params, []byte, []byte, error) {
+	var p argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, errMalformedHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil || p.time == 0 || p.threads == 0 {
+		return p, nil, nil, errMalformedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, errMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return p, nil, nil, errMalformedHash
+	}
+	return p, salt, key, nil
+}
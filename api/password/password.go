@@ -0,0 +1,128 @@
+// Package password คือบริการรหัสผ่านกลางของแอป: ตรวจรหัสผ่านใหม่ตามนโยบาย hash และตรวจรหัสผ่าน
+// ทุกที่ที่รับรหัสผ่านจากผู้ใช้ต้องผ่าน Service เพื่อให้ใช้นโยบายและพารามิเตอร์การ hash เดียวกัน
+package password
+
+import (
+	_ "embed"
+	"fmt"
+	"golang-backend/api/response"
+	"golang-backend/config"
+	"log"
+	"net/http"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Service ตรวจนโยบายและ hash รหัสผ่านตาม config.PasswordConfig รองรับทั้ง argon2id และ bcrypt
+type Service struct {
+	cfg config.PasswordConfig
+	// dummyHash ใช้เทียบเมื่อไม่พบผู้ใช้ ให้เวลาตอบใกล้เคียงกับกรณีรหัสผ่านผิด
+	dummyHash string
+}
+
+func NewService(cfg config.PasswordConfig) *Service {
+	s := &Service{cfg: cfg}
+	s.dummyHash, _ = s.Hash("dummy password")
+	return s
+}
+
+var errWeakPassword = response.New(http.StatusBadRequest, response.CodeWeakPassword, "Password does not meet the password policy")
+
+//go:embed common_passwords.txt
+var commonList string
+
+// common คือรายการรหัสผ่านยอดนิยมเป็นตัวพิมพ์เล็ก
+var common = func() map[string]bool {
+	set := map[string]bool{}
+	for _, line := range strings.Split(commonList, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			set[strings.ToLower(line)] = true
+		}
+	}
+	return set
+}()
+
+// Validate ตรวจรหัสผ่านใหม่ตามนโยบาย related คือข้อมูลของผู้ใช้ที่ห้ามใช้เป็นรหัสผ่าน เช่น username และอีเมล
+// คืน 400 WEAK_PASSWORD พร้อมรายการข้อที่ไม่ผ่านใน details
+func (s *Service) Validate(password string, related ...string) error {
+	var problems []string
+	if utf8.RuneCountInString(password) < s.cfg.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters", s.cfg.MinLength))
+	}
+	if len(password) > s.cfg.MaxLength {
+		problems = append(problems, fmt.Sprintf("must be at most %d bytes", s.cfg.MaxLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		case !unicode.IsLetter(c):
+			symbol = true
+		}
+	}
+	if s.cfg.RequireUpper && !upper {
+		problems = append(problems, "must contain an uppercase letter")
+	}
+	if s.cfg.RequireLower && !lower {
+		problems = append(problems, "must contain a lowercase letter")
+	}
+	if s.cfg.RequireDigit && !digit {
+		problems = append(problems, "must contain a digit")
+	}
+	if s.cfg.RequireSymbol && !symbol {
+		problems = append(problems, "must contain a symbol")
+	}
+
+	if s.cfg.RejectCommon && common[strings.ToLower(password)] {
+		problems = append(problems, "is too common")
+	}
+	for _, v := range related {
+		// อีเมลเทียบทั้งอีเมลและส่วนก่อน @
+		local, _, _ := strings.Cut(v, "@")
+		if v != "" && (strings.EqualFold(password, v) || strings.EqualFold(password, local)) {
+			problems = append(problems, "must not be the same as your username or email")
+			break
+		}
+	}
+
+	if len(problems) > 0 {
+		return errWeakPassword.WithDetails(problems)
+	}
+	return nil
+}
+
+// Hash คืน hash ของรหัสผ่านด้วย algorithm และพารามิเตอร์ปัจจุบัน
+func (s *Service) Hash(password string) (string, error) {
+	if s.cfg.Algorithm == config.PasswordBcrypt {
+		return bcryptHasher{s.cfg}.hash(password)
+	}
+	return argon2idHasher{s.cfg}.hash(password)
+}
+
+// Check ตรวจรหัสผ่านกับ hash ที่เก็บไว้โดยเลือก algorithm จาก prefix ของ hash
+// hash ว่างคือไม่พบผู้ใช้ ซึ่งจะเทียบกับ hash หลอกแล้วคืน false เสมอ
+// rehash เป็น true เมื่อรหัสผ่านถูกแต่ hash ใช้ algorithm หรือพารามิเตอร์เก่า ผู้เรียกควร hash ใหม่ขณะที่ยังมีรหัสผ่านอยู่
+func (s *Service) Check(password, hash string) (ok, rehash bool) {
+	if hash == "" {
+		s.Check(password, s.dummyHash)
+		return false, false
+	}
+	h, algorithm := s.hasherFor(hash)
+	if h == nil {
+		log.Printf("password: stored hash has an unknown format")
+		return false, false
+	}
+	ok, outdated, err := h.verify(password, hash)
+	if err != nil {
+		log.Printf("password: verify %s hash: %v", algorithm, err)
+		return false, false
+	}
+	return ok, ok && (outdated || algorithm != s.cfg.Algorithm)
+}
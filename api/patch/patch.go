@@ -0,0 +1,349 @@
+// Package patch อ่าน body ของ PATCH ตาม Content-Type แล้วแปลงเป็น JSON Merge Patch (RFC 7396) เสมอ
+// เพื่อให้ handler ตรวจและบันทึกการแก้ไขด้วยโค้ดชุดเดียว
+//
+//	application/json และ application/merge-patch+json  ใช้ body ตามที่ส่งมา
+//	application/json-patch+json                        ลำดับ operation ตาม RFC 6902 (รวม test)
+//
+// JSON Patch ถูก apply กับ resource ปัจจุบันในรูป JSON แล้วคืนเฉพาะ field ที่เปลี่ยน
+// field ที่ถูก remove คืนเป็น null ส่วน field ที่ไม่มีใน resource (เช่น password) เพิ่มได้ด้วย add
+//
+// handler เรียก Parse ก่อนเริ่ม transaction แล้วเรียก Apply กับ resource ที่โหลด (และ lock) ภายใน transaction
+// เดียวกับการแก้ไข เพื่อให้ test operation ตรวจกับค่าที่จะถูกแก้จริง
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang-backend/api/response"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	MergePatch = "application/merge-patch+json"
+	JSONPatch  = "application/json-patch+json"
+	// Accepted คือค่าของ header Accept-Patch ของ route ที่รับ PATCH ผ่าน package นี้
+	Accepted = MergePatch + ", " + JSONPatch
+)
+
+var errUnsupported = response.New(http.StatusUnsupportedMediaType, response.CodeUnsupportedMediaType,
+	"Content-Type must be application/json, "+MergePatch+" or "+JSONPatch)
+
+// Patch คือ body ของ PATCH ที่อ่านแล้วแต่ยังไม่ถูก apply
+type Patch struct {
+	body io.Reader   // merge patch ตามที่ส่งมา
+	ops  []operation // JSON Patch (body เป็น nil)
+}
+
+// Parse อ่าน body ของ r ตาม Content-Type โดยยังไม่โหลด resource
+func Parse(r *http.Request) (*Patch, error) {
+	mediaType := "application/json"
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(ct); err != nil {
+			return nil, errUnsupported
+		}
+	}
+	switch mediaType {
+	case "application/json", MergePatch:
+		return &Patch{body: r.Body}, nil
+	case JSONPatch:
+	default:
+		return nil, errUnsupported
+	}
+
+	var ops []operation
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		return nil, invalid("body must be an array of operations")
+	}
+	return &Patch{ops: ops}, nil
+}
+
+// Apply คืน patch ในรูป merge patch โดย current คือ resource ปัจจุบัน (ใช้เฉพาะ JSON Patch)
+func (p *Patch) Apply(current interface{}) (io.Reader, error) {
+	if p.body != nil {
+		return p.body, nil
+	}
+	var before interface{}
+	if err := remarshal(current, &before); err != nil {
+		return nil, err
+	}
+	var after interface{}
+	if err := remarshal(before, &after); err != nil {
+		return nil, err
+	}
+	for i, op := range p.ops {
+		var err error
+		if after, err = op.apply(after); err != nil {
+			message := fmt.Sprintf("operation %d: %s", i, err)
+			if errors.Is(err, errTestFailed) {
+				return nil, response.New(http.StatusConflict, response.CodePatchTestFailed, message)
+			}
+			return nil, invalid(message)
+		}
+	}
+
+	changes, err := diff(before, after)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+// errTestFailed คือ test operation ที่ไม่ผ่าน ตอบเป็น 409 แทน 400 เพราะเอกสารถูกต้องแต่ resource ไม่ตรงตามที่คาด
+var errTestFailed = errors.New("test failed")
+
+func invalid(message string) *response.Error {
+	return response.New(http.StatusBadRequest, response.CodeInvalidPatch, message)
+}
+
+// remarshal คัดลอก v ลง dst ผ่าน JSON (ตัวเลขทุกตัวเป็น float64 จึงเทียบกันด้วย reflect.DeepEqual ได้)
+func remarshal(v, dst interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// diff คืน merge patch ที่เปลี่ยน before เป็น after
+func diff(before, after interface{}) (map[string]interface{}, error) {
+	a, ok := after.(map[string]interface{})
+	if !ok {
+		return nil, invalid("the patched document must be an object")
+	}
+	b, _ := before.(map[string]interface{})
+	changes := make(map[string]interface{})
+	for k, v := range a {
+		if old, ok := b[k]; !ok || !reflect.DeepEqual(old, v) {
+			changes[k] = v
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			changes[k] = nil
+		}
+	}
+	return changes, nil
+}
+
+// operation คือ operation หนึ่งของ JSON Patch Value เป็น nil เมื่อไม่ได้ส่ง "value" มา (ต่างจาก null)
+type operation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+func (op operation) apply(doc interface{}) (interface{}, error) {
+	if op.Path == nil {
+		return nil, errors.New(`"path" is required`)
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf(`"value" is required for %s`, op.Op)
+		}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+	case "move", "copy":
+		if op.From == nil {
+			return nil, fmt.Errorf(`"from" is required for %s`, op.Op)
+		}
+	case "remove":
+	default:
+		return nil, fmt.Errorf("unknown op %q", op.Op)
+	}
+
+	switch op.Op {
+	case "add":
+		return add(doc, path, value)
+	case "remove":
+		return remove(doc, path)
+	case "replace":
+		if len(path) == 0 {
+			return value, nil
+		}
+		if doc, err = remove(doc, path); err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "test":
+		got, err := get(doc, path)
+		if err != nil || !reflect.DeepEqual(got, value) {
+			return nil, fmt.Errorf("%w at %q", errTestFailed, *op.Path)
+		}
+		return doc, nil
+	}
+
+	from, err := parsePointer(*op.From)
+	if err != nil {
+		return nil, err
+	}
+	if value, err = get(doc, from); err != nil {
+		return nil, err
+	}
+	if op.Op == "copy" {
+		var copied interface{}
+		if err := remarshal(value, &copied); err != nil {
+			return nil, err
+		}
+		return add(doc, path, copied)
+	}
+	// move ไปยังตำแหน่งภายในตัวเองไม่ได้
+	if *op.Path == *op.From {
+		return doc, nil
+	}
+	if strings.HasPrefix(*op.Path, *op.From+"/") {
+		return nil, errors.New("cannot move a value into one of its children")
+	}
+	if doc, err = remove(doc, from); err != nil {
+		return nil, err
+	}
+	return add(doc, path, value)
+}
+
+// parsePointer แยก JSON Pointer (RFC 6901) เป็น reference token โดย "" คือทั้งเอกสาร
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("path %q must start with /", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+func errPath(tokens []string) error {
+	return fmt.Errorf("path %q does not exist", "/"+strings.Join(tokens, "/"))
+}
+
+// index แปลง token เป็นตำแหน่งใน array ยาว n โดย index == n ใช้ได้เมื่อ allowEnd เท่านั้น
+func index(token string, n int, allowEnd bool) (int, bool) {
+	if token == "-" && allowEnd {
+		return n, true
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && token[0] == '0') || i > n || (i == n && !allowEnd) {
+		return 0, false
+	}
+	return i, true
+}
+
+func get(doc interface{}, tokens []string) (interface{}, error) {
+	node := doc
+	for i, t := range tokens {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			v, ok := n[t]
+			if !ok {
+				return nil, errPath(tokens[:i+1])
+			}
+			node = v
+		case []interface{}:
+			j, ok := index(t, len(n), false)
+			if !ok {
+				return nil, errPath(tokens[:i+1])
+			}
+			node = n[j]
+		default:
+			return nil, errPath(tokens[:i+1])
+		}
+	}
+	return node, nil
+}
+
+// edit เรียก fn กับ container ที่เป็นแม่ของ tokens แล้วคืนเอกสารที่แก้แล้ว (array ที่เปลี่ยนความยาวต้องถูกแทนที่ในแม่ของมัน)
+func edit(doc interface{}, tokens []string, fn func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+	switch n := doc.(type) {
+	case map[string]interface{}:
+		child, ok := n[tokens[0]]
+		if !ok {
+			return nil, errPath(tokens[:1])
+		}
+		child, err := edit(child, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[tokens[0]] = child
+		return n, nil
+	case []interface{}:
+		i, ok := index(tokens[0], len(n), false)
+		if !ok {
+			return nil, errPath(tokens[:1])
+		}
+		child, err := edit(n[i], tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+	}
+	return nil, errPath(tokens[:1])
+}
+
+func add(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return edit(doc, tokens, func(container interface{}, token string) (interface{}, error) {
+		switch n := container.(type) {
+		case map[string]interface{}:
+			n[token] = value
+			return n, nil
+		case []interface{}:
+			i, ok := index(token, len(n), true)
+			if !ok {
+				return nil, errPath(tokens)
+			}
+			return append(n[:i], append([]interface{}{value}, n[i:]...)...), nil
+		}
+		return nil, errPath(tokens)
+	})
+}
+
+func remove(doc interface{}, tokens []string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("cannot remove the whole document")
+	}
+	return edit(doc, tokens, func(container interface{}, token string) (interface{}, error) {
+		switch n := container.(type) {
+		case map[string]interface{}:
+			if _, ok := n[token]; !ok {
+				return nil, errPath(tokens)
+			}
+			delete(n, token)
+			return n, nil
+		case []interface{}:
+			i, ok := index(token, len(n), false)
+			if !ok {
+				return nil, errPath(tokens)
+			}
+			return append(n[:i], n[i+1:]...), nil
+		}
+		return nil, errPath(tokens)
+	})
+}
@@ -0,0 +1,153 @@
+package response
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// Code คือรหัสข้อผิดพลาดที่คงที่ ให้ frontend ใช้ตรวจสอบแทนการเทียบข้อความ
+type Code string
+
+const (
+	CodeInvalidRequest       Code = "INVALID_REQUEST"
+	CodeInvalidQuery         Code = "INVALID_QUERY"
+	CodeValidationFailed     Code = "VALIDATION_FAILED"
+	CodeNoFieldsToUpdate     Code = "NO_FIELDS_TO_UPDATE"
+	CodeUnsupportedMediaType Code = "UNSUPPORTED_MEDIA_TYPE"
+	CodeInvalidPatch         Code = "INVALID_PATCH"
+	CodePatchTestFailed      Code = "PATCH_TEST_FAILED"
+	CodeInvalidRole          Code = "INVALID_ROLE"
+	CodeWeakPassword         Code = "WEAK_PASSWORD"
+	CodeUnauthorized         Code = "UNAUTHORIZED"
+	CodeForbidden            Code = "FORBIDDEN"
+	CodeInvalidCredentials   Code = "INVALID_CREDENTIALS"
+	CodeTooManyAttempts      Code = "TOO_MANY_ATTEMPTS"
+	CodeAccountLocked        Code = "ACCOUNT_LOCKED"
+	CodeInvalidChallenge     Code = "INVALID_CHALLENGE"
+	CodeInvalidTwoFactorCode Code = "INVALID_TWO_FACTOR_CODE"
+	CodeTwoFactorEnabled     Code = "TWO_FACTOR_ALREADY_ENABLED"
+	CodeTwoFactorNotEnabled  Code = "TWO_FACTOR_NOT_ENABLED"
+	CodeInvalidToken         Code = "INVALID_TOKEN"
+	CodeEmailAlreadyVerified Code = "EMAIL_ALREADY_VERIFIED"
+	CodeInvalidOIDCState     Code = "INVALID_OIDC_STATE"
+	CodeOIDCLoginFailed      Code = "OIDC_LOGIN_FAILED"
+	CodeOIDCUnavailable      Code = "OIDC_PROVIDER_UNAVAILABLE"
+	CodeOIDCEmailUnverified  Code = "OIDC_EMAIL_NOT_VERIFIED"
+	CodeOIDCAccountNotFound  Code = "OIDC_ACCOUNT_NOT_FOUND"
+	CodeInvalidRefreshToken  Code = "INVALID_REFRESH_TOKEN"
+	CodeRefreshTokenExpired  Code = "REFRESH_TOKEN_EXPIRED"
+	CodeRefreshTokenReused   Code = "REFRESH_TOKEN_REUSED"
+	CodeUserNotFound         Code = "USER_NOT_FOUND"
+	CodeTeamNotFound         Code = "TEAM_NOT_FOUND"
+	CodeMemberNotFound       Code = "MEMBER_NOT_FOUND"
+	CodeTeamCycle            Code = "TEAM_CYCLE"
+	CodeConflict             Code = "CONFLICT"
+	CodeAPIKeyNotFound       Code = "API_KEY_NOT_FOUND"
+	CodeInvalidScope         Code = "INVALID_SCOPE"
+	CodeNotFound             Code = "NOT_FOUND"
+	CodeMethodNotAllowed     Code = "METHOD_NOT_ALLOWED"
+	CodeInternal             Code = "INTERNAL_ERROR"
+)
+
+// Error คือข้อผิดพลาดที่ส่งกลับไปยัง client ได้ Err คือสาเหตุภายในที่ถูก log แต่ไม่ถูกส่งออกไป
+type Error struct {
+	Status  int
+	Code    Code
+	Message string
+	Details interface{}
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return string(e.Code) + ": " + e.Message + ": " + e.Err.Error()
+	}
+	return string(e.Code) + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// WithDetails คืนสำเนาของ error พร้อมรายละเอียดเพิ่มเติม (เช่นรายการ field ที่ผิด)
+func (e *Error) WithDetails(details interface{}) *Error {
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+// New สร้าง error ที่ส่งข้อความให้ client ได้
+func New(status int, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// BadRequest คือ 400 INVALID_REQUEST
+func BadRequest(message string) *Error {
+	return New(http.StatusBadRequest, CodeInvalidRequest, message)
+}
+
+// Unauthorized คือ 401 UNAUTHORIZED
+func Unauthorized() *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, "Authentication required")
+}
+
+// Forbidden คือ 403 FORBIDDEN
+func Forbidden() *Error {
+	return New(http.StatusForbidden, CodeForbidden, "You do not have permission to perform this action")
+}
+
+// Internal ห่อ error ภายใน ข้อความจริงจะถูก log พร้อม request ID แต่ไม่ส่งให้ client
+func Internal(err error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "Internal server error", Err: err}
+}
+
+type errorBody struct {
+	Code      Code        `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// WriteError เขียน error ในรูปแบบ {"error": {"code","message","details","request_id"}}
+// error ที่ไม่ใช่ *Error ถือเป็น internal error
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = Internal(err)
+	}
+
+	requestID := RequestID(r.Context())
+	if apiErr.Status >= http.StatusInternalServerError {
+		log.Printf("request_id=%s %s %s: %v", requestID, r.Method, r.URL.Path, apiErr)
+	}
+
+	JSON(w, apiErr.Status, map[string]errorBody{
+		"error": {
+			Code:      apiErr.Code,
+			Message:   apiErr.Message,
+			Details:   apiErr.Details,
+			RequestID: requestID,
+		},
+	})
+}
+
+// JSON เขียน v เป็น JSON พร้อม status code
+func JSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+type requestIDKey struct{}
+
+// WithRequestID คืน context ที่มี request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID คืน request ID ของ context (ว่างถ้าไม่มี)
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,86 @@
+package response
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ค่า limit เริ่มต้นและสูงสุดของ endpoint ที่คืนค่าเป็นรายการ
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// Page คือข้อมูลการแบ่งหน้าแบบ offset ของรายการ
+type Page struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+	Total  int `json:"total"`
+}
+
+// Links คือลิงก์ไปยังหน้าปัจจุบัน หน้าถัดไป และหน้าก่อนหน้า (null ถ้าไม่มี)
+type Links struct {
+	Self string  `json:"self"`
+	Next *string `json:"next"`
+	Prev *string `json:"prev"`
+}
+
+// ParsePage อ่าน limit และ offset จาก query string
+func ParsePage(r *http.Request) (Page, error) {
+	page := Page{Limit: DefaultLimit}
+	q := r.URL.Query()
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxLimit {
+			return page, errors.New("limit must be between 1 and " + strconv.Itoa(MaxLimit))
+		}
+		page.Limit = n
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return page, errors.New("offset must be a non-negative integer")
+		}
+		page.Offset = n
+	}
+	return page, nil
+}
+
+// Links สร้างลิงก์ของหน้าจาก URL ของ request โดยคง query อื่น ๆ (filter, sort) ไว้
+func (p Page) Links(r *http.Request) Links {
+	links := Links{Self: pageURL(r, p.Limit, p.Offset)}
+	if p.Offset+p.Limit < p.Total {
+		next := pageURL(r, p.Limit, p.Offset+p.Limit)
+		links.Next = &next
+	}
+	if p.Offset > 0 {
+		prevOffset := p.Offset - p.Limit
+		if prevOffset < 0 {
+			prevOffset = 0
+		}
+		prev := pageURL(r, p.Limit, prevOffset)
+		links.Prev = &prev
+	}
+	return links
+}
+
+// List สร้าง envelope มาตรฐานของ endpoint ที่คืนค่าเป็นรายการ:
+// {"<key>": [...], "meta": {"limit","offset","total"}, "links": {"self","next","prev"}}
+func List(r *http.Request, key string, items interface{}, page Page) map[string]interface{} {
+	return map[string]interface{}{
+		key:     items,
+		"meta":  page,
+		"links": page.Links(r),
+	}
+}
+
+func pageURL(r *http.Request, limit, offset int) string {
+	q := r.URL.Query()
+	q.Set("limit", strconv.Itoa(limit))
+	q.Set("offset", strconv.Itoa(offset))
+	u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+	return u.String()
+}
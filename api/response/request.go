@@ -0,0 +1,15 @@
+package response
+
+import (
+	"net"
+	"net/http"
+)
+
+// ClientIP คือ IP ของผู้เรียกจาก RemoteAddr (ยังไม่เชื่อ X-Forwarded-For เพราะไม่มี proxy ที่ไว้ใจได้)
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,235 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ประเภทของผลลัพธ์การค้นหา
+const (
+	KindUser = "user"
+	KindTeam = "team"
+)
+
+// field คือข้อความหนึ่งช่องของเอกสารพร้อมน้ำหนักในการจัดอันดับ
+type field struct {
+	tokens []string
+	digits string // ตัวเลขล้วนสำหรับเบอร์โทรศัพท์
+	weight float64
+}
+
+// document คือผู้ใช้หรือทีมหนึ่งรายการใน index
+type document struct {
+	kind   string
+	id     int
+	fields []field
+	value  interface{}
+}
+
+// Index คือ index สำหรับค้นหาแบบ in-process ของผู้ใช้และทีม
+type Index struct {
+	docs []document
+}
+
+// Hit คือผลลัพธ์หนึ่งรายการ เรียงตาม Score จากมากไปน้อย
+type Hit struct {
+	Kind  string      `json:"type"`
+	ID    int         `json:"id"`
+	Score float64     `json:"score"`
+	Data  interface{} `json:"data"`
+}
+
+// น้ำหนักของแต่ละช่อง ชื่อผู้ใช้และชื่อทีมสำคัญที่สุด
+const (
+	weightUsername = 3.0
+	weightTeamName = 3.0
+	weightName     = 2.0
+	weightEmail    = 2.0
+	weightPhone    = 1.5
+	weightUserTeam = 1.0
+)
+
+// NewIndex สร้าง index จากผู้ใช้และทีมทั้งหมด
+func NewIndex(users []UserHit, teams []TeamHit) *Index {
+	idx := &Index{docs: make([]document, 0, len(users)+len(teams))}
+	for _, u := range users {
+		fields := []field{
+			{tokens: tokenize(u.Username), weight: weightUsername},
+			{tokens: tokenize(u.FirstName + " " + u.LastName), weight: weightName},
+			{tokens: append(tokenize(u.Email), strings.ToLower(u.Email)), weight: weightEmail},
+			{digits: digitsOnly(u.Phone), weight: weightPhone},
+		}
+		if u.TeamName != nil {
+			fields = append(fields, field{tokens: tokenize(*u.TeamName), weight: weightUserTeam})
+		}
+		idx.docs = append(idx.docs, document{kind: KindUser, id: u.ID, fields: fields, value: u})
+	}
+	for _, t := range teams {
+		idx.docs = append(idx.docs, document{
+			kind:   KindTeam,
+			id:     t.ID,
+			fields: []field{{tokens: tokenize(t.TeamName), weight: weightTeamName}},
+			value:  t,
+		})
+	}
+	return idx
+}
+
+// Search คืนผลลัพธ์ที่ตรงกับทุกคำใน query เรียงตามคะแนน
+func (idx *Index) Search(query string, limit int) []Hit {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return []Hit{}
+	}
+
+	hits := []Hit{}
+	for _, doc := range idx.docs {
+		total := 0.0
+		matchedAll := true
+		for _, term := range terms {
+			best := 0.0
+			for _, f := range doc.fields {
+				if s := f.score(term); s > best {
+					best = s
+				}
+			}
+			if best == 0 {
+				matchedAll = false
+				break
+			}
+			total += best
+		}
+		if matchedAll {
+			hits = append(hits, Hit{Kind: doc.kind, ID: doc.id, Score: round(total), Data: doc.value})
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].Kind != hits[j].Kind {
+			return hits[i].Kind < hits[j].Kind
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// score ให้คะแนนคำค้นหนึ่งคำกับช่องนี้: ตรงทั้งคำ > ขึ้นต้นด้วย > มีอยู่ในคำ > สะกดผิดเล็กน้อย
+func (f field) score(term string) float64 {
+	if f.digits != "" {
+		if d := digitsOnly(term); len(d) >= 3 && d == term && strings.Contains(f.digits, d) {
+			if d == f.digits {
+				return f.weight
+			}
+			return 0.8 * f.weight
+		}
+		return 0
+	}
+
+	best := 0.0
+	for _, token := range f.tokens {
+		var s float64
+		switch {
+		case token == term:
+			s = 1.0
+		case strings.HasPrefix(token, term):
+			s = 0.8
+		case len(term) >= 3 && strings.Contains(token, term):
+			s = 0.5
+		default:
+			if d := levenshtein(term, token, maxTypos(term)); d > 0 {
+				s = 0.6 - 0.15*float64(d-1)
+			} else if rt, n := []rune(token), len([]rune(term)); len(rt) > n {
+				// สะกดผิดในส่วนต้นของคำยาว เช่น "jonh" กับ "johnson" (ตัดตามตัวอักษร ไม่ใช่ byte)
+				if d := levenshtein(term, string(rt[:n]), maxTypos(term)); d > 0 {
+					s = 0.4
+				}
+			}
+		}
+		if s > best {
+			best = s
+		}
+	}
+	return best * f.weight
+}
+
+// maxTypos คือจำนวนตัวอักษรที่สะกดผิดได้ตามความยาวของคำ
+func maxTypos(term string) int {
+	switch n := len([]rune(term)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// levenshtein คืนระยะห่างแบบ optimal string alignment (นับการสลับตัวอักษรติดกันเป็น 1)
+// ระหว่าง a และ b ถ้าไม่เกิน max และมากกว่า 0 ไม่เช่นนั้นคืน 0
+func levenshtein(a, b string, max int) int {
+	if max == 0 {
+		return 0
+	}
+	ra, rb := []rune(a), []rune(b)
+	if diff := len(ra) - len(rb); diff > max || -diff > max {
+		return 0
+	}
+
+	prevPrev := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = min(curr[j], prevPrev[j-2]+1)
+			}
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > max {
+			return 0
+		}
+		prevPrev, prev, curr = prev, curr, prevPrev
+	}
+	if d := prev[len(rb)]; d <= max {
+		return d
+	}
+	return 0
+}
+
+// tokenize แยกข้อความเป็นคำตัวพิมพ์เล็ก โดยตัดที่อักขระที่ไม่ใช่ตัวอักษรหรือตัวเลข
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r)
+	})
+}
+
+func digitsOnly(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func round(v float64) float64 {
+	return float64(int(v*100+0.5)) / 100
+}
@@ -0,0 +1,130 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"golang-backend/api/response"
+	"golang-backend/repository"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UserHit คือข้อมูลผู้ใช้ที่คืนในผลการค้นหา
+type UserHit struct {
+	ID        int     `json:"id"`
+	Username  string  `json:"username"`
+	FirstName string  `json:"firstname"`
+	LastName  string  `json:"lastname"`
+	Email     string  `json:"email"`
+	Phone     string  `json:"phone"`
+	Role      string  `json:"role"`
+	TeamId    *int    `json:"team_id"`
+	TeamName  *string `json:"team_name"`
+}
+
+// TeamHit คือข้อมูลทีมที่คืนในผลการค้นหา
+type TeamHit struct {
+	ID           int    `json:"team_id"`
+	TeamName     string `json:"team_name"`
+	ParentTeamID *int   `json:"parent_team_id"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// index ถูกสร้างใหม่จาก repository เมื่อเก่ากว่า indexTTL
+const indexTTL = 30 * time.Second
+
+// Handler ให้บริการ /api/search จาก index ที่ cache ไว้
+type Handler struct {
+	users repository.UserRepository
+	teams repository.TeamRepository
+
+	mu      sync.Mutex
+	index   *Index
+	builtAt time.Time
+}
+
+func NewHandler(users repository.UserRepository, teams repository.TeamRepository) *Handler {
+	return &Handler{users: users, teams: teams}
+}
+
+func (h *Handler) currentIndex(ctx context.Context) (*Index, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.index != nil && time.Since(h.builtAt) < indexTTL {
+		return h.index, nil
+	}
+	idx, err := h.loadIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	h.index, h.builtAt = idx, time.Now()
+	return idx, nil
+}
+
+func (h *Handler) loadIndex(ctx context.Context) (*Index, error) {
+	allUsers, _, err := h.users.List(ctx, repository.UserFilter{})
+	if err != nil {
+		return nil, err
+	}
+	users := make([]UserHit, 0, len(allUsers))
+	for _, u := range allUsers {
+		users = append(users, UserHit{
+			ID: u.ID, Username: u.Username, FirstName: u.FirstName, LastName: u.LastName,
+			Email: u.Email, Phone: u.Phone, Role: u.Role, TeamId: u.TeamId, TeamName: u.TeamName,
+		})
+	}
+
+	allTeams, err := h.teams.List(ctx, repository.TeamFilter{})
+	if err != nil {
+		return nil, err
+	}
+	teams := make([]TeamHit, 0, len(allTeams))
+	for _, t := range allTeams {
+		teams = append(teams, TeamHit{ID: t.ID, TeamName: t.TeamName, ParentTeamID: t.ParentTeamID, CreatedAt: t.CreatedAt})
+	}
+	return NewIndex(users, teams), nil
+}
+
+// Search godoc
+// @Summary Search users and teams
+// @Description Ranked, typo-tolerant search over usernames, names, emails, phone numbers and team names
+// @Tags search
+// @Produce  json
+// @Param q query string true "Search text"
+// @Param limit query int false "Maximum number of results (1-100, default 20)"
+// @Router /search [get]
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		response.WriteError(w, r, response.BadRequest("q is required"))
+		return
+	}
+
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			response.WriteError(w, r, response.BadRequest("limit must be between 1 and 100"))
+			return
+		}
+		limit = n
+	}
+
+	idx, err := h.currentIndex(r.Context())
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"query":   query,
+		"results": idx.Search(query, limit),
+	})
+}
@@ -0,0 +1,180 @@
+package teams
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"golang-backend/api/audit"
+	"golang-backend/api/response"
+	"golang-backend/models"
+	"golang-backend/repository"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// requireTeam ตอบ 404 ถ้าไม่มีทีม team_id ใน URL และคืน team ID
+func (h *Handler) requireTeam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	teamID, ok := teamIDParam(w, r, "team_id")
+	if !ok {
+		return 0, false
+	}
+	_, err := h.teams.GetByID(r.Context(), teamID)
+	if errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, errTeamNotFound)
+		return 0, false
+	}
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return 0, false
+	}
+	return teamID, true
+}
+
+// GetTeamMembers godoc
+// @Summary List team members
+// @Description List every member of a team with their role in the team
+// @Tags teams
+// @Produce  json
+// @Param team_id path int true "Team ID"
+// @Success 200 {array} models.TeamMember
+// @Router /teams/{team_id}/members [get]
+func (h *Handler) GetTeamMembers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	teamID, ok := h.requireTeam(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := h.members.ListByTeam(r.Context(), teamID)
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"members": members})
+}
+
+// AddTeamMember godoc
+// @Summary Add a user to a team
+// @Description Add a user to a team with role lead, member (default) or observer. Changes the role if the user is already a member.
+// @Tags teams
+// @Accept  json
+// @Produce  json
+// @Param team_id path int true "Team ID"
+// @Param user_id path int true "User ID"
+// @Success 201 {object} models.TeamMember
+// @Router /teams/{team_id}/members/{user_id} [post]
+func (h *Handler) AddTeamMember(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	teamID, ok := h.requireTeam(w, r)
+	if !ok {
+		return
+	}
+	userID, err := strconv.Atoi(mux.Vars(r)["user_id"])
+	if err != nil {
+		response.WriteError(w, r, response.BadRequest("Invalid user ID"))
+		return
+	}
+
+	// body ไม่บังคับ ถ้าไม่ระบุ role จะเป็น member
+	var body struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		response.WriteError(w, r, response.BadRequest("Invalid request payload"))
+		return
+	}
+	if body.Role == "" {
+		body.Role = models.MemberRoleMember
+	}
+	if !models.ValidMemberRole(body.Role) {
+		response.WriteError(w, r, response.New(http.StatusBadRequest, response.CodeInvalidRole, "role must be one of lead, member, observer"))
+		return
+	}
+
+	var created bool
+	var member models.TeamMember
+	err = h.audit.Tx(r.Context(), func(ctx context.Context) error {
+		// before เป็น nil เมื่อผู้ใช้ยังไม่เป็นสมาชิก
+		var before interface{}
+		if existing, err := h.members.Get(ctx, teamID, userID); err == nil {
+			before = existing
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		var err error
+		if created, err = h.members.Add(ctx, teamID, userID, body.Role); err != nil {
+			return err
+		}
+		if member, err = h.members.Get(ctx, teamID, userID); err != nil {
+			return err
+		}
+		return h.audit.Record(ctx, r, audit.ActionTeamMemberAdd, audit.EntityTeam, teamID, audit.Diff(before, member))
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		// ทีมถูกตรวจสอบแล้ว จึงเหลือกรณีไม่มีผู้ใช้
+		response.WriteError(w, r, errUserNotFound)
+		return
+	}
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"member": member})
+}
+
+// RemoveTeamMember godoc
+// @Summary Remove a user from a team
+// @Tags teams
+// @Produce  json
+// @Param team_id path int true "Team ID"
+// @Param user_id path int true "User ID"
+// @Success 200 {object} map[string]string
+// @Router /teams/{team_id}/members/{user_id} [delete]
+func (h *Handler) RemoveTeamMember(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	teamID, ok := h.requireTeam(w, r)
+	if !ok {
+		return
+	}
+	userID, err := strconv.Atoi(mux.Vars(r)["user_id"])
+	if err != nil {
+		response.WriteError(w, r, response.BadRequest("Invalid user ID"))
+		return
+	}
+
+	err = h.audit.Tx(r.Context(), func(ctx context.Context) error {
+		before, err := h.members.Get(ctx, teamID, userID)
+		if err != nil {
+			return err
+		}
+		if err := h.members.Remove(ctx, teamID, userID); err != nil {
+			return err
+		}
+		return h.audit.Record(ctx, r, audit.ActionTeamMemberRemove, audit.EntityTeam, teamID, audit.Diff(before, nil))
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, errMemberNotFound)
+		return
+	}
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Member removed successfully"})
+}
@@ -0,0 +1,48 @@
+package teams
+
+import (
+	"context"
+	"golang-backend/api/response"
+	"golang-backend/api/validate"
+	"golang-backend/repository"
+	"io"
+	"net/http"
+)
+
+// createTeamRequest คือ body ของ POST /api/teams
+type createTeamRequest struct {
+	TeamName     string `json:"team_name" validate:"required,max=255"`
+	ParentTeamID *int   `json:"parent_team_id"`
+}
+
+// patchTeamRequest คือ body ของ PATCH /api/teams/{team_id} ทุก field ไม่บังคับ
+type patchTeamRequest struct {
+	TeamName     *string                `json:"team_name" validate:"required,max=255"`
+	ParentTeamID validate.Optional[int] `json:"parent_team_id"`
+}
+
+// decodePatch แปลง patch ที่ apply แล้วเป็นการแก้ไขทีม พร้อมตรวจว่าทีมแม่ที่ระบุมีอยู่จริง
+func (h *Handler) decodePatch(ctx context.Context, doc io.Reader) (repository.TeamUpdate, error) {
+	var body patchTeamRequest
+	errs, err := validate.DecodePatch(doc, &body)
+	if err != nil {
+		return repository.TeamUpdate{}, err
+	}
+	update := repository.TeamUpdate{
+		TeamName:     body.TeamName,
+		SetParent:    body.ParentTeamID.Set,
+		ParentTeamID: body.ParentTeamID.Value,
+	}
+	if update.ParentTeamID != nil {
+		if err := h.checkParent(ctx, *update.ParentTeamID, &errs); err != nil {
+			return update, err
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return update, err
+	}
+	if update.Empty() {
+		return update, response.New(http.StatusBadRequest, response.CodeNoFieldsToUpdate, "No valid fields to update")
+	}
+	return update, nil
+}
@@ -1,136 +1,134 @@
 package teams
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
-	"fmt"
-	"golang-backend/database"
+	"errors"
+	"golang-backend/api/audit"
+	"golang-backend/api/patch"
+	"golang-backend/api/response"
+	"golang-backend/api/validate"
+	"golang-backend/middleware"
+	"golang-backend/models"
+	"golang-backend/repository"
 	"net/http"
-	"strings"
-	"time"
+	"slices"
+	"strconv"
 
 	"github.com/gorilla/mux"
 )
 
-// User struct สำหรับจัดการข้อมูลผู้ใช้
-type Teams struct {
-	ID        int    `json:"team_id"`
-	TeamName  string `json:"team_name"`
-	CreatedAt string `json:"created_at"`
+// Teams struct สำหรับจัดการข้อมูลทีม
+type Teams = models.Team
+
+// Handler รวม handler ของ /api/teams โดยเข้าถึงข้อมูลผ่าน repository
+type Handler struct {
+	teams   repository.TeamRepository
+	members repository.TeamMemberRepository
+	audit   *audit.Log
 }
 
-// ฟังก์ชันสำหรับ hash รหัสผ่าน
+func NewHandler(teams repository.TeamRepository, members repository.TeamMemberRepository, auditLog *audit.Log) *Handler {
+	return &Handler{teams: teams, members: members, audit: auditLog}
+}
 
-// GetUsers godoc
-// @Summary Get all users
-// @Description Get details of all users
-// @Tags users
+var (
+	errTeamNotFound   = response.New(http.StatusNotFound, response.CodeTeamNotFound, "Team not found")
+	errUserNotFound   = response.New(http.StatusNotFound, response.CodeUserNotFound, "User not found")
+	errMemberNotFound = response.New(http.StatusNotFound, response.CodeMemberNotFound, "User is not a member of this team")
+)
+
+// GetTeams godoc
+// @Summary Get all teams
+// @Description Get details of all teams
+// @Tags teams
 // @Accept  json
 // @Produce  json
-// @Success 200 {array} User
-// @Router /users [get]
-func GetTeams(w http.ResponseWriter, r *http.Request) {
+// @Param include_deleted query bool false "Include soft-deleted teams (requires teams:delete)"
+// @Success 200 {array} Teams
+// @Router /teams [get]
+func (h *Handler) GetTeams(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// ปรับปรุง SQL Query เพื่อทำการ JOIN ข้อมูลจาก teams
-	query := `
-		SELECT team_id, team_name, created_at from teams
-	`
-
-	stmt, err := database.DB.Prepare(query)
-	if err != nil {
-		http.Error(w, "Query preparation error: "+err.Error(), http.StatusInternalServerError)
-		return
+	var filter repository.TeamFilter
+	if v := r.URL.Query().Get("include_deleted"); v != "" {
+		include, err := strconv.ParseBool(v)
+		if err != nil {
+			response.WriteError(w, r, response.New(http.StatusBadRequest, response.CodeInvalidQuery, "include_deleted must be true or false"))
+			return
+		}
+		// ทีมที่ถูกลบเห็นได้เฉพาะผู้ที่ลบและกู้คืนทีมได้
+		if include && !middleware.Can(r, middleware.PermTeamsDelete) {
+			response.WriteError(w, r, response.Forbidden())
+			return
+		}
+		filter.IncludeDeleted = include
 	}
-	defer stmt.Close()
 
-	rows, err := stmt.Query() // ใช้ stmt.Query() แทน database.DB.Query()
+	teams, err := h.teams.List(r.Context(), filter)
 	if err != nil {
-		http.Error(w, "Query execution error: "+err.Error(), http.StatusInternalServerError)
+		response.WriteError(w, r, response.Internal(err))
 		return
 	}
 
-	var teams []Teams
-	for rows.Next() {
-		var team Teams
-		// ดึงข้อมูลจากทั้งตาราง users และ teams
-		if err := rows.Scan(&team.ID, &team.TeamName, &team.CreatedAt); err != nil {
-			http.Error(w, "Error scanning row: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		teams = append(teams, team)
-	}
-
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{"teams": teams})
 }
 
-func CreateTeam(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateTeam(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	var team Teams
-	if err := json.NewDecoder(r.Body).Decode(&team); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	var body createTeamRequest
+	errs, err := validate.Decode(r.Body, &body)
+	if err != nil {
+		response.WriteError(w, r, err)
 		return
 	}
-	if team.TeamName == "" {
-		http.Error(w, "Team Name is required", http.StatusBadRequest)
-		return
+	if body.ParentTeamID != nil {
+		if err := h.checkParent(r.Context(), *body.ParentTeamID, &errs); err != nil {
+			response.WriteError(w, r, response.Internal(err))
+			return
+		}
 	}
-
-	// สร้าง Prepared Statement สำหรับการแทรกข้อมูล
-	stmt, err := database.DB.Prepare(`INSERT INTO teams (team_name, created_at) VALUES (?, NOW())`)
-	if err != nil {
-		http.Error(w, "Query preparation error: "+err.Error(), http.StatusInternalServerError)
+	if err := errs.Err(); err != nil {
+		response.WriteError(w, r, err)
 		return
 	}
-	defer stmt.Close() // ปิด Prepared Statement หลังการใช้งาน
 
-	// Execute the query with the team name
-	_, err = stmt.Exec(team.TeamName)
+	// บันทึกทีมใหม่ repository จะกำหนด team_id และ created_at ให้
+	team := Teams{TeamName: body.TeamName, ParentTeamID: body.ParentTeamID}
+	err = h.audit.Tx(r.Context(), func(ctx context.Context) error {
+		if err := h.teams.Create(ctx, &team); err != nil {
+			return err
+		}
+		return h.audit.Record(ctx, r, audit.ActionTeamCreate, audit.EntityTeam, team.ID, audit.Diff(nil, team))
+	})
 	if err != nil {
-		http.Error(w, "Error creating teams: "+err.Error(), http.StatusInternalServerError)
-		fmt.Println("Database exec error:", err)
+		response.WriteError(w, r, validate.Conflict(err))
 		return
 	}
 
-	// Retrieve the created_at value to include in the response
-	team.CreatedAt = time.Now().Format("2006-01-02 15:04:05") // Example format for MySQL-compatible databases
-
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(team)
 }
 
-func GetTeamById(w http.ResponseWriter, r *http.Request) {
-	// Extract the ID from the URL using mux.Vars
-	vars := mux.Vars(r)
-	id := vars["id"]
+func (h *Handler) GetTeamById(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
 
-	// Validate the ID format (optional but recommended)
-	if id == "" {
-		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+	// Extract the ID from the URL using mux.Vars
+	id, ok := teamIDParam(w, r, "id")
+	if !ok {
 		return
 	}
 
-	// Prepare the SQL query to prevent SQL injection
-	query := "SELECT team_id, team_name, created_at FROM teams WHERE team_id = ?"
-	stmt, err := database.DB.Prepare(query)
-	if err != nil {
-		http.Error(w, "Query preparation error: "+err.Error(), http.StatusInternalServerError)
+	// Query the team by ID
+	team, err := h.teams.GetByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, errTeamNotFound)
 		return
 	}
-	defer stmt.Close() // Ensure the statement is closed after execution
-
-	// Query the team by ID from the database
-	var team Teams
-	err = stmt.QueryRow(id).Scan(&team.ID, &team.TeamName, &team.CreatedAt)
-
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Team not found", http.StatusNotFound)
-		} else {
-			http.Error(w, "Error fetching team: "+err.Error(), http.StatusInternalServerError)
-		}
+		response.WriteError(w, r, response.Internal(err))
 		return
 	}
 
@@ -139,45 +137,32 @@ func GetTeamById(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{"team": team})
 }
 
-func DeleteTeamById(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteTeamById(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Extract the team ID from the URL
-	vars := mux.Vars(r)
-	teamID := vars["team_id"]
-
-	// Validate the team ID format (optional but recommended)
-	if teamID == "" {
-		http.Error(w, "Invalid team ID", http.StatusBadRequest)
+	teamID, ok := teamIDParam(w, r, "team_id")
+	if !ok {
 		return
 	}
 
-	// Prepare the delete query to prevent SQL injection
-	query := "DELETE FROM teams WHERE team_id = ?"
-	stmt, err := database.DB.Prepare(query)
-	if err != nil {
-		http.Error(w, "Query preparation error: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	defer stmt.Close() // Ensure the statement is closed after execution
-
-	// Execute the delete query
-	result, err := stmt.Exec(teamID)
-	if err != nil {
-		http.Error(w, "Error deleting team: "+err.Error(), http.StatusInternalServerError)
+	// soft delete: สมาชิกและทีมย่อยยังอ้างถึงทีมนี้ จนกว่าจะถูก purge หลังพ้นระยะเวลาเก็บรักษา
+	err := h.audit.Tx(r.Context(), func(ctx context.Context) error {
+		before, err := h.teams.GetByID(ctx, teamID)
+		if err != nil {
+			return err
+		}
+		if err := h.teams.Delete(ctx, teamID); err != nil {
+			return err
+		}
+		return h.audit.Record(ctx, r, audit.ActionTeamDelete, audit.EntityTeam, teamID, audit.Diff(before, nil))
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, errTeamNotFound)
 		return
 	}
-
-	// Check if any rows were affected (if the team was deleted)
-	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		http.Error(w, "Error checking rows affected: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// If no rows were affected, the team was not found
-	if rowsAffected == 0 {
-		http.Error(w, "Team not found", http.StatusNotFound)
+		response.WriteError(w, r, response.Internal(err))
 		return
 	}
 
@@ -186,54 +171,126 @@ func DeleteTeamById(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"message": "Team deleted successfully"})
 }
 
-func PatchTeam(w http.ResponseWriter, r *http.Request) {
+// PatchTeam godoc
+// @Summary Update a team
+// @Description Update a team with a JSON Merge Patch (application/merge-patch+json or application/json) or a JSON Patch (application/json-patch+json, applied to the team as returned by GET, including test operations). Unknown or read-only fields are rejected, parent_team_id can be cleared with null and the updated team is returned.
+// @Tags teams
+// @Accept  json
+// @Produce  json
+// @Param team_id path int true "Team ID"
+// @Success 200 {object} Teams
+// @Failure 400 {object} map[string]string{"error": "Invalid patch"}
+// @Failure 409 {object} map[string]string{"error": "Test operation failed, name taken or cycle"}
+// @Failure 415 {object} map[string]string{"error": "Unsupported Content-Type"}
+// @Failure 422 {object} map[string]string{"error": "Validation failed"}
+// @Router /teams/{team_id} [patch]
+func (h *Handler) PatchTeam(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Accept-Patch", patch.Accepted)
 
 	// Get the team ID from the request URL (assuming team ID is passed as a URL parameter)
-	vars := mux.Vars(r)
-	teamId := vars["team_id"]
-
-	var teamUpdate map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&teamUpdate); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	teamId, ok := teamIDParam(w, r, "team_id")
+	if !ok {
 		return
 	}
 
-	// Start building the SQL query dynamically based on the fields that are updated
-	query := "UPDATE teams SET"
-	params := []interface{}{}
-	setClauses := []string{}
-
-	// Check for fields to update and add them to the query
-	if teamName, ok := teamUpdate["team_name"]; ok {
-		setClauses = append(setClauses, "team_name = ?")
-		params = append(params, teamName)
+	p, err := patch.Parse(r)
+	if err != nil {
+		response.WriteError(w, r, err)
+		return
 	}
 
-	if len(setClauses) == 0 {
-		http.Error(w, "No valid fields to update", http.StatusBadRequest)
+	var after Teams
+	err = h.audit.Tx(r.Context(), func(ctx context.Context) error {
+		// lock ทีมไว้ก่อน apply patch เพื่อให้ test operation ตรวจกับค่าที่จะถูกแก้จริง
+		before, err := h.teams.GetForUpdate(ctx, teamId)
+		if err != nil {
+			return err
+		}
+		doc, err := p.Apply(before)
+		if err != nil {
+			return err
+		}
+		update, err := h.decodePatch(ctx, doc)
+		if err != nil {
+			return err
+		}
+		if update.ParentTeamID != nil {
+			// ตรวจภายใน transaction โดย lock สายทีมแม่ไว้ เพื่อไม่ให้การย้ายสองทีมสลับกันพร้อมกันสร้าง cycle
+			ancestors, err := h.teams.LockAncestors(ctx, *update.ParentTeamID)
+			if err != nil {
+				return err
+			}
+			if slices.Contains(ancestors, teamId) {
+				return errTeamCycle
+			}
+		}
+		if err := h.teams.Update(ctx, teamId, update); err != nil {
+			return err
+		}
+		if after, err = h.teams.GetByID(ctx, teamId); err != nil {
+			return err
+		}
+		return h.audit.Record(ctx, r, audit.ActionTeamUpdate, audit.EntityTeam, teamId, audit.Diff(before, after))
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, errTeamNotFound)
+		return
+	}
+	if err != nil {
+		response.WriteError(w, r, validate.Conflict(err))
 		return
 	}
 
-	// Join the SET clauses and complete the SQL query
-	query += " " + strings.Join(setClauses, ", ") + " WHERE team_id = ?"
-	params = append(params, teamId)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(after)
+}
 
-	// Prepare the SQL statement
-	stmt, err := database.DB.Prepare(query)
-	if err != nil {
-		http.Error(w, "Query preparation error: "+err.Error(), http.StatusInternalServerError)
+// RestoreTeam godoc
+// @Summary Restore a deleted team
+// @Description Undo a soft delete before the team is purged
+// @Tags teams
+// @Produce  json
+// @Param id path int true "Team ID"
+// @Success 200 {object} Teams
+// @Router /teams/{id}/restore [post]
+func (h *Handler) RestoreTeam(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := teamIDParam(w, r, "id")
+	if !ok {
 		return
 	}
-	defer stmt.Close() // Ensure the statement is closed after execution
 
-	// Execute the query
-	_, err = stmt.Exec(params...)
+	var team Teams
+	err := h.audit.Tx(r.Context(), func(ctx context.Context) error {
+		if err := h.teams.Restore(ctx, id); err != nil {
+			return err
+		}
+		var err error
+		if team, err = h.teams.GetByID(ctx, id); err != nil {
+			return err
+		}
+		return h.audit.Record(ctx, r, audit.ActionTeamRestore, audit.EntityTeam, id, audit.Diff(nil, team))
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, response.New(http.StatusNotFound, response.CodeTeamNotFound, "No deleted team with this ID"))
+		return
+	}
 	if err != nil {
-		http.Error(w, "Error updating teams: "+err.Error(), http.StatusInternalServerError)
+		response.WriteError(w, r, validate.Conflict(err))
 		return
 	}
-
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Team updated successfully"})
+	json.NewEncoder(w).Encode(team)
+}
+
+// teamIDParam อ่าน team ID จาก URL variable และตอบ 400 ถ้าไม่ใช่ตัวเลข
+func teamIDParam(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)[name])
+	if err != nil {
+		response.WriteError(w, r, response.BadRequest("Invalid team ID"))
+		return 0, false
+	}
+	return id, true
 }
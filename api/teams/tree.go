@@ -0,0 +1,112 @@
+package teams
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"golang-backend/api/response"
+	"golang-backend/api/validate"
+	"golang-backend/models"
+	"golang-backend/repository"
+	"net/http"
+)
+
+// GetTeamTree godoc
+// @Summary Get the org tree
+// @Description Get every team nested under its parent team
+// @Tags teams
+// @Produce  json
+// @Success 200 {array} models.TeamNode
+// @Router /teams/tree [get]
+func (h *Handler) GetTeamTree(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	teams, err := h.teams.List(r.Context(), repository.TeamFilter{})
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"teams": buildTree(teams)})
+}
+
+// buildTree จัดทีมเป็น tree ตาม parent_team_id ทีมที่ไม่มีทีมแม่ (หรือทีมแม่ไม่อยู่ในรายการ) เป็น root
+func buildTree(teams []models.Team) []*models.TeamNode {
+	nodes := make(map[int]*models.TeamNode, len(teams))
+	for _, team := range teams {
+		nodes[team.ID] = &models.TeamNode{Team: team, Children: []*models.TeamNode{}}
+	}
+
+	roots := []*models.TeamNode{}
+	for _, team := range teams {
+		node := nodes[team.ID]
+		if team.ParentTeamID != nil {
+			if parent, ok := nodes[*team.ParentTeamID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	return roots
+}
+
+// GetTeamAncestors godoc
+// @Summary Get a team's ancestors
+// @Description Get every parent team, from the top-level team down to the direct parent
+// @Tags teams
+// @Produce  json
+// @Param id path int true "Team ID"
+// @Success 200 {array} Teams
+// @Router /teams/{id}/ancestors [get]
+func (h *Handler) GetTeamAncestors(w http.ResponseWriter, r *http.Request) {
+	h.writeRelatives(w, r, h.teams.Ancestors)
+}
+
+// GetTeamDescendants godoc
+// @Summary Get a team's descendants
+// @Description Get every sub-team at any depth, ordered by depth
+// @Tags teams
+// @Produce  json
+// @Param id path int true "Team ID"
+// @Success 200 {array} Teams
+// @Router /teams/{id}/descendants [get]
+func (h *Handler) GetTeamDescendants(w http.ResponseWriter, r *http.Request) {
+	h.writeRelatives(w, r, h.teams.Descendants)
+}
+
+func (h *Handler) writeRelatives(w http.ResponseWriter, r *http.Request, load func(ctx context.Context, id int) ([]models.Team, error)) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := teamIDParam(w, r, "id")
+	if !ok {
+		return
+	}
+
+	teams, err := load(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, errTeamNotFound)
+		return
+	}
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"teams": teams})
+}
+
+// checkParent เพิ่มข้อผิดพลาดของ parent_team_id ถ้าไม่มีทีมที่จะใช้เป็นทีมแม่
+func (h *Handler) checkParent(ctx context.Context, parentID int, errs *validate.Errors) error {
+	_, err := h.teams.GetByID(ctx, parentID)
+	if errors.Is(err, repository.ErrNotFound) {
+		errs.Add("parent_team_id", validate.CodeNotFound, "team does not exist")
+		return nil
+	}
+	return err
+}
+
+// errTeamCycle คือการย้ายทีมไปอยู่ใต้ตัวเองหรือทีมย่อยของตัวเอง ซึ่งจะทำให้ tree วน
+var errTeamCycle = response.New(http.StatusConflict, response.CodeTeamCycle, "A team cannot be moved under itself or one of its sub-teams")
@@ -0,0 +1,158 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"golang-backend/api/response"
+	"golang-backend/api/validate"
+	"golang-backend/middleware"
+	"golang-backend/repository"
+	"io"
+	"net/http"
+)
+
+// createUserRequest คือ body ของ POST /api/users
+type createUserRequest struct {
+	Username  string `json:"username" validate:"required,username"`
+	Password  string `json:"password" validate:"required"`
+	Email     string `json:"email" validate:"required,email,max=255"`
+	FirstName string `json:"firstname" validate:"max=100"`
+	LastName  string `json:"lastname" validate:"max=100"`
+	Phone     string `json:"phone" validate:"omitempty,phone"`
+	Role      string `json:"role" validate:"omitempty,role"`
+	TeamID    *int   `json:"team_id"`
+}
+
+// user คืนผู้ใช้ใหม่จาก request โดย role เริ่มต้นคือ member
+func (req createUserRequest) user() User {
+	role := req.Role
+	if role == "" {
+		role = string(middleware.RoleMember)
+	}
+	return User{
+		Username:  req.Username,
+		Password:  req.Password,
+		Email:     req.Email,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Phone:     req.Phone,
+		Role:      role,
+		TeamId:    req.TeamID,
+	}
+}
+
+// patchUserRequest คือ body ของ PATCH /api/users/{id} และ PATCH /api/me ทุก field ไม่บังคับ
+type patchUserRequest struct {
+	Username  *string                `json:"username" validate:"username"`
+	FirstName *string                `json:"firstname" validate:"max=100"`
+	LastName  *string                `json:"lastname" validate:"max=100"`
+	Email     *string                `json:"email" validate:"email,max=255"`
+	Phone     *string                `json:"phone" validate:"omitempty,phone"`
+	Role      *string                `json:"role" validate:"role"`
+	Password  *string                `json:"password" validate:"required"`
+	TeamID    validate.Optional[int] `json:"team_id"`
+	// CurrentPassword ต้องส่งมาเมื่อผู้ใช้เปลี่ยนรหัสผ่านของตัวเอง ไม่ถูกบันทึก
+	CurrentPassword *string `json:"current_password"`
+}
+
+// update คืนการแก้ไขที่ยังไม่รวมรหัสผ่าน (ต้อง hash ก่อน)
+func (req patchUserRequest) update() repository.UserUpdate {
+	return repository.UserUpdate{
+		Username:  req.Username,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Email:     req.Email,
+		Phone:     req.Phone,
+		Role:      req.Role,
+		SetTeam:   req.TeamID.Set,
+		TeamID:    req.TeamID.Value,
+	}
+}
+
+// checkTeam เพิ่มข้อผิดพลาดของ team_id ถ้าไม่มีทีม teamID
+func (h *Handler) checkTeam(ctx context.Context, teamID int, errs *validate.Errors) error {
+	_, err := h.teams.GetByID(ctx, teamID)
+	if errors.Is(err, repository.ErrNotFound) {
+		errs.Add("team_id", validate.CodeNotFound, "team does not exist")
+		return nil
+	}
+	return err
+}
+
+// decodePatch แปลง patch ที่ apply แล้วเป็นการแก้ไขผู้ใช้ before ตรวจสิทธิ์ของ field ที่แก้
+// และตรวจรหัสผ่านใหม่ตามนโยบายก่อน hash
+func (h *Handler) decodePatch(ctx context.Context, r *http.Request, doc io.Reader, before User) (repository.UserUpdate, error) {
+	var body patchUserRequest
+	errs, err := validate.DecodePatch(doc, &body)
+	if err != nil {
+		return repository.UserUpdate{}, err
+	}
+	update := body.update()
+	// การเปลี่ยน role ต้องเป็นผู้มีสิทธิ์ assign role เท่านั้น (กันการยกระดับสิทธิ์ตัวเอง)
+	if update.Role != nil && !middleware.Can(r, middleware.PermUsersAssignRole) {
+		return update, response.Forbidden()
+	}
+	// การย้ายทีมทำได้เฉพาะผู้ที่แก้ไขผู้ใช้คนอื่นได้
+	if update.SetTeam && !middleware.Can(r, middleware.PermUsersUpdate) {
+		return update, response.Forbidden()
+	}
+	if update.TeamID != nil {
+		if err := h.checkTeam(ctx, *update.TeamID, &errs); err != nil {
+			return update, err
+		}
+	}
+	// ผู้ใช้ที่เปลี่ยนรหัสผ่านของตัวเองต้องยืนยันรหัสผ่านเดิม เพื่อไม่ให้ access token ที่รั่วยึดบัญชีได้
+	// ผู้ดูแลที่เปลี่ยนรหัสผ่านของผู้ใช้อื่นไม่ต้องยืนยัน
+	principal, ok := middleware.CurrentPrincipal(r)
+	self := ok && principal.UserID == before.ID
+	if body.Password != nil && self && body.CurrentPassword == nil {
+		errs.Add("current_password", validate.CodeRequired, "is required")
+	}
+	if err := errs.Err(); err != nil {
+		return update, err
+	}
+	if body.Password != nil && self {
+		if err := h.checkCurrentPassword(ctx, before, *body.CurrentPassword); err != nil {
+			return update, err
+		}
+	}
+	if update.Empty() && body.Password == nil {
+		return update, response.New(http.StatusBadRequest, response.CodeNoFieldsToUpdate, "No valid fields to update")
+	}
+	if body.Password != nil {
+		// เทียบกับ username และอีเมลที่จะใช้หลังแก้ไข และ hash หลังผ่านนโยบายแล้วเท่านั้น
+		username, email := before.Username, before.Email
+		if update.Username != nil {
+			username = *update.Username
+		}
+		if update.Email != nil {
+			email = *update.Email
+		}
+		if err := h.passwords.Validate(*body.Password, username, email); err != nil {
+			return update, err
+		}
+		hash, err := h.passwords.Hash(*body.Password)
+		if err != nil {
+			return update, err
+		}
+		update.PasswordHash = &hash
+	}
+	return update, nil
+}
+
+var errWrongPassword = response.New(http.StatusForbidden, response.CodeInvalidCredentials, "Current password is incorrect")
+
+// checkCurrentPassword ตอบ 403 ถ้า password ไม่ใช่รหัสผ่านปัจจุบันของ user
+func (h *Handler) checkCurrentPassword(ctx context.Context, user User, password string) error {
+	stored, err := h.users.GetByIdentifier(ctx, user.Username)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && stored.ID != user.ID) {
+		return errWrongPassword
+	}
+	if err != nil {
+		return err
+	}
+	if ok, _ := h.passwords.Check(password, stored.Password); !ok {
+		return errWrongPassword
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"golang-backend/api/audit"
+	"golang-backend/api/login"
+	"golang-backend/api/response"
+	"golang-backend/middleware"
+	"net/http"
+)
+
+var (
+	errTwoFactorEnabled     = response.New(http.StatusConflict, response.CodeTwoFactorEnabled, "Two-factor authentication is already enabled")
+	errTwoFactorNotEnabled  = response.New(http.StatusConflict, response.CodeTwoFactorNotEnabled, "Two-factor authentication is not enabled")
+	errInvalidTwoFactorCode = response.New(http.StatusBadRequest, response.CodeInvalidTwoFactorCode, "Invalid two-factor code")
+)
+
+// decodeCode อ่าน {"code": "..."} จาก body
+func decodeCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Code == "" {
+		response.WriteError(w, r, response.BadRequest("code is required"))
+		return "", false
+	}
+	return body.Code, true
+}
+
+// throttled ตอบ 429 (หรือ 423 ถ้าบัญชีถูกล็อก) และคืน true ถ้าผู้ใช้ id ต้องรอก่อนลองรหัส 2FA ใหม่
+// การเดารหัสถูกนับรวมกับการเดารหัสผ่านและรหัส 2FA ตอน login ของบัญชีเดียวกัน เหมือน /auth/2fa
+func (h *Handler) throttled(w http.ResponseWriter, r *http.Request, id int) bool {
+	wait, locked, err := h.throttle.Check(r.Context(), login.AccountKey(id), login.IPKey(response.ClientIP(r)))
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return true
+	}
+	if wait > 0 {
+		login.WriteThrottled(w, r, wait, locked)
+		return true
+	}
+	return false
+}
+
+// countCode บันทึกผลการตรวจรหัส 2FA หลัง transaction จบแล้ว (transaction ที่ล้มเหลวถูก rollback ทั้งหมด)
+// err คือผลของ transaction
+func (h *Handler) countCode(r *http.Request, id int, err error) error {
+	switch {
+	case errors.Is(err, errInvalidTwoFactorCode):
+		return h.throttle.Fail(r.Context(), login.AccountKey(id), login.IPKey(response.ClientIP(r)))
+	case err == nil:
+		return h.throttle.Succeed(r.Context(), login.AccountKey(id))
+	}
+	return nil
+}
+
+// EnrollTwoFactor godoc
+// @Summary Start TOTP enrollment
+// @Description Generate a new TOTP secret for the caller. 2FA is not active until the first code is verified.
+// @Tags me
+// @Produce  json
+// @Success 200 {object} map[string]string
+// @Router /me/2fa/enroll [post]
+func (h *Handler) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	principal, ok := middleware.CurrentPrincipal(r)
+	if !ok {
+		response.WriteError(w, r, response.Unauthorized())
+		return
+	}
+	ctx := r.Context()
+	tf, err := h.twoFactor.Get(ctx, principal.UserID)
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	if tf.Enabled {
+		response.WriteError(w, r, errTwoFactorEnabled)
+		return
+	}
+
+	secret, err := login.NewTOTPSecret()
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	if err := h.twoFactor.SetSecret(ctx, principal.UserID, secret); err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":      secret,
+		"otpauth_uri": login.TOTPURI(secret, principal.Username),
+	})
+}
+
+// ActivateTwoFactor godoc
+// @Summary Activate TOTP
+// @Description Verify the first code from the authenticator app. Returns one-time recovery codes that are shown only once. Wrong codes count towards the login throttle of the account (429 with Retry-After).
+// @Tags me
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} map[string]interface{}
+// @Router /me/2fa/verify [post]
+func (h *Handler) ActivateTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	principal, ok := middleware.CurrentPrincipal(r)
+	if !ok {
+		response.WriteError(w, r, response.Unauthorized())
+		return
+	}
+	code, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	id := principal.UserID
+	if h.throttled(w, r, id) {
+		return
+	}
+
+	codes, hashes, err := login.NewRecoveryCodes()
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	err = h.audit.Tx(r.Context(), func(ctx context.Context) error {
+		tf, err := h.twoFactor.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if tf.Enabled {
+			return errTwoFactorEnabled
+		}
+		if tf.Secret == "" {
+			return errTwoFactorNotEnabled.WithDetails("Call POST /api/me/2fa/enroll first")
+		}
+		if ok, err := login.CheckTOTP(ctx, h.twoFactor, id, tf.Secret, code); err != nil {
+			return err
+		} else if !ok {
+			return errInvalidTwoFactorCode
+		}
+		if err := h.twoFactor.Enable(ctx, id, hashes); err != nil {
+			return err
+		}
+		return h.audit.Record(ctx, r, audit.ActionUserTwoFactorEnable, audit.EntityUser, id, audit.Diff(
+			map[string]bool{"two_factor_enabled": false},
+			map[string]bool{"two_factor_enabled": true},
+		))
+	})
+	if err := h.countCode(r, id, err); err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	if err != nil {
+		response.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor godoc
+// @Summary Disable TOTP
+// @Description Turn off 2FA for the caller. Requires a current TOTP code or an unused recovery code. Wrong codes count towards the login throttle of the account (429 with Retry-After).
+// @Tags me
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} map[string]string
+// @Router /me/2fa [delete]
+func (h *Handler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	principal, ok := middleware.CurrentPrincipal(r)
+	if !ok {
+		response.WriteError(w, r, response.Unauthorized())
+		return
+	}
+	code, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	id := principal.UserID
+	if h.throttled(w, r, id) {
+		return
+	}
+
+	err := h.audit.Tx(r.Context(), func(ctx context.Context) error {
+		tf, err := h.twoFactor.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !tf.Enabled {
+			return errTwoFactorNotEnabled
+		}
+		if ok, err := login.CheckSecondFactor(ctx, h.twoFactor, id, tf.Secret, code); err != nil {
+			return err
+		} else if !ok {
+			return errInvalidTwoFactorCode
+		}
+		if err := h.twoFactor.Disable(ctx, id); err != nil {
+			return err
+		}
+		return h.audit.Record(ctx, r, audit.ActionUserTwoFactorDisable, audit.EntityUser, id, audit.Diff(
+			map[string]bool{"two_factor_enabled": true},
+			map[string]bool{"two_factor_enabled": false},
+		))
+	})
+	if err := h.countCode(r, id, err); err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	if err != nil {
+		response.WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// GetTwoFactor godoc
+// @Summary Get the caller's 2FA status
+// @Tags me
+// @Produce  json
+// @Success 200 {object} map[string]interface{}
+// @Router /me/2fa [get]
+func (h *Handler) GetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	principal, ok := middleware.CurrentPrincipal(r)
+	if !ok {
+		response.WriteError(w, r, response.Unauthorized())
+		return
+	}
+	tf, err := h.twoFactor.Get(r.Context(), principal.UserID)
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+	left, err := h.twoFactor.RecoveryCodesLeft(r.Context(), principal.UserID)
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":             tf.Enabled,
+		"recovery_codes_left": left,
+	})
+}
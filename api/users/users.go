@@ -1,122 +1,229 @@
 package user
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
-	"fmt"
-	"golang-backend/database"
+	"errors"
+	"golang-backend/api/audit"
+	"golang-backend/api/login"
+	"golang-backend/api/password"
+	"golang-backend/api/patch"
+	"golang-backend/api/response"
+	"golang-backend/api/validate"
+	"golang-backend/middleware"
+	"golang-backend/models"
+	"golang-backend/repository"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 // User struct สำหรับจัดการข้อมูลผู้ใช้
-type User struct {
-	ID        int     `json:"id"`
-	Username  string  `json:"username"`
-	FirstName string  `json:"firstname"`
-	LastName  string  `json:"lastname"`
-	Email     string  `json:"email"`
-	Phone     string  `json:"phone"`
-	Role      string  `json:"role"`
-	Password  string  `json:"password,omitempty"` // Exclude password from being output in JSON
-	CreatedAt string  `json:"created_at"`
-	TeamId    *int    `json:"team_id"`
-	TeamName  *string `json:"team_name"`
+type User = models.User
+
+// Handler รวม handler ของ /api/users โดยเข้าถึงข้อมูลผ่าน repository
+type Handler struct {
+	users     repository.UserRepository
+	passwords *password.Service
+	sessions  repository.RefreshTokenRepository
+	apiKeys   repository.APIKeyRepository
+	attempts  repository.LoginAttemptRepository
+	throttle  *login.Throttle
+	twoFactor repository.TwoFactorRepository
+	teams     repository.TeamRepository
+	audit     *audit.Log
+	verifier  Verifier
+}
+
+// Verifier ส่งลิงก์ยืนยันอีเมลให้ผู้ใช้ (implement โดย account.Handler)
+type Verifier interface {
+	SendVerification(ctx context.Context, user models.User) error
+}
+
+func NewHandler(users repository.UserRepository, passwords *password.Service, sessions repository.RefreshTokenRepository, apiKeys repository.APIKeyRepository, attempts repository.LoginAttemptRepository, throttle *login.Throttle, twoFactor repository.TwoFactorRepository, teams repository.TeamRepository, auditLog *audit.Log, verifier Verifier) *Handler {
+	return &Handler{users: users, passwords: passwords, sessions: sessions, apiKeys: apiKeys, attempts: attempts, throttle: throttle, twoFactor: twoFactor, teams: teams, audit: auditLog, verifier: verifier}
+}
+
+// sendVerification ส่งอีเมลยืนยันหลังบันทึกข้อมูลแล้ว ถ้าส่งไม่สำเร็จผู้ใช้ขอใหม่ได้ที่ POST /api/me/verify-email
+// จึงบันทึก log แทนการตอบ error
+func (h *Handler) sendVerification(r *http.Request, user models.User) {
+	if err := h.verifier.SendVerification(r.Context(), user); err != nil {
+		log.Printf("request_id=%s send verification to user %d: %v", response.RequestID(r.Context()), user.ID, err)
+	}
+}
+
+var (
+	errUserNotFound = response.New(http.StatusNotFound, response.CodeUserNotFound, "User not found")
+	errTeamNotFound = response.New(http.StatusNotFound, response.CodeTeamNotFound, "Team not found")
+)
+
+// sortFields คือฟิลด์ที่อนุญาตให้ใช้กับพารามิเตอร์ sort (ใส่ "-" นำหน้าเพื่อเรียงจากมากไปน้อย)
+var sortFields = map[string]string{
+	"username":   repository.SortUserUsername,
+	"created_at": repository.SortUserCreatedAt,
+	"lastname":   repository.SortUserLastName,
+}
+
+// userList คือ envelope ที่ GetUsers คืน (สร้างด้วย response.List) ใช้ในเอกสาร swagger
+type userList struct {
+	Users []User         `json:"users"`
+	Meta  response.Page  `json:"meta"`
+	Links response.Links `json:"links"`
 }
 
 // GetUsers godoc
 // @Summary Get all users
-// @Description Get details of all users
+// @Description Get a page of users, optionally filtered and sorted
 // @Tags users
 // @Accept  json
 // @Produce  json
-// @Success 200 {array} User
+// @Param limit query int false "Page size (1-200, default 50)"
+// @Param offset query int false "Number of users to skip"
+// @Param sort query string false "username, created_at or lastname; prefix with - for descending"
+// @Param role query string false "Filter by role"
+// @Param team_id query int false "Filter by team"
+// @Param email_domain query string false "Filter by email domain, e.g. example.com"
+// @Param created_from query string false "Created at or after (YYYY-MM-DD or RFC3339)"
+// @Param created_to query string false "Created at or before (YYYY-MM-DD or RFC3339)"
+// @Param include_deleted query bool false "Include soft-deleted users (requires users:delete)"
+// @Success 200 {object} userList
 // @Router /users [get]
-func GetUsers(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetUsers(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// ปรับปรุง SQL Query เพื่อทำการ JOIN ข้อมูลจาก teams
-	query := `
-		SELECT u.id, u.username, u.firstname, u.lastname, u.email, u.phone, u.role, u.created_at, t.team_id, t.team_name
-		FROM users u
-		LEFT JOIN teams t ON u.team_id = t.team_id
-	`
-
-	stmt, err := database.DB.Prepare(query)
+	page, err := response.ParsePage(r)
 	if err != nil {
-		http.Error(w, "Database preparation error: "+err.Error(), http.StatusInternalServerError)
+		response.WriteError(w, r, response.New(http.StatusBadRequest, response.CodeInvalidQuery, err.Error()))
 		return
 	}
-	defer stmt.Close()
 
-	// Execute the query
-	rows, err := stmt.Query()
+	filter, err := userFilter(r)
 	if err != nil {
-		http.Error(w, "Query error: "+err.Error(), http.StatusInternalServerError)
+		response.WriteError(w, r, response.New(http.StatusBadRequest, response.CodeInvalidQuery, err.Error()))
+		return
+	}
+	// ผู้ใช้ที่ถูกลบเห็นได้เฉพาะผู้ที่ลบและกู้คืนผู้ใช้ได้
+	if filter.IncludeDeleted && !middleware.Can(r, middleware.PermUsersDelete) {
+		response.WriteError(w, r, response.Forbidden())
 		return
 	}
-	defer rows.Close()
+	filter.Limit, filter.Offset = page.Limit, page.Offset
 
-	var users []User
-	for rows.Next() {
-		var user User
-		// ดึงข้อมูลจากทั้งตาราง users และ teams
-		if err := rows.Scan(&user.ID, &user.Username, &user.FirstName, &user.LastName, &user.Email, &user.Phone, &user.Role, &user.CreatedAt, &user.TeamId, &user.TeamName); err != nil {
-			http.Error(w, "Error scanning row: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		users = append(users, user)
+	users, total, err := h.users.List(r.Context(), filter)
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
 	}
+	page.Total = total
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{"users": users})
+	json.NewEncoder(w).Encode(response.List(r, "users", users, page))
 }
 
-func GetUsersByTeam(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+// userFilter สร้าง filter และการเรียงลำดับจาก query string ของ GetUsers
+func userFilter(r *http.Request) (repository.UserFilter, error) {
+	q := r.URL.Query()
+	var filter repository.UserFilter
 
-	// ดึง team_id จาก params
-	params := mux.Vars(r)
-	teamID := params["team_id"]
+	if sort := q.Get("sort"); sort != "" {
+		if strings.HasPrefix(sort, "-") {
+			filter.Desc = true
+			sort = sort[1:]
+		}
+		field, ok := sortFields[sort]
+		if !ok {
+			return filter, errors.New("sort must be one of username, created_at, lastname")
+		}
+		filter.Sort = field
+	}
 
-	// ตรวจสอบว่า team_id ถูกส่งมาใน URL หรือไม่
-	if teamID == "" {
-		http.Error(w, "Team ID is required", http.StatusBadRequest)
-		return
+	if v := q.Get("include_deleted"); v != "" {
+		include, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, errors.New("include_deleted must be true or false")
+		}
+		filter.IncludeDeleted = include
 	}
 
-	// Query เพื่อดึงข้อมูลผู้ใช้จาก users และ team_name จาก teams โดยกรองตาม team_id
-	query := `
-			SELECT users.id, users.username, users.firstname, users.lastname, users.email, users.phone, users.role, users.created_at, users.team_id, teams.team_name
-			FROM users
-			LEFT JOIN teams ON users.team_id = teams.team_id
-			WHERE users.team_id = ?
-	`
+	filter.Role = q.Get("role")
+	if teamID := q.Get("team_id"); teamID != "" {
+		id, err := strconv.Atoi(teamID)
+		if err != nil {
+			return filter, errors.New("team_id must be an integer")
+		}
+		filter.TeamID = &id
+	}
+	filter.EmailDomain = strings.TrimPrefix(q.Get("email_domain"), "@")
+	if from := q.Get("created_from"); from != "" {
+		t, _, err := parseDateParam(from)
+		if err != nil {
+			return filter, errors.New("created_from must be YYYY-MM-DD or RFC3339")
+		}
+		filter.CreatedFrom = &t
+	}
+	if to := q.Get("created_to"); to != "" {
+		t, dateOnly, err := parseDateParam(to)
+		if err != nil {
+			return filter, errors.New("created_to must be YYYY-MM-DD or RFC3339")
+		}
+		// วันที่แบบไม่มีเวลาให้นับรวมทั้งวัน
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		} else {
+			t = t.Add(time.Second)
+		}
+		filter.CreatedBefore = &t
+	}
+	return filter, nil
+}
 
-	rows, err := database.DB.Query(query, teamID)
+func parseDateParam(v string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	return t, false, err
+}
+
+func (h *Handler) GetUsersByTeam(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// ดึง team_id จาก params
+	params := mux.Vars(r)
+	teamID, err := strconv.Atoi(params["team_id"])
 	if err != nil {
-		http.Error(w, "Error executing query: "+err.Error(), http.StatusInternalServerError)
+		response.WriteError(w, r, response.BadRequest("Team ID is required"))
 		return
 	}
-	defer rows.Close()
 
-	var users []User
-	for rows.Next() {
-		var user User
-		if err := rows.Scan(&user.ID, &user.Username, &user.FirstName, &user.LastName, &user.Email, &user.Phone, &user.Role, &user.CreatedAt, &user.TeamId, &user.TeamName); err != nil {
-			http.Error(w, "Error scanning row: "+err.Error(), http.StatusInternalServerError)
+	// recursive=true รวมสมาชิกของทีมย่อยทุกระดับ
+	recursive := false
+	if v := r.URL.Query().Get("recursive"); v != "" {
+		recursive, err = strconv.ParseBool(v)
+		if err != nil {
+			response.WriteError(w, r, response.New(http.StatusBadRequest, response.CodeInvalidQuery, "recursive must be true or false"))
 			return
 		}
-		users = append(users, user)
 	}
 
-	if err := rows.Err(); err != nil {
-		http.Error(w, "Row error: "+err.Error(), http.StatusInternalServerError)
+	// ทีมที่ไม่มีหรือถูกลบไปแล้วตอบ 404 แทนรายการว่าง
+	_, err = h.teams.GetByID(r.Context(), teamID)
+	if errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, errTeamNotFound)
+		return
+	}
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
+	}
+
+	users, err := h.users.ListByTeam(r.Context(), teamID, recursive)
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
 		return
 	}
 
@@ -125,31 +232,35 @@ func GetUsersByTeam(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{"users": users})
 }
 
-func GetUserByID(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetUserByID(w http.ResponseWriter, r *http.Request) {
 	// Extract the ID from the URL using mux.Vars
-	vars := mux.Vars(r)
-	id := vars["id"]
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+	h.writeUserByID(w, r, id)
+}
 
-	// Query the user by ID from the database
-	stmt, err := database.DB.Prepare("SELECT id, username, firstname, lastname, email, phone, role, created_at FROM users WHERE id = ?")
-	if err != nil {
-		http.Error(w, "Error preparing query: "+err.Error(), http.StatusInternalServerError)
+// GetMe คืนข้อมูลของผู้ใช้ที่กำลังเรียก API (จาก principal ใน context)
+func (h *Handler) GetMe(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.CurrentPrincipal(r)
+	if !ok {
+		response.WriteError(w, r, response.Unauthorized())
 		return
 	}
-	defer stmt.Close()
+	h.writeUserByID(w, r, principal.UserID)
+}
 
-	// Query the user by ID from the database
-	var user User
-	err = stmt.QueryRow(id).Scan(
-		&user.ID, &user.Username, &user.FirstName, &user.LastName, &user.Email, &user.Phone, &user.Role, &user.CreatedAt,
-	)
+func (h *Handler) writeUserByID(w http.ResponseWriter, r *http.Request, id int) {
+	w.Header().Set("Content-Type", "application/json")
 
+	user, err := h.users.GetByID(r.Context(), id)
+	if errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, errUserNotFound)
+		return
+	}
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "User not found", http.StatusNotFound)
-		} else {
-			http.Error(w, "Error fetching user: "+err.Error(), http.StatusInternalServerError)
-		}
+		response.WriteError(w, r, response.Internal(err))
 		return
 	}
 
@@ -158,97 +269,173 @@ func GetUserByID(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{"user": user})
 }
 
+// userIDParam อ่าน {id} จาก URL และตอบ 400 ถ้าไม่ใช่ตัวเลข
+func userIDParam(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		response.WriteError(w, r, response.BadRequest("Invalid user ID"))
+		return 0, false
+	}
+	return id, true
+}
+
+// availability คือผลการตรวจค่าหนึ่งของ GET /api/users/availability
+type availability struct {
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// CheckAvailability godoc
+// @Summary Check username and email availability
+// @Description Report whether a username and/or email can be used for a new user. A value is unavailable when it is malformed (reason is the validation code) or already used by an active user (reason "taken"). Deleted users do not hold their username or email.
+// @Tags users
+// @Produce  json
+// @Param username query string false "Username to check"
+// @Param email query string false "Email to check"
+// @Success 200 {object} map[string]availability
+// @Failure 400 {object} map[string]string{"error": "Invalid query"}
+// @Router /users/availability [get]
+func (h *Handler) CheckAvailability(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	checks := []struct{ field, tag string }{
+		{repository.FieldUsername, "username"},
+		{repository.FieldEmail, "email,max=255"},
+	}
+	result := make(map[string]availability)
+	for _, c := range checks {
+		value, ok := r.URL.Query()[c.field]
+		if !ok {
+			continue
+		}
+		if errs := validate.String(c.field, value[0], "required,"+c.tag); len(errs) > 0 {
+			result[c.field] = availability{Reason: errs[0].Code, Message: errs[0].Message}
+			continue
+		}
+		taken, err := h.users.Taken(r.Context(), c.field, value[0])
+		if err != nil {
+			response.WriteError(w, r, response.Internal(err))
+			return
+		}
+		if taken {
+			result[c.field] = availability{Reason: validate.CodeTaken, Message: "is already taken"}
+			continue
+		}
+		result[c.field] = availability{Available: true}
+	}
+	if len(result) == 0 {
+		response.WriteError(w, r, response.New(http.StatusBadRequest, response.CodeInvalidQuery, "username or email is required"))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
 // CreateUser godoc
 // @Summary Create a new user
-// @Description Create a new user and hash the password before saving to the database
+// @Description Create a new user and hash the password before saving to the database. Every invalid field is reported at once in a 422 response.
 // @Tags users
 // @Accept  json
 // @Produce  json
-// @Param user body User true "User data"
-// @Success 201 {object} map[string]string{"message": "User created successfully"}
+// @Param user body createUserRequest true "User data"
+// @Success 201 {object} User
 // @Failure 400 {object} map[string]string{"error": "Invalid input"}
+// @Failure 409 {object} map[string]string{"error": "Username or email already taken"}
+// @Failure 422 {object} map[string]string{"error": "Validation failed"}
 // @Failure 500 {object} map[string]string{"error": "Internal Server Error"}
 // @Router /users [post]
-func CreateUser(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	var user User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	var body createUserRequest
+	errs, err := validate.Decode(r.Body, &body)
+	if err != nil {
+		response.WriteError(w, r, err)
 		return
 	}
-
-	// ตรวจสอบข้อมูลที่จำเป็น
-	if user.Username == "" || user.Password == "" || user.Email == "" {
-		http.Error(w, "Username, password, and email are required", http.StatusBadRequest)
+	if body.TeamID != nil && !errs.Has("team_id") {
+		if err := h.checkTeam(r.Context(), *body.TeamID, &errs); err != nil {
+			response.WriteError(w, r, response.Internal(err))
+			return
+		}
+	}
+	if err := errs.Err(); err != nil {
+		response.WriteError(w, r, err)
 		return
 	}
+	user := body.user()
 
-	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
-	if err != nil {
-		http.Error(w, "Error hashing password", http.StatusInternalServerError)
+	// ผู้ใช้ใหม่เป็น member โดยค่าเริ่มต้น การกำหนด role อื่นต้องมีสิทธิ์ assign role
+	if user.Role != string(middleware.RoleMember) && !middleware.Can(r, middleware.PermUsersAssignRole) {
+		response.WriteError(w, r, response.Forbidden())
 		return
 	}
 
-	// ใช้ Prepared Statement เพื่อป้องกัน SQL Injection
-	stmt, err := database.DB.Prepare(`
-		INSERT INTO users (username, password, firstname, lastname, email, phone, role, team_id, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW())
-	`)
+	if err := h.passwords.Validate(user.Password, user.Username, user.Email); err != nil {
+		response.WriteError(w, r, err)
+		return
+	}
+	hashedPassword, err := h.passwords.Hash(user.Password)
 	if err != nil {
-		http.Error(w, "Error preparing statement: "+err.Error(), http.StatusInternalServerError)
+		response.WriteError(w, r, response.Internal(err))
 		return
 	}
-	defer stmt.Close()
+	user.Password = hashedPassword
 
-	// Execute statement พร้อมกับค่าที่ผ่านการกรอง
-	_, err = stmt.Exec(user.Username, hashedPassword, user.FirstName, user.LastName, user.Email, user.Phone, user.Role, user.TeamId)
+	var created User
+	err = h.audit.Tx(r.Context(), func(ctx context.Context) error {
+		if err := h.users.Create(ctx, &user); err != nil {
+			return err
+		}
+		var err error
+		if created, err = h.users.GetByID(ctx, user.ID); err != nil {
+			return err
+		}
+		return h.audit.Record(ctx, r, audit.ActionUserCreate, audit.EntityUser, user.ID, audit.Diff(nil, created))
+	})
 	if err != nil {
-		http.Error(w, "Error creating user: "+err.Error(), http.StatusInternalServerError)
-		fmt.Println("Database exec error:", err)
+		response.WriteError(w, r, validate.Conflict(err))
 		return
 	}
 
-	// กำหนดเวลา created_at ในรูปแบบที่ต้องการ
-	user.CreatedAt = time.Now().Format("2006-01-02 15:04:05")
+	h.sendVerification(r, created)
 
-	// ส่งข้อมูลผู้ใช้กลับในรูปแบบ JSON
+	// ส่งข้อมูลผู้ใช้ที่บันทึกแล้วกลับในรูปแบบ JSON (รวม team_name และ memberships ไม่มีรหัสผ่าน)
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(created)
 }
 
-func DeleteUserByID(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteUserByID(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	// Extract the user ID from the URL
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	// ใช้ Prepared Statement เพื่อป้องกัน SQL Injection
-	stmt, err := database.DB.Prepare("DELETE FROM users WHERE id = ?")
-	if err != nil {
-		http.Error(w, "Error preparing statement: "+err.Error(), http.StatusInternalServerError)
+	id, ok := userIDParam(w, r)
+	if !ok {
 		return
 	}
-	defer stmt.Close()
 
-	// Execute the delete query with the user ID as a parameter
-	result, err := stmt.Exec(id)
-	if err != nil {
-		http.Error(w, "Error deleting user: "+err.Error(), http.StatusInternalServerError)
+	err := h.audit.Tx(r.Context(), func(ctx context.Context) error {
+		before, err := h.users.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		// soft delete: ข้อมูลยังกู้คืนได้จนกว่าจะถูก purge หลังพ้นระยะเวลาเก็บรักษา
+		if err := h.users.Delete(ctx, id); err != nil {
+			return err
+		}
+		// แถวยังอยู่จึงไม่มี cascade ต้อง revoke session เองเพื่อให้ถูก logout ทันที
+		if err := h.sessions.RevokeUser(ctx, id); err != nil {
+			return err
+		}
+		return h.audit.Record(ctx, r, audit.ActionUserDelete, audit.EntityUser, id, audit.Diff(before, nil))
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, errUserNotFound)
 		return
 	}
-
-	// Check if any rows were affected (if the user was deleted)
-	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		http.Error(w, "Error checking rows affected: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// If no rows were affected, the user was not found
-	if rowsAffected == 0 {
-		http.Error(w, "User not found", http.StatusNotFound)
+		response.WriteError(w, r, response.Internal(err))
 		return
 	}
 
@@ -257,88 +444,197 @@ func DeleteUserByID(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"message": "User deleted successfully"})
 }
 
-func PatchUser(w http.ResponseWriter, r *http.Request) {
+// RestoreUser godoc
+// @Summary Restore a deleted user
+// @Description Undo a soft delete before the user is purged. The user has to log in again.
+// @Tags users
+// @Produce  json
+// @Param id path int true "User ID"
+// @Success 200 {object} User
+// @Router /users/{id}/restore [post]
+func (h *Handler) RestoreUser(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Get the user ID from the request URL (assuming user ID is passed as a URL parameter)
-	vars := mux.Vars(r)
-	userId := vars["id"]
-
-	var userUpdates map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&userUpdates); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	id, ok := userIDParam(w, r)
+	if !ok {
 		return
 	}
 
-	// Start building the SQL query dynamically based on the fields that are updated
-	query := "UPDATE users SET"
-	params := []interface{}{}
-	setClauses := []string{}
-
-	// Check for fields to update and add them to the query
-	if userName, ok := userUpdates["username"]; ok {
-		setClauses = append(setClauses, "username = ?")
-		params = append(params, userName)
-	}
-	if firstName, ok := userUpdates["firstname"]; ok {
-		setClauses = append(setClauses, "firstname = ?")
-		params = append(params, firstName)
+	var after User
+	err := h.audit.Tx(r.Context(), func(ctx context.Context) error {
+		if err := h.users.Restore(ctx, id); err != nil {
+			return err
+		}
+		var err error
+		if after, err = h.users.GetByID(ctx, id); err != nil {
+			return err
+		}
+		return h.audit.Record(ctx, r, audit.ActionUserRestore, audit.EntityUser, id, audit.Diff(nil, after))
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, response.New(http.StatusNotFound, response.CodeUserNotFound, "No deleted user with this ID"))
+		return
 	}
-	if lastName, ok := userUpdates["lastname"]; ok {
-		setClauses = append(setClauses, "lastname = ?")
-		params = append(params, lastName)
+	if err != nil {
+		response.WriteError(w, r, validate.Conflict(err))
+		return
 	}
-	if email, ok := userUpdates["email"]; ok {
-		setClauses = append(setClauses, "email = ?")
-		params = append(params, email)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(after)
+}
+
+// UnlockUser godoc
+// @Summary Unlock a user locked out by failed logins
+// @Description Clear the failed login counter and lockout of a user
+// @Tags users
+// @Produce  json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]string
+// @Router /users/{id}/unlock [post]
+func (h *Handler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return
 	}
-	if phone, ok := userUpdates["phone"]; ok {
-		setClauses = append(setClauses, "phone = ?")
-		params = append(params, phone)
+
+	err := h.audit.Tx(r.Context(), func(ctx context.Context) error {
+		if _, err := h.users.GetByID(ctx, id); err != nil {
+			return err
+		}
+		if err := h.attempts.Reset(ctx, login.AccountKey(id)); err != nil {
+			return err
+		}
+		return h.audit.Record(ctx, r, audit.ActionUserUnlock, audit.EntityUser, id, nil)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, errUserNotFound)
+		return
 	}
-	if role, ok := userUpdates["role"]; ok {
-		setClauses = append(setClauses, "role = ?")
-		params = append(params, role)
+	if err != nil {
+		response.WriteError(w, r, response.Internal(err))
+		return
 	}
-	if password, ok := userUpdates["password"]; ok {
-		// Hash the new password before updating it
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password.(string)), bcrypt.DefaultCost)
-		if err != nil {
-			http.Error(w, "Error hashing password", http.StatusInternalServerError)
-			return
-		}
-		setClauses = append(setClauses, "password = ?")
-		params = append(params, hashedPassword)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "User unlocked successfully"})
+}
+
+// PatchUser godoc
+// @Summary Update a user
+// @Description Update a user with a JSON Merge Patch (application/merge-patch+json or application/json) or a JSON Patch (application/json-patch+json, applied to the user as returned by GET, including test operations). Unknown or read-only fields are rejected, team_id can be cleared with null (or a JSON Patch remove) and the updated user is returned. Changing your own password requires current_password.
+// @Tags users
+// @Accept  json
+// @Produce  json
+// @Param id path int true "User ID"
+// @Success 200 {object} User
+// @Failure 400 {object} map[string]string{"error": "Invalid patch"}
+// @Failure 403 {object} map[string]string{"error": "Forbidden or current password is incorrect"}
+// @Failure 409 {object} map[string]string{"error": "Test operation failed or username/email already taken"}
+// @Failure 415 {object} map[string]string{"error": "Unsupported Content-Type"}
+// @Failure 422 {object} map[string]string{"error": "Validation failed"}
+// @Router /users/{id} [patch]
+func (h *Handler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	// Get the user ID from the request URL (assuming user ID is passed as a URL parameter)
+	id, ok := userIDParam(w, r)
+	if !ok {
+		return
 	}
-	if teamID, ok := userUpdates["team_id"]; ok {
-		setClauses = append(setClauses, "team_id = ?")
-		params = append(params, teamID)
+	h.patchUser(w, r, id)
+}
+
+// sameTeam บอกว่า team_id สองค่าเป็นทีมเดียวกัน (nil คือไม่มีทีมหลัก)
+func sameTeam(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
 	}
+	return *a == *b
+}
 
-	if len(setClauses) == 0 {
-		http.Error(w, "No valid fields to update", http.StatusBadRequest)
+// PatchMe แก้ไขข้อมูลของผู้ใช้ที่กำลังเรียก API การเปลี่ยน role หรือ team_id ยังต้องมีสิทธิ์ตามปกติ
+func (h *Handler) PatchMe(w http.ResponseWriter, r *http.Request) {
+	principal, ok := middleware.CurrentPrincipal(r)
+	if !ok {
+		response.WriteError(w, r, response.Unauthorized())
 		return
 	}
+	h.patchUser(w, r, principal.UserID)
+}
 
-	// Join the SET clauses and complete the SQL query
-	query += " " + strings.Join(setClauses, ", ") + " WHERE id = ?"
-	params = append(params, userId)
+func (h *Handler) patchUser(w http.ResponseWriter, r *http.Request, userId int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Accept-Patch", patch.Accepted)
 
-	// Use prepared statement for security
-	stmt, err := database.DB.Prepare(query)
+	p, err := patch.Parse(r)
 	if err != nil {
-		http.Error(w, "Error preparing statement: "+err.Error(), http.StatusInternalServerError)
+		response.WriteError(w, r, err)
 		return
 	}
-	defer stmt.Close()
 
-	// Execute the query with the user ID as a parameter
-	_, err = stmt.Exec(params...)
+	var emailChanged bool
+	var after User
+	err = h.audit.Tx(r.Context(), func(ctx context.Context) error {
+		// lock ผู้ใช้ไว้ก่อน apply patch เพื่อให้ test operation ตรวจกับค่าที่จะถูกแก้จริง
+		before, err := h.users.GetForUpdate(ctx, userId)
+		if err != nil {
+			return err
+		}
+		doc, err := p.Apply(before)
+		if err != nil {
+			return err
+		}
+		update, err := h.decodePatch(ctx, r, doc, before)
+		if err != nil {
+			return err
+		}
+		if err := h.users.Update(ctx, userId, update); err != nil {
+			return err
+		}
+		// เมื่อ role หรือทีมหลักเปลี่ยน token เดิมของผู้ใช้ยังมี claims เก่าอยู่ จึง revoke ทุก session ให้ login ใหม่
+		claimsChanged := update.Role != nil || update.SetTeam && !sameTeam(before.TeamId, update.TeamID)
+		if claimsChanged {
+			if err := h.sessions.RevokeUser(ctx, userId); err != nil {
+				return err
+			}
+		}
+		// เปลี่ยนรหัสผ่านแล้ว session และ API key อื่นต้องใช้ไม่ได้เหมือนการรีเซ็ตรหัสผ่าน
+		// ยกเว้น session ที่ผู้ใช้ใช้เปลี่ยนรหัสผ่านของตัวเองอยู่
+		if update.PasswordHash != nil {
+			var keep string
+			if p, ok := middleware.PrincipalFromContext(ctx); ok && p.UserID == userId && !claimsChanged {
+				keep = p.SessionID
+			}
+			if err := h.sessions.RevokeOthers(ctx, userId, keep); err != nil {
+				return err
+			}
+			if err := h.apiKeys.RevokeUser(ctx, userId); err != nil {
+				return err
+			}
+		}
+		if after, err = h.users.GetByID(ctx, userId); err != nil {
+			return err
+		}
+		emailChanged = before.Email != after.Email
+		changes := audit.Diff(before, after)
+		if update.PasswordHash != nil {
+			changes["password"] = models.FieldChange{From: audit.Redacted, To: audit.Redacted}
+		}
+		return h.audit.Record(ctx, r, audit.ActionUserUpdate, audit.EntityUser, userId, changes)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		response.WriteError(w, r, errUserNotFound)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Error updating user: "+err.Error(), http.StatusInternalServerError)
+		response.WriteError(w, r, validate.Conflict(err))
 		return
 	}
+	// อีเมลใหม่ต้องยืนยันใหม่ (repository ยกเลิกสถานะยืนยันเดิมแล้ว)
+	if emailChanged {
+		h.sendVerification(r, after)
+	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "User updated successfully"})
+	json.NewEncoder(w).Encode(after)
 }
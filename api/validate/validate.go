@@ -0,0 +1,294 @@
+// Package validate ตรวจสอบ request body ตามกฎใน struct tag `validate` และรวบรวมข้อผิดพลาดของทุก field
+// เพื่อตอบกลับครั้งเดียวเป็น 422
+//
+// กฎที่ใช้ได้ (คั่นด้วย ","):
+//
+//	required   ต้องมีค่าและไม่เป็น string ว่าง
+//	omitempty  ข้ามกฎที่เหลือถ้าเป็น string ว่าง
+//	min=N      ความยาวอย่างน้อย N ตัวอักษร
+//	max=N      ความยาวไม่เกิน N ตัวอักษร
+//	email      อีเมล เช่น alice@example.com
+//	phone      เบอร์โทรแบบ E.164 เช่น +66812345678
+//	username   3-32 ตัวอักษร a-z A-Z 0-9 . _ -
+//	role       role ที่ระบบรู้จัก
+//
+// field ที่เป็น pointer และมีค่า nil ถือว่าไม่ได้ส่งมา (เช่นใน PATCH) จึงไม่ถูกตรวจ
+// ส่วน required ของ pointer หมายถึงถ้าส่งมาต้องไม่เป็น string ว่าง
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang-backend/api/response"
+	"golang-backend/middleware"
+	"golang-backend/repository"
+	"io"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError คือข้อผิดพลาดของ field หนึ่งตามชื่อใน JSON
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// รหัสข้อผิดพลาดของ field
+const (
+	CodeRequired      = "required"
+	CodeInvalidType   = "invalid_type"
+	CodeTooShort      = "too_short"
+	CodeTooLong       = "too_long"
+	CodeInvalidEmail  = "invalid_email"
+	CodeInvalidPhone  = "invalid_phone"
+	CodeInvalidFormat = "invalid_format"
+	CodeInvalidRole   = "invalid_role"
+	CodeNotFound      = "not_found"
+	CodeTaken         = "taken"
+	CodeUnknownField  = "unknown_field"
+)
+
+// Errors คือข้อผิดพลาดทุก field ของ request
+type Errors []FieldError
+
+// Add เพิ่มข้อผิดพลาดของ field
+func (e *Errors) Add(field, code, message string) {
+	*e = append(*e, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Has บอกว่า field มีข้อผิดพลาดแล้วหรือไม่ (เช่นเพื่อข้ามการตรวจที่ต้องเรียกฐานข้อมูล)
+func (e Errors) Has(field string) bool {
+	for _, fe := range e {
+		if fe.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Err คืน nil ถ้าไม่มีข้อผิดพลาด ไม่เช่นนั้นคืน 422 VALIDATION_FAILED ที่มีทุก field ใน details
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return response.New(http.StatusUnprocessableEntity, response.CodeValidationFailed, "Request validation failed").WithDetails(e)
+}
+
+// Conflict แปลง *repository.ConflictError เป็น 409 CONFLICT ที่ระบุ field ที่ซ้ำใน details (รูปแบบเดียวกับ Errors)
+// error อื่นถูกคืนตามเดิม
+func Conflict(err error) error {
+	var conflict *repository.ConflictError
+	if !errors.As(err, &conflict) {
+		return err
+	}
+	message := conflict.Field + " is already taken"
+	return response.New(http.StatusConflict, response.CodeConflict, message).
+		WithDetails(Errors{{Field: conflict.Field, Code: CodeTaken, Message: "is already taken"}})
+}
+
+// Optional คือ field ที่ต้องแยก "ไม่ได้ส่งมา" ออกจาก null เช่น team_id ที่ส่ง null เพื่อล้างค่า
+type Optional[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+// ErrMalformed คือ body ที่ไม่ใช่ JSON object
+var ErrMalformed = response.BadRequest("Invalid request payload")
+
+// Decode อ่าน JSON object จาก r ลง dst (pointer ไปยัง struct) ทีละ field แล้วตรวจตามกฎใน tag
+// field ที่ชนิดไม่ตรงถูกรายงานใน Errors แทนการหยุดที่ field แรก คืน ErrMalformed ถ้า body ไม่ใช่ JSON object
+func Decode(r io.Reader, dst interface{}) (Errors, error) {
+	return decode(r, dst, false)
+}
+
+// DecodePatch อ่าน JSON Merge Patch (RFC 7396) ลง dst แบบเดียวกับ Decode แต่รายงาน field ที่ไม่มีใน dst
+// และ null ของ field ที่ล้างค่าไม่ได้ (ทุก field ยกเว้น Optional) เป็นข้อผิดพลาดแทนการข้าม
+func DecodePatch(r io.Reader, dst interface{}) (Errors, error) {
+	return decode(r, dst, true)
+}
+
+func decode(r io.Reader, dst interface{}, patch bool) (Errors, error) {
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil || raw == nil {
+		return nil, ErrMalformed
+	}
+
+	var errs Errors
+	v := reflect.ValueOf(dst).Elem()
+	t := v.Type()
+	known := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := fieldName(t.Field(i))
+		known[name] = true
+		tag := t.Field(i).Tag.Get("validate")
+		data, ok := raw[name]
+		if ok && patch && string(data) == "null" && !isOptional(t.Field(i).Type) {
+			errs.Add(name, CodeInvalidType, "must be "+typeName(t.Field(i).Type))
+			continue
+		}
+		if !ok {
+			// pointer ที่ไม่ได้ส่งมาไม่ถูกตรวจแม้จะ required (required ใช้กับค่าที่ส่งมาเท่านั้น)
+			if hasRule(tag, "required") && t.Field(i).Type.Kind() != reflect.Pointer {
+				errs.Add(name, CodeRequired, "is required")
+			}
+			continue
+		}
+		field := v.Field(i)
+		if err := json.Unmarshal(data, field.Addr().Interface()); err != nil {
+			field.SetZero()
+			errs.Add(name, CodeInvalidType, "must be "+typeName(field.Type()))
+			continue
+		}
+		errs = append(errs, checkField(name, field, tag)...)
+	}
+	if patch {
+		// เรียงตามชื่อเพื่อให้ข้อผิดพลาดออกมาลำดับเดิมทุกครั้ง
+		var unknown []string
+		for name := range raw {
+			if !known[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		sort.Strings(unknown)
+		for _, name := range unknown {
+			errs.Add(name, CodeUnknownField, "is not a field that can be updated")
+		}
+	}
+	return errs, nil
+}
+
+func fieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+func hasRule(tag, rule string) bool {
+	for _, r := range strings.Split(tag, ",") {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// isOptional บอกว่า t คือ Optional[T]
+func isOptional(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t.NumField() == 2 && t.Field(0).Name == "Set"
+}
+
+func typeName(t reflect.Type) string {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if isOptional(t) {
+		// Optional[T]
+		t, nullable = t.Field(1).Type.Elem(), true
+	}
+	var name string
+	switch t.Kind() {
+	case reflect.String:
+		name = "a string"
+	case reflect.Int, reflect.Int64:
+		name = "an integer"
+	case reflect.Bool:
+		name = "a boolean"
+	case reflect.Slice:
+		name = "an array"
+	default:
+		name = "a " + t.Kind().String()
+	}
+	if nullable {
+		name += " or null"
+	}
+	return name
+}
+
+// String ตรวจค่า string ค่าเดียวตามกฎเดียวกับ tag เช่นค่าจาก query string
+func String(name, value, tag string) Errors {
+	return checkField(name, reflect.ValueOf(value), tag)
+}
+
+var (
+	phonePattern    = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{3,32}$`)
+)
+
+// checkField ตรวจค่าของ field ตาม tag field ที่ไม่ใช่ string ตรวจได้เฉพาะ required
+func checkField(name string, field reflect.Value, tag string) Errors {
+	var errs Errors
+	if tag == "" {
+		return nil
+	}
+	// pointer ที่เป็น nil คือไม่ได้ส่งมาหรือส่ง null
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return nil
+		}
+		field = field.Elem()
+	}
+	value := ""
+	if field.Kind() == reflect.String {
+		value = field.String()
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		rule, arg, _ := strings.Cut(rule, "=")
+		switch rule {
+		case "required":
+			if field.Kind() == reflect.String && strings.TrimSpace(value) == "" {
+				errs.Add(name, CodeRequired, "is required")
+				return errs
+			}
+		case "omitempty":
+			if value == "" {
+				return errs
+			}
+		case "min":
+			if n, _ := strconv.Atoi(arg); utf8.RuneCountInString(value) < n {
+				errs.Add(name, CodeTooShort, fmt.Sprintf("must be at least %d characters", n))
+			}
+		case "max":
+			if n, _ := strconv.Atoi(arg); utf8.RuneCountInString(value) > n {
+				errs.Add(name, CodeTooLong, fmt.Sprintf("must be at most %d characters", n))
+			}
+		case "email":
+			// ไม่รับรูปแบบ "Name <address>" และต้องมีโดเมน
+			addr, err := mail.ParseAddress(value)
+			if err != nil || addr.Address != value || addr.Name != "" || !strings.Contains(value[strings.LastIndex(value, "@"):], ".") {
+				errs.Add(name, CodeInvalidEmail, "must be a valid email address")
+			}
+		case "phone":
+			if !phonePattern.MatchString(value) {
+				errs.Add(name, CodeInvalidPhone, "must be an E.164 phone number such as +66812345678")
+			}
+		case "username":
+			if !usernamePattern.MatchString(value) {
+				errs.Add(name, CodeInvalidFormat, "must be 3-32 letters, digits, '.', '_' or '-'")
+			}
+		case "role":
+			if !middleware.Role(value).Valid() {
+				errs.Add(name, CodeInvalidRole, "must be one of admin, team_lead, member")
+			}
+		default:
+			panic("validate: unknown rule " + strconv.Quote(rule))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,511 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile คือไฟล์ config ที่จะถูกอ่านถ้ามีอยู่และไม่ได้กำหนด APP_CONFIG_FILE
+const DefaultFile = "config.yaml"
+
+// Config รวมค่าตั้งค่าทั้งหมดของแอป
+type Config struct {
+	Server   ServerConfig   `yaml:"server" toml:"server"`
+	Database DatabaseConfig `yaml:"database" toml:"database"`
+	JWT      JWTConfig      `yaml:"jwt" toml:"jwt"`
+	Purge    PurgeConfig    `yaml:"purge" toml:"purge"`
+	Login    LoginConfig    `yaml:"login" toml:"login"`
+	Mail     MailConfig     `yaml:"mail" toml:"mail"`
+	Account  AccountConfig  `yaml:"account" toml:"account"`
+	Password PasswordConfig `yaml:"password" toml:"password"`
+	OIDC     OIDCConfig     `yaml:"oidc" toml:"oidc"`
+}
+
+// ServerConfig ค่าตั้งค่าของ HTTP server และ CORS
+type ServerConfig struct {
+	Addr           string   `yaml:"addr" toml:"addr"`
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins"`
+}
+
+// DatabaseConfig ค่าตั้งค่าการเชื่อมต่อ MySQL
+type DatabaseConfig struct {
+	DSN string `yaml:"dsn" toml:"dsn"`
+}
+
+// JWT signing algorithms ที่รองรับ
+const (
+	JWTRS256 = "RS256"
+	JWTEdDSA = "EdDSA" // Ed25519
+)
+
+// JWTConfig ค่าตั้งค่าการเซ็นและตรวจสอบ JWT
+// token ถูกเซ็นด้วย private key ที่หมุนเวียนทุก RotateEvery และบริการอื่นตรวจได้ด้วย public key จาก /.well-known/jwks.json
+type JWTConfig struct {
+	Algorithm string `yaml:"algorithm" toml:"algorithm"`
+	// KeyDir เก็บ private key เป็นไฟล์ PEM ชื่อ <kid>.pem ทุก instance ต้องใช้ directory เดียวกัน
+	// ถ้าว่างจะสร้าง key ไว้ในหน่วยความจำ (access token เดิมใช้ไม่ได้หลัง restart)
+	KeyDir      string   `yaml:"key_dir" toml:"key_dir"`
+	RotateEvery Duration `yaml:"rotate_every" toml:"rotate_every"`
+	Issuer      string   `yaml:"issuer" toml:"issuer"`
+	Audience    string   `yaml:"audience" toml:"audience"`
+	TTL         Duration `yaml:"ttl" toml:"ttl"`                 // อายุของ access token
+	RefreshTTL  Duration `yaml:"refresh_ttl" toml:"refresh_ttl"` // อายุของ refresh token
+}
+
+// PurgeConfig ค่าตั้งค่าการลบผู้ใช้และทีมที่ถูก soft delete ออกถาวร
+type PurgeConfig struct {
+	Retention Duration `yaml:"retention" toml:"retention"` // เก็บแถวที่ถูกลบไว้นานเท่าไรก่อนลบถาวร (0 คือไม่ลบ)
+	Interval  Duration `yaml:"interval" toml:"interval"`   // ความถี่ในการตรวจสอบ
+}
+
+// LoginConfig ค่าตั้งค่าการป้องกันการเดารหัสผ่าน
+// การ login ที่ล้มเหลวถูกนับแยกตามบัญชีและตาม IP หลังล้มเหลว n ครั้งต้องรอ BackoffBase * 2^(n-1)
+// (ไม่เกิน BackoffMax) ก่อนลองใหม่ และบัญชีที่ล้มเหลวครบ MaxFailures ครั้งจะถูกล็อกเป็นเวลา Lockout
+// ตัวนับจะเริ่มใหม่เมื่อไม่มีการล้มเหลวนานเกิน Lockout
+type LoginConfig struct {
+	MaxFailures int      `yaml:"max_failures" toml:"max_failures"`
+	Lockout     Duration `yaml:"lockout" toml:"lockout"`
+	BackoffBase Duration `yaml:"backoff_base" toml:"backoff_base"` // 0 คือไม่หน่วงเวลา
+	BackoffMax  Duration `yaml:"backoff_max" toml:"backoff_max"`
+}
+
+// Mail drivers ที่รองรับ
+const (
+	MailDriverLog  = "log"  // เขียนอีเมลลง log ของแอป (สำหรับพัฒนาบนเครื่อง)
+	MailDriverFile = "file" // ต่อท้ายอีเมลลงไฟล์ mail.file
+	MailDriverSMTP = "smtp"
+)
+
+// MailConfig ค่าตั้งค่าการส่งอีเมล
+type MailConfig struct {
+	Driver       string `yaml:"driver" toml:"driver"`
+	From         string `yaml:"from" toml:"from"`
+	File         string `yaml:"file" toml:"file"`
+	SMTPAddr     string `yaml:"smtp_addr" toml:"smtp_addr"` // host:port
+	SMTPUsername string `yaml:"smtp_username" toml:"smtp_username"`
+	SMTPPassword string `yaml:"smtp_password" toml:"smtp_password"`
+}
+
+// AccountConfig ค่าตั้งค่าลิงก์รีเซ็ตรหัสผ่านและยืนยันอีเมลที่ส่งทางอีเมล
+type AccountConfig struct {
+	// LinkBaseURL คือ URL ของ frontend ลิงก์ในอีเมลจะเป็น LinkBaseURL + "/reset-password?token=..."
+	LinkBaseURL string   `yaml:"link_base_url" toml:"link_base_url"`
+	ResetTTL    Duration `yaml:"reset_ttl" toml:"reset_ttl"`
+	VerifyTTL   Duration `yaml:"verify_ttl" toml:"verify_ttl"`
+}
+
+// Password hash algorithms ที่รองรับ
+const (
+	PasswordArgon2id = "argon2id"
+	PasswordBcrypt   = "bcrypt"
+)
+
+// PasswordConfig นโยบายรหัสผ่านใหม่และพารามิเตอร์การ hash
+// ความยาวนับเป็นตัวอักษร ยกเว้น MaxLength ที่นับเป็นไบต์ (bcrypt ใช้ได้แค่ 72 ไบต์แรก)
+// รหัสผ่านใหม่ถูก hash ด้วย Algorithm ส่วน hash เดิมที่ใช้ algorithm หรือพารามิเตอร์อื่นยังตรวจได้
+// และจะถูก hash ใหม่ตอน login สำเร็จ
+type PasswordConfig struct {
+	MinLength     int    `yaml:"min_length" toml:"min_length"`
+	MaxLength     int    `yaml:"max_length" toml:"max_length"`
+	RequireUpper  bool   `yaml:"require_upper" toml:"require_upper"`
+	RequireLower  bool   `yaml:"require_lower" toml:"require_lower"`
+	RequireDigit  bool   `yaml:"require_digit" toml:"require_digit"`
+	RequireSymbol bool   `yaml:"require_symbol" toml:"require_symbol"`
+	RejectCommon  bool   `yaml:"reject_common" toml:"reject_common"` // ปฏิเสธรหัสผ่านที่อยู่ในรายการรหัสผ่านยอดนิยม
+	Algorithm     string `yaml:"algorithm" toml:"algorithm"`
+	BcryptCost    int    `yaml:"bcrypt_cost" toml:"bcrypt_cost"`
+	Argon2Memory  uint32 `yaml:"argon2_memory" toml:"argon2_memory"` // KiB
+	Argon2Time    uint32 `yaml:"argon2_time" toml:"argon2_time"`     // จำนวนรอบ
+	Argon2Threads uint8  `yaml:"argon2_threads" toml:"argon2_threads"`
+}
+
+// OIDCConfig ค่าตั้งค่า single sign-on ผ่าน OpenID Connect (authorization code + PKCE)
+// ปิดอยู่ถ้าไม่กำหนด Issuer ผู้ใช้ถูกจับคู่ด้วยอีเมลที่ identity provider ยืนยันแล้ว
+type OIDCConfig struct {
+	Issuer       string   `yaml:"issuer" toml:"issuer"` // ต้องตรงกับ iss ใน ID token และใช้หา /.well-known/openid-configuration
+	ClientID     string   `yaml:"client_id" toml:"client_id"`
+	ClientSecret string   `yaml:"client_secret" toml:"client_secret"` // ว่างสำหรับ public client
+	RedirectURL  string   `yaml:"redirect_url" toml:"redirect_url"`   // URL ของ /auth/oidc/callback ที่ลงทะเบียนไว้กับ provider
+	Scopes       []string `yaml:"scopes" toml:"scopes"`
+	// Provision สร้างผู้ใช้ใหม่ตอน login ครั้งแรกถ้ายังไม่มีผู้ใช้ที่ใช้อีเมลนี้
+	Provision   bool   `yaml:"provision" toml:"provision"`
+	DefaultRole string `yaml:"default_role" toml:"default_role"` // role ของผู้ใช้ที่ไม่อยู่ในกลุ่มที่กำหนด role ไว้
+	GroupsClaim string `yaml:"groups_claim" toml:"groups_claim"`
+	// Groups จับคู่กลุ่มใน GroupsClaim กับ role และทีมหลัก รายการแรกที่ตรงกันมีผล
+	// ถ้ามีรายการที่กำหนด role role ของผู้ใช้จะถูกตั้งตาม provider ทุกครั้งที่ login
+	Groups []OIDCGroup `yaml:"groups" toml:"groups"`
+}
+
+// roles คือ role ที่ใช้ได้ ต้องตรงกับ middleware.Role (config import middleware ไม่ได้เพราะ middleware ใช้ config)
+var roles = []string{"admin", "team_lead", "member"}
+
+// OIDCGroup คือ role และ/หรือทีมหลักของสมาชิกกลุ่ม Group ใน identity provider
+type OIDCGroup struct {
+	Group  string `yaml:"group" toml:"group"`
+	Role   string `yaml:"role" toml:"role"`
+	TeamID int    `yaml:"team_id" toml:"team_id"`
+}
+
+// Duration รับค่าแบบ "15m" หรือ "24h" ได้ทั้งจากไฟล์และ env
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Default คืนค่า config เริ่มต้นสำหรับการพัฒนาบนเครื่อง
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:           ":8080",
+			AllowedOrigins: []string{"http://localhost:3000"},
+		},
+		Database: DatabaseConfig{
+			DSN: "root:@tcp(127.0.0.1:3306)/golang_project",
+		},
+		JWT: JWTConfig{
+			Algorithm:   JWTRS256,
+			RotateEvery: Duration(30 * 24 * time.Hour),
+			Issuer:      "golang-backend",
+			Audience:    "golang-backend",
+			TTL:         Duration(15 * time.Minute),
+			RefreshTTL:  Duration(30 * 24 * time.Hour),
+		},
+		Purge: PurgeConfig{
+			Retention: Duration(30 * 24 * time.Hour),
+			Interval:  Duration(time.Hour),
+		},
+		Login: LoginConfig{
+			MaxFailures: 5,
+			Lockout:     Duration(15 * time.Minute),
+			BackoffBase: Duration(time.Second),
+			BackoffMax:  Duration(time.Minute),
+		},
+		Mail: MailConfig{
+			Driver: MailDriverLog,
+			From:   "no-reply@localhost",
+		},
+		Account: AccountConfig{
+			LinkBaseURL: "http://localhost:3000",
+			ResetTTL:    Duration(time.Hour),
+			VerifyTTL:   Duration(48 * time.Hour),
+		},
+		OIDC: OIDCConfig{
+			Scopes:      []string{"openid", "email", "profile"},
+			Provision:   true,
+			DefaultRole: "member",
+			GroupsClaim: "groups",
+		},
+		Password: PasswordConfig{
+			MinLength:    8,
+			MaxLength:    72,
+			RejectCommon: true,
+			Algorithm:    PasswordArgon2id,
+			BcryptCost:   12,
+			// ค่าขั้นต่ำที่ OWASP แนะนำสำหรับ argon2id
+			Argon2Memory:  19 * 1024,
+			Argon2Time:    2,
+			Argon2Threads: 1,
+		},
+	}
+}
+
+// Load อ่าน config ตามลำดับ: ค่าเริ่มต้น -> ไฟล์ (YAML หรือ TOML) -> environment variables
+// แล้วตรวจสอบความถูกต้อง
+func Load() (Config, error) {
+	cfg := Default()
+
+	path, required := os.LookupEnv("APP_CONFIG_FILE")
+	if !required {
+		path = DefaultFile
+	}
+	if err := loadFile(&cfg, path, required); err != nil {
+		return cfg, err
+	}
+	if err := applyEnv(&cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+func loadFile(cfg *Config, path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !required {
+			return nil
+		}
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("config file %s: unsupported extension (use .yaml, .yml or .toml)", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func applyEnv(cfg *Config) error {
+	if v, ok := os.LookupEnv("APP_SERVER_ADDR"); ok {
+		cfg.Server.Addr = v
+	}
+	if v, ok := os.LookupEnv("APP_CORS_ALLOWED_ORIGINS"); ok {
+		cfg.Server.AllowedOrigins = splitList(v)
+	}
+	if v, ok := os.LookupEnv("APP_OIDC_SCOPES"); ok {
+		cfg.OIDC.Scopes = splitList(v)
+	}
+	if v, ok := os.LookupEnv("APP_DATABASE_DSN"); ok {
+		cfg.Database.DSN = v
+	}
+	if v, ok := os.LookupEnv("APP_JWT_TTL"); ok {
+		if err := cfg.JWT.TTL.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("APP_JWT_TTL: %w", err)
+		}
+	}
+	if v, ok := os.LookupEnv("APP_JWT_REFRESH_TTL"); ok {
+		if err := cfg.JWT.RefreshTTL.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("APP_JWT_REFRESH_TTL: %w", err)
+		}
+	}
+	if v, ok := os.LookupEnv("APP_PURGE_RETENTION"); ok {
+		if err := cfg.Purge.Retention.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("APP_PURGE_RETENTION: %w", err)
+		}
+	}
+	if v, ok := os.LookupEnv("APP_PURGE_INTERVAL"); ok {
+		if err := cfg.Purge.Interval.UnmarshalText([]byte(v)); err != nil {
+			return fmt.Errorf("APP_PURGE_INTERVAL: %w", err)
+		}
+	}
+	if v, ok := os.LookupEnv("APP_LOGIN_MAX_FAILURES"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("APP_LOGIN_MAX_FAILURES: %w", err)
+		}
+		cfg.Login.MaxFailures = n
+	}
+	for name, dst := range map[string]*int{
+		"APP_PASSWORD_MIN_LENGTH":  &cfg.Password.MinLength,
+		"APP_PASSWORD_MAX_LENGTH":  &cfg.Password.MaxLength,
+		"APP_PASSWORD_BCRYPT_COST": &cfg.Password.BcryptCost,
+	} {
+		if v, ok := os.LookupEnv(name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*dst = n
+		}
+	}
+	for name, dst := range map[string]*bool{
+		"APP_PASSWORD_REQUIRE_UPPER":  &cfg.Password.RequireUpper,
+		"APP_PASSWORD_REQUIRE_LOWER":  &cfg.Password.RequireLower,
+		"APP_PASSWORD_REQUIRE_DIGIT":  &cfg.Password.RequireDigit,
+		"APP_PASSWORD_REQUIRE_SYMBOL": &cfg.Password.RequireSymbol,
+		"APP_PASSWORD_REJECT_COMMON":  &cfg.Password.RejectCommon,
+		"APP_OIDC_PROVISION":          &cfg.OIDC.Provision,
+	} {
+		if v, ok := os.LookupEnv(name); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*dst = b
+		}
+	}
+	for name, dst := range map[string]*uint32{
+		"APP_PASSWORD_ARGON2_MEMORY": &cfg.Password.Argon2Memory,
+		"APP_PASSWORD_ARGON2_TIME":   &cfg.Password.Argon2Time,
+	} {
+		if v, ok := os.LookupEnv(name); ok {
+			n, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*dst = uint32(n)
+		}
+	}
+	if v, ok := os.LookupEnv("APP_PASSWORD_ARGON2_THREADS"); ok {
+		n, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			return fmt.Errorf("APP_PASSWORD_ARGON2_THREADS: %w", err)
+		}
+		cfg.Password.Argon2Threads = uint8(n)
+	}
+	for name, dst := range map[string]*string{
+		"APP_MAIL_DRIVER":           &cfg.Mail.Driver,
+		"APP_MAIL_FROM":             &cfg.Mail.From,
+		"APP_MAIL_FILE":             &cfg.Mail.File,
+		"APP_MAIL_SMTP_ADDR":        &cfg.Mail.SMTPAddr,
+		"APP_MAIL_SMTP_USERNAME":    &cfg.Mail.SMTPUsername,
+		"APP_MAIL_SMTP_PASSWORD":    &cfg.Mail.SMTPPassword,
+		"APP_ACCOUNT_LINK_BASE_URL": &cfg.Account.LinkBaseURL,
+		"APP_PASSWORD_ALGORITHM":    &cfg.Password.Algorithm,
+		"APP_JWT_ALGORITHM":         &cfg.JWT.Algorithm,
+		"APP_JWT_KEY_DIR":           &cfg.JWT.KeyDir,
+		"APP_JWT_ISSUER":            &cfg.JWT.Issuer,
+		"APP_JWT_AUDIENCE":          &cfg.JWT.Audience,
+		"APP_OIDC_ISSUER":           &cfg.OIDC.Issuer,
+		"APP_OIDC_CLIENT_ID":        &cfg.OIDC.ClientID,
+		"APP_OIDC_CLIENT_SECRET":    &cfg.OIDC.ClientSecret,
+		"APP_OIDC_REDIRECT_URL":     &cfg.OIDC.RedirectURL,
+	} {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = v
+		}
+	}
+	for name, dst := range map[string]*Duration{
+		"APP_JWT_ROTATE_EVERY":   &cfg.JWT.RotateEvery,
+		"APP_LOGIN_LOCKOUT":      &cfg.Login.Lockout,
+		"APP_LOGIN_BACKOFF_BASE": &cfg.Login.BackoffBase,
+		"APP_LOGIN_BACKOFF_MAX":  &cfg.Login.BackoffMax,
+		"APP_ACCOUNT_RESET_TTL":  &cfg.Account.ResetTTL,
+		"APP_ACCOUNT_VERIFY_TTL": &cfg.Account.VerifyTTL,
+	} {
+		if v, ok := os.LookupEnv(name); ok {
+			if err := dst.UnmarshalText([]byte(v)); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate ตรวจสอบว่าค่าที่จำเป็นครบและอยู่ในรูปแบบที่ใช้ได้
+func (c Config) Validate() error {
+	var problems []string
+	if c.Server.Addr == "" {
+		problems = append(problems, "server.addr is required")
+	}
+	if c.Database.DSN == "" {
+		problems = append(problems, "database.dsn is required")
+	}
+	if c.JWT.Algorithm != JWTRS256 && c.JWT.Algorithm != JWTEdDSA {
+		problems = append(problems, "jwt.algorithm must be RS256 or EdDSA")
+	}
+	if c.JWT.RotateEvery <= c.JWT.TTL || c.JWT.RotateEvery < Duration(time.Hour) {
+		problems = append(problems, "jwt.rotate_every must be at least 1h and longer than jwt.ttl")
+	}
+	if c.JWT.Issuer == "" || c.JWT.Audience == "" {
+		problems = append(problems, "jwt.issuer and jwt.audience are required")
+	}
+	if c.JWT.TTL <= 0 {
+		problems = append(problems, "jwt.ttl must be positive")
+	}
+	if c.JWT.RefreshTTL <= c.JWT.TTL {
+		problems = append(problems, "jwt.refresh_ttl must be longer than jwt.ttl")
+	}
+	if c.Purge.Retention < 0 {
+		problems = append(problems, "purge.retention must not be negative")
+	}
+	if c.Purge.Retention > 0 && c.Purge.Interval <= 0 {
+		problems = append(problems, "purge.interval must be positive")
+	}
+	if c.Login.MaxFailures < 1 {
+		problems = append(problems, "login.max_failures must be at least 1")
+	}
+	if c.Login.Lockout <= 0 {
+		problems = append(problems, "login.lockout must be positive")
+	}
+	if c.Login.BackoffBase < 0 {
+		problems = append(problems, "login.backoff_base must not be negative")
+	}
+	if c.Login.BackoffMax < c.Login.BackoffBase {
+		problems = append(problems, "login.backoff_max must not be shorter than login.backoff_base")
+	}
+	switch c.Mail.Driver {
+	case MailDriverLog:
+	case MailDriverFile:
+		if c.Mail.File == "" {
+			problems = append(problems, "mail.file is required for the file driver")
+		}
+	case MailDriverSMTP:
+		if c.Mail.SMTPAddr == "" {
+			problems = append(problems, "mail.smtp_addr is required for the smtp driver")
+		}
+	default:
+		problems = append(problems, "mail.driver must be log, file or smtp")
+	}
+	if c.Mail.From == "" {
+		problems = append(problems, "mail.from is required")
+	}
+	if c.Account.ResetTTL <= 0 || c.Account.VerifyTTL <= 0 {
+		problems = append(problems, "account.reset_ttl and account.verify_ttl must be positive")
+	}
+	if c.Password.MinLength < 1 {
+		problems = append(problems, "password.min_length must be at least 1")
+	}
+	maxLength := 1024
+	if c.Password.Algorithm == PasswordBcrypt {
+		maxLength = 72
+	}
+	if c.Password.MaxLength < c.Password.MinLength || c.Password.MaxLength > maxLength {
+		problems = append(problems, fmt.Sprintf("password.max_length must be between password.min_length and %d", maxLength))
+	}
+	switch c.Password.Algorithm {
+	case PasswordArgon2id, PasswordBcrypt:
+	default:
+		problems = append(problems, "password.algorithm must be argon2id or bcrypt")
+	}
+	if c.Password.BcryptCost < 4 || c.Password.BcryptCost > 31 {
+		problems = append(problems, "password.bcrypt_cost must be between 4 and 31")
+	}
+	if c.Password.Argon2Time < 1 || c.Password.Argon2Threads < 1 || c.Password.Argon2Memory < 8*uint32(c.Password.Argon2Threads) {
+		problems = append(problems, "password.argon2_time and password.argon2_threads must be at least 1 and password.argon2_memory at least 8 KiB per thread")
+	}
+	if c.OIDC.Issuer != "" {
+		if c.OIDC.ClientID == "" || c.OIDC.RedirectURL == "" {
+			problems = append(problems, "oidc.client_id and oidc.redirect_url are required when oidc.issuer is set")
+		}
+		if !slices.Contains(c.OIDC.Scopes, "openid") {
+			problems = append(problems, "oidc.scopes must include openid")
+		}
+		if !slices.Contains(roles, c.OIDC.DefaultRole) {
+			problems = append(problems, "oidc.default_role must be one of admin, team_lead, member")
+		}
+		for i, g := range c.OIDC.Groups {
+			if g.Group == "" || (g.Role == "" && g.TeamID == 0) {
+				problems = append(problems, fmt.Sprintf("oidc.groups[%d] needs a group and a role or team_id", i))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
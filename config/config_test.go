@@ -0,0 +1,324 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile เขียนไฟล์ config ชั่วคราวและตั้ง APP_CONFIG_FILE ให้ชี้ไปที่ไฟล์นั้น
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("APP_CONFIG_FILE", path)
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `
+server:
+  addr: ":9000"
+  allowed_origins: ["https://app.example.com"]
+jwt:
+  algorithm: EdDSA
+  ttl: 10m
+password:
+  algorithm: bcrypt
+  max_length: 64
+  argon2_threads: 4
+oidc:
+  issuer: "https://id.example.com"
+  client_id: backend
+  redirect_url: "https://api.example.com/auth/oidc/callback"
+  groups:
+    - group: admins
+      role: admin
+    - group: payments
+      team_id: 3
+`,
+		"config.toml": `
+[server]
+addr = ":9000"
+allowed_origins = ["https://app.example.com"]
+
+[jwt]
+algorithm = "EdDSA"
+ttl = "10m"
+
+[password]
+algorithm = "bcrypt"
+max_length = 64
+argon2_threads = 4
+
+[oidc]
+issuer = "https://id.example.com"
+client_id = "backend"
+redirect_url = "https://api.example.com/auth/oidc/callback"
+
+[[oidc.groups]]
+group = "admins"
+role = "admin"
+
+[[oidc.groups]]
+group = "payments"
+team_id = 3
+`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			writeFile(t, name, content)
+			cfg, err := Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Server.Addr != ":9000" || !reflect.DeepEqual(cfg.Server.AllowedOrigins, []string{"https://app.example.com"}) {
+				t.Fatalf("server = %+v", cfg.Server)
+			}
+			if cfg.JWT.Algorithm != JWTEdDSA || cfg.JWT.TTL != Duration(10*time.Minute) {
+				t.Fatalf("jwt = %+v", cfg.JWT)
+			}
+			if cfg.Password.Algorithm != PasswordBcrypt || cfg.Password.MaxLength != 64 || cfg.Password.Argon2Threads != 4 {
+				t.Fatalf("password = %+v", cfg.Password)
+			}
+			want := []OIDCGroup{{Group: "admins", Role: "admin"}, {Group: "payments", TeamID: 3}}
+			if cfg.OIDC.Issuer != "https://id.example.com" || !reflect.DeepEqual(cfg.OIDC.Groups, want) {
+				t.Fatalf("oidc = %+v", cfg.OIDC)
+			}
+			// ค่าที่ไฟล์ไม่ได้กำหนดยังเป็นค่าเริ่มต้น
+			if cfg.JWT.RefreshTTL != Default().JWT.RefreshTTL || cfg.OIDC.DefaultRole != "member" {
+				t.Fatalf("defaults were not kept: %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	t.Run("required file is missing", func(t *testing.T) {
+		t.Setenv("APP_CONFIG_FILE", filepath.Join(t.TempDir(), "missing.yaml"))
+		if _, err := Load(); err == nil || !strings.Contains(err.Error(), "read config file") {
+			t.Fatalf("err = %v", err)
+		}
+	})
+	t.Run("unsupported extension", func(t *testing.T) {
+		writeFile(t, "config.json", "{}")
+		if _, err := Load(); err == nil || !strings.Contains(err.Error(), "unsupported extension") {
+			t.Fatalf("err = %v", err)
+		}
+	})
+	t.Run("malformed file", func(t *testing.T) {
+		writeFile(t, "config.yaml", "jwt:\n  ttl: soon\n")
+		if _, err := Load(); err == nil || !strings.Contains(err.Error(), "parse config file") {
+			t.Fatalf("err = %v", err)
+		}
+	})
+	t.Run("invalid values", func(t *testing.T) {
+		writeFile(t, "config.toml", "[server]\naddr = \"\"\n")
+		if _, err := Load(); err == nil || !strings.Contains(err.Error(), "server.addr is required") {
+			t.Fatalf("err = %v", err)
+		}
+	})
+}
+
+func TestEnvOverridesFile(t *testing.T) {
+	writeFile(t, "config.yaml", `
+server:
+  addr: ":9000"
+login:
+  max_failures: 3
+password:
+  argon2_threads: 2
+  require_upper: false
+`)
+	for name, value := range map[string]string{
+		"APP_SERVER_ADDR":             ":9100",
+		"APP_CORS_ALLOWED_ORIGINS":    " https://a.example.com, ,https://b.example.com ",
+		"APP_JWT_TTL":                 "5m",
+		"APP_LOGIN_MAX_FAILURES":      "7",
+		"APP_LOGIN_LOCKOUT":           "1h",
+		"APP_PASSWORD_MIN_LENGTH":     "12",
+		"APP_PASSWORD_REQUIRE_UPPER":  "true",
+		"APP_PASSWORD_ARGON2_MEMORY":  "65536",
+		"APP_PASSWORD_ARGON2_THREADS": "255",
+		"APP_MAIL_DRIVER":             "smtp",
+		"APP_MAIL_SMTP_ADDR":          "mail.example.com:587",
+		"APP_OIDC_SCOPES":             "openid,email",
+	} {
+		t.Setenv(name, value)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != ":9100" || !reflect.DeepEqual(cfg.Server.AllowedOrigins, []string{"https://a.example.com", "https://b.example.com"}) {
+		t.Fatalf("server = %+v", cfg.Server)
+	}
+	if cfg.JWT.TTL != Duration(5*time.Minute) || cfg.Login.MaxFailures != 7 || cfg.Login.Lockout != Duration(time.Hour) {
+		t.Fatalf("jwt = %+v, login = %+v", cfg.JWT, cfg.Login)
+	}
+	if cfg.Password.MinLength != 12 || !cfg.Password.RequireUpper || cfg.Password.Argon2Memory != 65536 || cfg.Password.Argon2Threads != 255 {
+		t.Fatalf("password = %+v", cfg.Password)
+	}
+	if cfg.Mail.Driver != MailDriverSMTP || cfg.Mail.SMTPAddr != "mail.example.com:587" {
+		t.Fatalf("mail = %+v", cfg.Mail)
+	}
+	if !reflect.DeepEqual(cfg.OIDC.Scopes, []string{"openid", "email"}) {
+		t.Fatalf("scopes = %v", cfg.OIDC.Scopes)
+	}
+}
+
+func TestBadEnv(t *testing.T) {
+	tests := []struct{ name, value string }{
+		{"APP_JWT_TTL", "soon"},
+		{"APP_JWT_REFRESH_TTL", "1"},
+		{"APP_PURGE_RETENTION", "forever"},
+		{"APP_PURGE_INTERVAL", "-"},
+		{"APP_LOGIN_MAX_FAILURES", "five"},
+		{"APP_LOGIN_LOCKOUT", "15"},
+		{"APP_PASSWORD_MIN_LENGTH", "8.5"},
+		{"APP_PASSWORD_REQUIRE_DIGIT", "maybe"},
+		{"APP_OIDC_PROVISION", "yes please"},
+		{"APP_PASSWORD_ARGON2_MEMORY", "4294967296"},
+		{"APP_PASSWORD_ARGON2_TIME", "-1"},
+		// argon2_threads เป็น uint8 ค่าที่เกิน 255 ต้องไม่ถูกตัดเหลือ 0
+		{"APP_PASSWORD_ARGON2_THREADS", "256"},
+		{"APP_PASSWORD_ARGON2_THREADS", "-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"="+tt.value, func(t *testing.T) {
+			t.Setenv(tt.name, tt.value)
+			cfg := Default()
+			err := applyEnv(&cfg)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.name+":") {
+				t.Fatalf("err = %v, want an error for %s", err, tt.name)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatalf("default config is invalid: %v", err)
+	}
+
+	// withOIDC เปิด single sign-on ด้วยค่าที่ครบ เพื่อให้แต่ละกรณีผิดแค่ข้อเดียว
+	withOIDC := func(c *Config) {
+		c.OIDC.Issuer = "https://id.example.com"
+		c.OIDC.ClientID = "backend"
+		c.OIDC.RedirectURL = "https://api.example.com/auth/oidc/callback"
+	}
+	tests := []struct {
+		name   string
+		mutate func(c *Config)
+		want   string
+	}{
+		{"server addr", func(c *Config) { c.Server.Addr = "" }, "server.addr is required"},
+		{"database dsn", func(c *Config) { c.Database.DSN = "" }, "database.dsn is required"},
+		{"jwt algorithm", func(c *Config) { c.JWT.Algorithm = "HS256" }, "jwt.algorithm must be RS256 or EdDSA"},
+		{"jwt rotation shorter than ttl", func(c *Config) { c.JWT.RotateEvery = Duration(10 * time.Minute) }, "jwt.rotate_every must be at least 1h"},
+		{"jwt rotation under an hour", func(c *Config) {
+			c.JWT.TTL = Duration(time.Minute)
+			c.JWT.RotateEvery = Duration(30 * time.Minute)
+		}, "jwt.rotate_every must be at least 1h"},
+		{"jwt issuer", func(c *Config) { c.JWT.Issuer = "" }, "jwt.issuer and jwt.audience are required"},
+		{"jwt audience", func(c *Config) { c.JWT.Audience = "" }, "jwt.issuer and jwt.audience are required"},
+		{"jwt ttl", func(c *Config) { c.JWT.TTL = 0 }, "jwt.ttl must be positive"},
+		{"jwt refresh ttl", func(c *Config) { c.JWT.RefreshTTL = c.JWT.TTL }, "jwt.refresh_ttl must be longer than jwt.ttl"},
+		{"purge retention", func(c *Config) { c.Purge.Retention = -1 }, "purge.retention must not be negative"},
+		{"purge interval", func(c *Config) { c.Purge.Interval = 0 }, "purge.interval must be positive"},
+		{"login max failures", func(c *Config) { c.Login.MaxFailures = 0 }, "login.max_failures must be at least 1"},
+		{"login lockout", func(c *Config) { c.Login.Lockout = 0 }, "login.lockout must be positive"},
+		{"login backoff base", func(c *Config) { c.Login.BackoffBase = -1 }, "login.backoff_base must not be negative"},
+		{"login backoff max", func(c *Config) { c.Login.BackoffMax = c.Login.BackoffBase - 1 }, "login.backoff_max must not be shorter"},
+		{"mail file", func(c *Config) { c.Mail.Driver = MailDriverFile }, "mail.file is required for the file driver"},
+		{"mail smtp addr", func(c *Config) { c.Mail.Driver = MailDriverSMTP }, "mail.smtp_addr is required for the smtp driver"},
+		{"mail driver", func(c *Config) { c.Mail.Driver = "sendmail" }, "mail.driver must be log, file or smtp"},
+		{"mail from", func(c *Config) { c.Mail.From = "" }, "mail.from is required"},
+		{"account reset ttl", func(c *Config) { c.Account.ResetTTL = 0 }, "account.reset_ttl and account.verify_ttl must be positive"},
+		{"account verify ttl", func(c *Config) { c.Account.VerifyTTL = 0 }, "account.reset_ttl and account.verify_ttl must be positive"},
+		{"password min length", func(c *Config) { c.Password.MinLength = 0 }, "password.min_length must be at least 1"},
+		{"password max below min", func(c *Config) { c.Password.MaxLength = c.Password.MinLength - 1 }, "password.max_length must be between password.min_length and 1024"},
+		{"password max over argon2id limit", func(c *Config) { c.Password.MaxLength = 1025 }, "password.max_length must be between password.min_length and 1024"},
+		{"password max over bcrypt limit", func(c *Config) {
+			c.Password.Algorithm = PasswordBcrypt
+			c.Password.MaxLength = 73
+		}, "password.max_length must be between password.min_length and 72"},
+		{"password algorithm", func(c *Config) { c.Password.Algorithm = "md5" }, "password.algorithm must be argon2id or bcrypt"},
+		{"bcrypt cost too low", func(c *Config) { c.Password.BcryptCost = 3 }, "password.bcrypt_cost must be between 4 and 31"},
+		{"bcrypt cost too high", func(c *Config) { c.Password.BcryptCost = 32 }, "password.bcrypt_cost must be between 4 and 31"},
+		{"argon2 time", func(c *Config) { c.Password.Argon2Time = 0 }, "password.argon2_time and password.argon2_threads"},
+		{"argon2 threads", func(c *Config) { c.Password.Argon2Threads = 0 }, "password.argon2_time and password.argon2_threads"},
+		{"argon2 memory per thread", func(c *Config) {
+			c.Password.Argon2Threads = 4
+			c.Password.Argon2Memory = 31
+		}, "password.argon2_memory at least 8 KiB per thread"},
+		{"oidc client", func(c *Config) {
+			withOIDC(c)
+			c.OIDC.ClientID = ""
+		}, "oidc.client_id and oidc.redirect_url are required"},
+		{"oidc redirect url", func(c *Config) {
+			withOIDC(c)
+			c.OIDC.RedirectURL = ""
+		}, "oidc.client_id and oidc.redirect_url are required"},
+		{"oidc scopes", func(c *Config) {
+			withOIDC(c)
+			c.OIDC.Scopes = []string{"email"}
+		}, "oidc.scopes must include openid"},
+		{"oidc default role", func(c *Config) {
+			withOIDC(c)
+			c.OIDC.DefaultRole = "superuser"
+		}, "oidc.default_role must be one of admin, team_lead, member"},
+		{"oidc group without name", func(c *Config) {
+			withOIDC(c)
+			c.OIDC.Groups = []OIDCGroup{{Group: "admins", Role: "admin"}, {Role: "admin"}}
+		}, "oidc.groups[1] needs a group and a role or team_id"},
+		{"oidc group without role or team", func(c *Config) {
+			withOIDC(c)
+			c.OIDC.Groups = []OIDCGroup{{Group: "everyone"}}
+		}, "oidc.groups[0] needs a group and a role or team_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.mutate(&cfg)
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("oidc rules apply only when enabled", func(t *testing.T) {
+		cfg := Default()
+		cfg.OIDC.DefaultRole = ""
+		cfg.OIDC.Scopes = nil
+		if err := cfg.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		withOIDC(&cfg)
+		cfg.OIDC.Scopes = []string{"openid"}
+		for _, role := range []string{"admin", "team_lead", "member"} {
+			cfg.OIDC.DefaultRole = role
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("default_role %q: %v", role, err)
+			}
+		}
+	})
+
+	t.Run("every problem is reported", func(t *testing.T) {
+		cfg := Default()
+		cfg.Server.Addr = ""
+		cfg.Mail.From = ""
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), "server.addr is required; mail.from is required") {
+			t.Fatalf("err = %v", err)
+		}
+	})
+}
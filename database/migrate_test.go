@@ -0,0 +1,102 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"empty", "", nil},
+		{"comments and blank lines only", "-- nothing here\n\n  -- indented comment\n", nil},
+		{"single statement", "DROP TABLE users;", []string{"DROP TABLE users"}},
+		{
+			name:   "multi-line statements",
+			script: "-- create\nCREATE TABLE a (\n  id INT\n);\n\nCREATE INDEX idx ON a (id);\n",
+			want:   []string{"CREATE TABLE a (\n  id INT\n)", "CREATE INDEX idx ON a (id)"},
+		},
+		{
+			name:   "comment inside a statement is dropped",
+			script: "ALTER TABLE a\n  -- the new column\n  ADD COLUMN b INT;",
+			want:   []string{"ALTER TABLE a\n  ADD COLUMN b INT"},
+		},
+		{"semicolon in the middle of a line does not split", "UPDATE a SET b = ';' WHERE id = 1;", []string{"UPDATE a SET b = ';' WHERE id = 1"}},
+		{"trailing statement without semicolon", "DELETE FROM a;\nDELETE FROM b", []string{"DELETE FROM a", "DELETE FROM b"}},
+		{"trailing spaces after semicolon", "DELETE FROM a;   \r", []string{"DELETE FROM a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitStatements(tt.script)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("splitStatements(%q) = %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+	// เวอร์ชันต้องเรียงต่อกันตั้งแต่ 1 และทุกเวอร์ชันต้อง rollback ได้
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Fatalf("migration %d has version %d, want %d", i, m.Version, i+1)
+		}
+		if m.Name == "" || len(splitStatements(m.Up)) == 0 || len(splitStatements(m.Down)) == 0 {
+			t.Fatalf("migration %d_%s is incomplete", m.Version, m.Name)
+		}
+	}
+}
+
+func TestLoadMigrationsFromFS(t *testing.T) {
+	file := func(body string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(body)} }
+
+	t.Run("pairs and sorts files", func(t *testing.T) {
+		got, err := loadMigrations(fstest.MapFS{
+			"m/0010_add_index.up.sql":      file("CREATE INDEX i ON t (c);"),
+			"m/0002_create_table.up.sql":   file("CREATE TABLE t (c INT);"),
+			"m/0002_create_table.down.sql": file("DROP TABLE t;"),
+		}, "m")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []Migration{
+			{Version: 2, Name: "create_table", Up: "CREATE TABLE t (c INT);", Down: "DROP TABLE t;"},
+			{Version: 10, Name: "add_index", Up: "CREATE INDEX i ON t (c);"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("migrations = %+v, want %+v", got, want)
+		}
+	})
+
+	for _, tt := range []struct {
+		name  string
+		files fstest.MapFS
+		want  string
+	}{
+		{"unknown suffix", fstest.MapFS{"m/0001_a.sql": file("")}, "expected .up.sql or .down.sql suffix"},
+		{"missing name", fstest.MapFS{"m/0001.up.sql": file("")}, "expected NNNN_name prefix"},
+		{"invalid version", fstest.MapFS{"m/v1_a.up.sql": file("")}, "invalid version"},
+		{"conflicting names", fstest.MapFS{"m/0001_a.up.sql": file("x"), "m/0001_b.down.sql": file("y")}, "conflicting names"},
+		{"missing up file", fstest.MapFS{"m/0001_a.down.sql": file("x")}, "missing up file"},
+		{"missing directory", fstest.MapFS{}, "m"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.files, "m")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS teams (
+    team_id    INT          NOT NULL AUTO_INCREMENT,
+    team_name  VARCHAR(255) NOT NULL,
+    created_at DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (team_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
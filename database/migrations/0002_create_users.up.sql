@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS users (
+    id         INT          NOT NULL AUTO_INCREMENT,
+    username   VARCHAR(100) NOT NULL,
+    password   VARCHAR(255) NOT NULL,
+    firstname  VARCHAR(100) NOT NULL DEFAULT '',
+    lastname   VARCHAR(100) NOT NULL DEFAULT '',
+    email      VARCHAR(255) NOT NULL,
+    phone      VARCHAR(32)  NOT NULL DEFAULT '',
+    role       VARCHAR(32)  NOT NULL DEFAULT '',
+    team_id    INT          NULL,
+    created_at DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY idx_users_team_id (team_id),
+    CONSTRAINT fk_users_team FOREIGN KEY (team_id) REFERENCES teams (team_id) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
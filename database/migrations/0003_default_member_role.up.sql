@@ -0,0 +1,2 @@
+UPDATE users SET role = 'member' WHERE role = '';
+ALTER TABLE users MODIFY role VARCHAR(32) NOT NULL DEFAULT 'member';
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS team_members (
+    team_id   INT         NOT NULL,
+    user_id   INT         NOT NULL,
+    role      VARCHAR(16) NOT NULL DEFAULT 'member',
+    joined_at DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (team_id, user_id),
+    KEY idx_team_members_user (user_id),
+    CONSTRAINT fk_team_members_team FOREIGN KEY (team_id) REFERENCES teams (team_id) ON DELETE CASCADE,
+    CONSTRAINT fk_team_members_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- ทีมเดิมใน users.team_id กลายเป็น membership แรกของผู้ใช้ (team_lead ของระบบเป็น lead ของทีมนั้น)
+INSERT INTO team_members (team_id, user_id, role, joined_at)
+SELECT team_id, id, CASE WHEN role = 'team_lead' THEN 'lead' ELSE 'member' END, created_at
+FROM users
+WHERE team_id IS NOT NULL;
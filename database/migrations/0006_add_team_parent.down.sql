@@ -0,0 +1,2 @@
+ALTER TABLE teams DROP FOREIGN KEY fk_teams_parent;
+ALTER TABLE teams DROP KEY idx_teams_parent, DROP COLUMN parent_team_id;
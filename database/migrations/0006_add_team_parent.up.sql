@@ -0,0 +1,4 @@
+ALTER TABLE teams
+    ADD COLUMN parent_team_id INT NULL AFTER team_name,
+    ADD KEY idx_teams_parent (parent_team_id),
+    ADD CONSTRAINT fk_teams_parent FOREIGN KEY (parent_team_id) REFERENCES teams (team_id) ON DELETE SET NULL;
@@ -0,0 +1,3 @@
+-- แถวที่ถูก soft delete อยู่จะกลับมาแสดงเป็นแถวปกติ ลบออกก่อน rollback ถ้าไม่ต้องการ
+ALTER TABLE users DROP KEY idx_users_deleted_at, DROP COLUMN deleted_at;
+ALTER TABLE teams DROP KEY idx_teams_deleted_at, DROP COLUMN deleted_at;
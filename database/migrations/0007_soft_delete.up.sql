@@ -0,0 +1,7 @@
+ALTER TABLE users
+    ADD COLUMN deleted_at DATETIME NULL,
+    ADD KEY idx_users_deleted_at (deleted_at);
+
+ALTER TABLE teams
+    ADD COLUMN deleted_at DATETIME NULL,
+    ADD KEY idx_teams_deleted_at (deleted_at);
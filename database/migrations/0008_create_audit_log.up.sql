@@ -0,0 +1,16 @@
+-- ไม่มี foreign key ไปยัง users เพื่อให้ประวัติยังอยู่หลังผู้ใช้ถูก purge
+CREATE TABLE IF NOT EXISTS audit_log (
+    id             BIGINT       NOT NULL AUTO_INCREMENT,
+    actor_id       INT          NULL,
+    actor_username VARCHAR(255) NOT NULL DEFAULT '',
+    action         VARCHAR(64)  NOT NULL,
+    entity_type    VARCHAR(32)  NOT NULL,
+    entity_id      INT          NOT NULL,
+    changes        JSON         NOT NULL,
+    ip             VARCHAR(45)  NOT NULL DEFAULT '',
+    created_at     DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY idx_audit_log_entity (entity_type, entity_id),
+    KEY idx_audit_log_actor (actor_id),
+    KEY idx_audit_log_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
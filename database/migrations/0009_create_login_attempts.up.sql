@@ -0,0 +1,8 @@
+-- attempt_key คือ "user:<id>", "identifier:<ค่าที่กรอก>" หรือ "ip:<address>"
+CREATE TABLE IF NOT EXISTS login_attempts (
+    attempt_key     VARCHAR(320) NOT NULL,
+    failures        INT          NOT NULL DEFAULT 0,
+    last_failure_at DATETIME     NOT NULL,
+    locked_until    DATETIME     NULL,
+    PRIMARY KEY (attempt_key)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
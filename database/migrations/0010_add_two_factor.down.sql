@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS recovery_codes;
+ALTER TABLE users DROP COLUMN totp_last_step, DROP COLUMN totp_enabled, DROP COLUMN totp_secret;
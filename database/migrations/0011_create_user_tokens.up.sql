@@ -0,0 +1,16 @@
+ALTER TABLE users ADD COLUMN email_verified_at DATETIME NULL;
+
+-- token สำหรับรีเซ็ตรหัสผ่านและยืนยันอีเมล เก็บเฉพาะ SHA-256 ของ token ที่ส่งทางอีเมล
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id         BIGINT      NOT NULL AUTO_INCREMENT,
+    user_id    INT         NOT NULL,
+    purpose    VARCHAR(32) NOT NULL,
+    token_hash CHAR(64)    NOT NULL,
+    expires_at DATETIME    NOT NULL,
+    used_at    DATETIME    NULL,
+    created_at DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_user_tokens_hash (token_hash),
+    KEY idx_user_tokens_user (user_id, purpose),
+    CONSTRAINT fk_user_tokens_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
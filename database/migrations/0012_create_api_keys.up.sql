@@ -0,0 +1,18 @@
+-- API key ของผู้ใช้สำหรับ script และ CI เก็บเฉพาะ SHA-256 ของ key
+-- scopes คือ permission ที่ key ใช้ได้คั่นด้วยช่องว่าง
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           INT           NOT NULL AUTO_INCREMENT,
+    user_id      INT           NOT NULL,
+    name         VARCHAR(100)  NOT NULL,
+    prefix       VARCHAR(16)   NOT NULL,
+    token_hash   CHAR(64)      NOT NULL,
+    scopes       VARCHAR(1024) NOT NULL,
+    expires_at   DATETIME      NOT NULL,
+    last_used_at DATETIME      NULL,
+    revoked_at   DATETIME      NULL,
+    created_at   DATETIME      NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uq_api_keys_hash (token_hash),
+    KEY idx_api_keys_user (user_id),
+    CONSTRAINT fk_api_keys_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,9 @@
+ALTER TABLE users
+    DROP KEY uq_users_username,
+    DROP KEY uq_users_email,
+    DROP COLUMN active_username,
+    DROP COLUMN active_email;
+
+ALTER TABLE teams
+    DROP KEY uq_teams_team_name,
+    DROP COLUMN active_team_name;
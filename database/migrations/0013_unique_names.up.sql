@@ -0,0 +1,12 @@
+-- username, email และ team_name ต้องไม่ซ้ำเฉพาะในแถวที่ยังไม่ถูกลบ คอลัมน์ generated เป็น NULL เมื่อ soft delete
+-- และ unique index ยอมให้ NULL ซ้ำได้ การเทียบไม่สนตัวพิมพ์ตาม collation ของตาราง
+-- ข้อมูลเดิมที่ซ้ำกันต้องถูกแก้ก่อน ไม่เช่นนั้นการสร้าง index จะล้มเหลว
+ALTER TABLE users
+    ADD COLUMN active_username VARCHAR(100) GENERATED ALWAYS AS (IF(deleted_at IS NULL, username, NULL)) VIRTUAL,
+    ADD COLUMN active_email VARCHAR(255) GENERATED ALWAYS AS (IF(deleted_at IS NULL, email, NULL)) VIRTUAL,
+    ADD UNIQUE KEY uq_users_username (active_username),
+    ADD UNIQUE KEY uq_users_email (active_email);
+
+ALTER TABLE teams
+    ADD COLUMN active_team_name VARCHAR(255) GENERATED ALWAYS AS (IF(deleted_at IS NULL, team_name, NULL)) VIRTUAL,
+    ADD UNIQUE KEY uq_teams_team_name (active_team_name);
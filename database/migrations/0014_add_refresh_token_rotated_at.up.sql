@@ -0,0 +1,3 @@
+-- rotated_at ถูกตั้งเฉพาะเมื่อ token ถูกแทนด้วย token ใหม่จากการ refresh
+-- token ที่ถูก revoke ด้วยเหตุอื่น (logout, เปลี่ยนรหัสผ่าน ฯลฯ) จึงไม่ถูกนับเป็นการใช้ซ้ำ
+ALTER TABLE refresh_tokens ADD COLUMN rotated_at DATETIME NULL AFTER revoked_at;
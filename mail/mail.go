@@ -0,0 +1,72 @@
+// Package mail ส่งอีเมลของระบบ เช่นลิงก์รีเซ็ตรหัสผ่านและยืนยันอีเมล
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang-backend/config"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message คืออีเมลแบบข้อความธรรมดาหนึ่งฉบับ
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer ส่งอีเมล
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New สร้าง Mailer ตาม cfg.Driver
+func New(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case config.MailDriverLog:
+		return NewLogMailer(log.Writer()), nil
+	case config.MailDriverFile:
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("open mail file: %w", err)
+		}
+		return NewLogMailer(f), nil
+	case config.MailDriverSMTP:
+		return NewSMTPMailer(cfg), nil
+	}
+	return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+}
+
+// validHeader ป้องกัน header injection จากค่าที่มาจากผู้ใช้ เช่นอีเมลผู้รับ
+func validHeader(v string) error {
+	if strings.ContainsAny(v, "\r\n") {
+		return errors.New("mail header contains a line break")
+	}
+	return nil
+}
+
+// LogMailer เขียนอีเมลลง writer แทนการส่งจริง ใช้บนเครื่องนักพัฒนาและในการทดสอบ
+type LogMailer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLogMailer(w io.Writer) *LogMailer {
+	return &LogMailer{w: w}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if err := validHeader(msg.To + msg.Subject); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := fmt.Fprintf(m.w, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n---\n", time.Now().Format(time.RFC1123Z), msg.To, msg.Subject, msg.Body)
+	return err
+}
@@ -1,64 +1,65 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"golang-backend/api/login"
-	"golang-backend/api/teams"
-	user "golang-backend/api/users"
+	"golang-backend/config"
 	"golang-backend/database"
 	_ "golang-backend/docs"
-	"golang-backend/middleware" // นำเข้า middleware
+	"golang-backend/mail"
+	"golang-backend/repository/mysql"
+	"golang-backend/signing"
+	"log"
 	"net/http"
-
-	"github.com/gorilla/mux"
-	"github.com/rs/cors"
+	"os"
 )
 
 func main() {
-	// เชื่อมต่อกับฐานข้อมูล
-	database.Connect()
-
-	// ตั้งค่า CORS
-	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000"},
-		AllowedMethods:   []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
-		AllowCredentials: true,
-	})
-
-	// สร้าง router
-	router := mux.NewRouter()
-
-	// เส้นทางหลัก
-	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintln(w, "Welcome to the User Management API!")
-	}).Methods("GET")
+	// โหลด config จากไฟล์และ environment variables
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// เส้นทางจัดการผู้ใช้ (ไม่มีการตรวจสอบ JWT)
-	router.HandleFunc("/login", login.Login).Methods("POST")
+	// subcommand สำหรับจัดการ schema: go run . migrate up|down|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(cfg, os.Args[2:]))
+	}
 
-	// ใช้ middleware JWT สำหรับเส้นทางที่ต้องการ
-	api := router.PathPrefix("/api").Subrouter() // ใช้ subrouter สำหรับ API
-	api.Use(middleware.JWTMiddleware)            // ใช้ middleware
+	// เชื่อมต่อกับฐานข้อมูล
+	database.Connect(cfg.Database)
 
-	api.HandleFunc("/users", user.GetUsers).Methods("GET")
-	api.HandleFunc("/users/{id}", user.GetUserByID).Methods("GET")
-	api.HandleFunc("/users/team/{team_id}", user.GetUsersByTeam).Methods("GET")
-	api.HandleFunc("/users", user.CreateUser).Methods("POST")
-	api.HandleFunc("/users/{id}", user.DeleteUserByID).Methods("DELETE")
-	api.HandleFunc("/users/{id}", user.PatchUser).Methods("PATCH")
-	api.HandleFunc("/teams", teams.GetTeams).Methods("GET")
-	api.HandleFunc("/teams/{id}", teams.GetTeamById).Methods("GET")
-	api.HandleFunc("/teams", teams.CreateTeam).Methods("POST")
-	api.HandleFunc("/teams/{team_id}", teams.PatchTeam).Methods("PATCH")
-	api.HandleFunc("/teams/{team_id}", teams.DeleteTeamById).Methods("DELETE")
+	// สร้าง repository บน MySQL แล้วประกอบ router (ดู routes.go)
+	repos := repositories{
+		users:      mysql.NewUserRepository(database.DB),
+		teams:      mysql.NewTeamRepository(database.DB),
+		members:    mysql.NewTeamMemberRepository(database.DB),
+		tokens:     mysql.NewRefreshTokenRepository(database.DB),
+		audit:      mysql.NewAuditRepository(database.DB),
+		tx:         mysql.NewTransactor(database.DB),
+		attempts:   mysql.NewLoginAttemptRepository(database.DB),
+		twoFactor:  mysql.NewTwoFactorRepository(database.DB),
+		userTokens: mysql.NewUserTokenRepository(database.DB),
+		apiKeys:    mysql.NewAPIKeyRepository(database.DB),
+	}
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// key สำหรับเซ็น JWT ถูกสร้างครั้งแรกและหมุนเวียนตาม jwt.rotate_every
+	keys, err := signing.NewKeySet(cfg.JWT)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go keys.Run(context.Background())
+	handler := newRouter(cfg, repos, mailer, keys)
 
-	// Wrap the router with the CORS handler
-	handler := c.Handler(router)
+	// ลบผู้ใช้และทีมที่ถูก soft delete เกินระยะเวลาเก็บรักษาเป็นระยะ
+	go runPurge(context.Background(), cfg.Purge, repos)
 
-	// Run server on port 8080
-	fmt.Println("Server is running on http://localhost:8080")
-	if err := http.ListenAndServe(":8080", handler); err != nil {
+	// Run server on the configured address
+	fmt.Println("Server is running on", cfg.Server.Addr)
+	if err := http.ListenAndServe(cfg.Server.Addr, handler); err != nil {
 		fmt.Println("Error starting server:", err)
 	}
 }
@@ -0,0 +1,2614 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"golang-backend/api/login"
+	"golang-backend/api/password"
+	"golang-backend/config"
+	"golang-backend/mail"
+	"golang-backend/middleware"
+	"golang-backend/models"
+	"golang-backend/repository"
+	"golang-backend/repository/memory"
+	"golang-backend/signing"
+	"maps"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testServer คือ router จริงจาก newRouter ที่ต่อกับ memory store แทน MySQL
+type testServer struct {
+	t       *testing.T
+	store   *memory.Store
+	handler http.Handler
+	mail    *outbox // อีเมลทุกฉบับที่ระบบส่ง
+	// mailed คือ token ที่ mailedToken คืนไปแล้ว
+	mailed map[string]bool
+}
+
+// outbox เก็บอีเมลที่ LogMailer เขียน อ่านพร้อมกับการส่งอีเมลเบื้องหลังได้
+type outbox struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *outbox) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+func (o *outbox) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+const testPassword = "correct horse battery staple"
+
+// newTestServer สร้าง test server โดยปิดการหน่วงเวลาหลัง login ผิดไว้ (ทุก request มาจาก IP เดียวกัน)
+// และ hash รหัสผ่านด้วยพารามิเตอร์ต่ำสุดให้ทดสอบได้เร็ว configure ใช้ปรับ config เพิ่มเติมก่อนสร้าง router
+func newTestServer(t *testing.T, configure ...func(*config.Config)) *testServer {
+	t.Helper()
+	cfg := config.Default()
+	// EdDSA สร้าง key ได้เร็วกว่า RS256 มาก
+	cfg.JWT.Algorithm = config.JWTEdDSA
+	cfg.Login.BackoffBase = 0
+	cfg.Password.BcryptCost = bcrypt.MinCost
+	cfg.Password.Argon2Memory, cfg.Password.Argon2Time = 64, 1
+	for _, f := range configure {
+		f(&cfg)
+	}
+	keys, err := signing.NewKeySet(cfg.JWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := memory.NewStore()
+	outbox := &outbox{}
+	return &testServer{
+		t:      t,
+		store:  store,
+		mail:   outbox,
+		mailed: map[string]bool{},
+		handler: newRouter(cfg, repositories{
+			users:      store.Users(),
+			teams:      store.Teams(),
+			members:    store.TeamMembers(),
+			tokens:     store.RefreshTokens(),
+			audit:      store.Audit(),
+			tx:         store.Transactor(),
+			attempts:   store.LoginAttempts(),
+			twoFactor:  store.TwoFactor(),
+			userTokens: store.UserTokens(),
+			apiKeys:    store.APIKeys(),
+		}, mail.NewLogMailer(outbox), keys),
+	}
+}
+
+// mailedToken คืน token จากลิงก์ path ในอีเมลฉบับล่าสุดที่ส่งถึง to และยังไม่เคยถูกคืน
+// อีเมลบางฉบับ (เช่นรีเซ็ตรหัสผ่าน) ส่งหลังตอบ request จึงรอได้สูงสุดสองวินาที
+func (s *testServer) mailedToken(to, path string) string {
+	s.t.Helper()
+	link := regexp.MustCompile(regexp.QuoteMeta(path) + `\?token=([\w-]+)`)
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		messages := strings.Split(s.mail.String(), "\n---\n")
+		for i := len(messages) - 1; i >= 0; i-- {
+			if !strings.Contains(messages[i], "\nTo: "+to+"\n") {
+				continue
+			}
+			if m := link.FindStringSubmatch(messages[i]); m != nil {
+				if !s.mailed[m[1]] {
+					s.mailed[m[1]] = true
+					return m[1]
+				}
+				break
+			}
+		}
+	}
+	s.t.Fatalf("no %s link mailed to %s in:\n%s", path, to, s.mail)
+	return ""
+}
+
+// seedUser สร้างผู้ใช้ตรงใน store (ข้าม handler) ด้วยรหัสผ่าน testPassword
+func (s *testServer) seedUser(username, role string, teamID *int) models.User {
+	s.t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	u := models.User{
+		Username: username,
+		Email:    username + "@example.com",
+		Role:     role,
+		Password: string(hash),
+		TeamId:   teamID,
+	}
+	if err := s.store.Users().Create(context.Background(), &u); err != nil {
+		s.t.Fatal(err)
+	}
+	return u
+}
+
+func (s *testServer) seedTeam(name string) models.Team {
+	s.t.Helper()
+	team := models.Team{TeamName: name}
+	if err := s.store.Teams().Create(context.Background(), &team); err != nil {
+		s.t.Fatal(err)
+	}
+	return team
+}
+
+// do ส่ง request ไปยัง router โดย body ที่ไม่ใช่ string จะถูก encode เป็น JSON
+// token ที่ขึ้นต้นด้วย middleware.APIKeyPrefix ถูกส่งเป็น API key แทน JWT
+func (s *testServer) do(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+	return s.doAs("application/json", method, path, token, body)
+}
+
+// doAs ส่ง request แบบเดียวกับ do โดยกำหนด Content-Type เอง
+func (s *testServer) doAs(contentType, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var reader *bytes.Reader
+	switch b := body.(type) {
+	case nil:
+		reader = bytes.NewReader(nil)
+	case string:
+		reader = bytes.NewReader([]byte(b))
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", contentType)
+	switch {
+	case strings.HasPrefix(token, middleware.APIKeyPrefix):
+		req.Header.Set("Authorization", "ApiKey "+token)
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+type session struct {
+	Token        string      `json:"token"`
+	RefreshToken string      `json:"refresh_token"`
+	ExpiresIn    int64       `json:"expires_in"`
+	User         models.User `json:"user"`
+}
+
+// login เข้าสู่ระบบด้วย identifier และคืน session ที่ได้
+func (s *testServer) login(identifier string) session {
+	s.t.Helper()
+	rec := s.do("POST", "/login", "", map[string]string{"identifier": identifier, "password": testPassword})
+	if rec.Code != http.StatusOK {
+		s.t.Fatalf("login %s: status %d: %s", identifier, rec.Code, rec.Body)
+	}
+	var sess session
+	decode(s.t, rec, &sess)
+	return sess
+}
+
+// tokenFor สร้างผู้ใช้ใหม่ตาม role และคืน access token ของเขา
+func (s *testServer) tokenFor(username, role string, teamID *int) (models.User, string) {
+	s.t.Helper()
+	u := s.seedUser(username, role, teamID)
+	return u, s.login(username).Token
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+}
+
+type errorBody struct {
+	Error struct {
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+		RequestID string `json:"request_id"`
+	} `json:"error"`
+}
+
+// expectError ตรวจสอบ status และ error code ของ response
+func expectError(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, status, rec.Body)
+	}
+	var body errorBody
+	decode(t, rec, &body)
+	if body.Error.Code != code {
+		t.Fatalf("error code = %q, want %q", body.Error.Code, code)
+	}
+	if body.Error.RequestID == "" {
+		t.Fatal("error response has no request_id")
+	}
+}
+
+// expectFieldErrors ตรวจว่า response เป็น 422 VALIDATION_FAILED ที่มีข้อผิดพลาดตรงกับ fields (ชื่อ field -> code) ทุกตัว
+func expectFieldErrors(t *testing.T, rec *httptest.ResponseRecorder, fields map[string]string) {
+	t.Helper()
+	expectError(t, rec, http.StatusUnprocessableEntity, "VALIDATION_FAILED")
+	var body struct {
+		Error struct {
+			Details []struct{ Field, Code, Message string }
+		}
+	}
+	decode(t, rec, &body)
+	got := map[string]string{}
+	for _, d := range body.Error.Details {
+		if d.Message == "" {
+			t.Fatalf("field error %q has no message", d.Field)
+		}
+		got[d.Field] = d.Code
+	}
+	if !maps.Equal(got, fields) {
+		t.Fatalf("field errors = %v, want %v", got, fields)
+	}
+}
+
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, status, rec.Body)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	s := newTestServer(t)
+	team := s.seedTeam("Platform")
+	s.seedUser("alice", "member", &team.ID)
+
+	t.Run("username", func(t *testing.T) {
+		sess := s.login("alice")
+		if sess.Token == "" || sess.RefreshToken == "" {
+			t.Fatalf("missing tokens: %+v", sess)
+		}
+		if sess.ExpiresIn != int64((15 * time.Minute).Seconds()) {
+			t.Errorf("expires_in = %d", sess.ExpiresIn)
+		}
+		if sess.User.Username != "alice" || sess.User.Password != "" {
+			t.Errorf("user = %+v", sess.User)
+		}
+		if sess.User.TeamId == nil || *sess.User.TeamId != team.ID {
+			t.Errorf("team_id = %v", sess.User.TeamId)
+		}
+	})
+
+	t.Run("email", func(t *testing.T) {
+		s.login("alice@example.com")
+	})
+
+	cases := []struct {
+		name   string
+		body   interface{}
+		status int
+		code   string
+	}{
+		{"wrong password", map[string]string{"identifier": "alice", "password": "nope"}, http.StatusUnauthorized, "INVALID_CREDENTIALS"},
+		{"unknown user", map[string]string{"identifier": "bob", "password": testPassword}, http.StatusUnauthorized, "INVALID_CREDENTIALS"},
+		{"missing password", map[string]string{"identifier": "alice"}, http.StatusBadRequest, "INVALID_REQUEST"},
+		{"malformed json", "{", http.StatusBadRequest, "INVALID_REQUEST"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			expectError(t, s.do("POST", "/login", "", tc.body), tc.status, tc.code)
+		})
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Login.MaxFailures = 3
+		cfg.Login.Lockout = config.Duration(15 * time.Minute)
+		cfg.Login.BackoffBase = config.Duration(time.Second)
+		cfg.Login.BackoffMax = config.Duration(4 * time.Second)
+	})
+	_, admin := s.tokenFor("root", "admin", nil)
+	_, lead := s.tokenFor("lead", "team_lead", nil)
+	alice := s.seedUser("alice", "member", nil)
+
+	var offset time.Duration
+	s.store.Now = func() time.Time { return time.Now().Add(offset) }
+	advance := func(d time.Duration) { offset += d }
+
+	attempt := func(identifier, password string) *httptest.ResponseRecorder {
+		return s.do("POST", "/login", "", map[string]string{"identifier": identifier, "password": password})
+	}
+
+	t.Run("same message for unknown user and wrong password", func(t *testing.T) {
+		var unknown, wrong errorBody
+		decode(t, attempt("nobody", testPassword), &unknown)
+		advance(time.Minute)
+		decode(t, attempt("alice", "nope"), &wrong)
+		if unknown.Error.Code != "INVALID_CREDENTIALS" || unknown.Error.Message != wrong.Error.Message {
+			t.Fatalf("unknown = %+v, wrong = %+v", unknown.Error, wrong.Error)
+		}
+		advance(time.Minute)
+	})
+
+	t.Run("backoff per identifier and per IP", func(t *testing.T) {
+		expectError(t, attempt("nobody", "x"), http.StatusUnauthorized, "INVALID_CREDENTIALS")
+		rec := attempt("nobody", "x")
+		expectError(t, rec, http.StatusTooManyRequests, "TOO_MANY_ATTEMPTS")
+		if rec.Header().Get("Retry-After") == "" {
+			t.Fatal("missing Retry-After")
+		}
+		// IP เดียวกันแต่ identifier อื่นก็ต้องรอ แม้รหัสผ่านจะถูก
+		expectError(t, attempt("alice", testPassword), http.StatusTooManyRequests, "TOO_MANY_ATTEMPTS")
+
+		// ต่าง IP ไม่ถูกหน่วง
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(`{"identifier":"alice","password":"`+testPassword+`"}`))
+		req.RemoteAddr = "198.51.100.7:4000"
+		rec = httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, req)
+		expectStatus(t, rec, http.StatusOK)
+
+		advance(time.Minute)
+		s.login("alice")
+	})
+
+	t.Run("lockout after max failures", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			expectError(t, attempt("alice", "nope"), http.StatusUnauthorized, "INVALID_CREDENTIALS")
+			advance(10 * time.Second)
+		}
+		rec := attempt("alice", testPassword)
+		expectError(t, rec, http.StatusLocked, "ACCOUNT_LOCKED")
+		if rec.Header().Get("Retry-After") == "" {
+			t.Fatal("missing Retry-After")
+		}
+
+		// identifier ที่ไม่มีอยู่ถูกล็อกเหมือนกัน จึงใช้ตรวจว่าบัญชีมีอยู่ไม่ได้
+		for i := 0; i < 3; i++ {
+			attempt("ghost", "nope")
+			advance(10 * time.Second)
+		}
+		expectError(t, attempt("ghost", "nope"), http.StatusLocked, "ACCOUNT_LOCKED")
+
+		advance(15 * time.Minute)
+		s.login("alice")
+	})
+
+	t.Run("admin unlock", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			attempt("alice@example.com", "nope")
+			advance(10 * time.Second)
+		}
+		expectError(t, attempt("alice", testPassword), http.StatusLocked, "ACCOUNT_LOCKED")
+
+		path := "/api/users/" + strconv.Itoa(alice.ID) + "/unlock"
+		expectError(t, s.do("POST", path, lead, nil), http.StatusForbidden, "FORBIDDEN")
+		expectError(t, s.do("POST", "/api/users/999/unlock", admin, nil), http.StatusNotFound, "USER_NOT_FOUND")
+		expectStatus(t, s.do("POST", path, admin, nil), http.StatusOK)
+		s.login("alice")
+	})
+
+	t.Run("successful login keeps the IP backoff", func(t *testing.T) {
+		from := func(identifier, password string) *httptest.ResponseRecorder {
+			body, _ := json.Marshal(map[string]string{"identifier": identifier, "password": password})
+			req := httptest.NewRequest("POST", "/login", bytes.NewReader(body))
+			req.RemoteAddr = "203.0.113.9:5000"
+			rec := httptest.NewRecorder()
+			s.handler.ServeHTTP(rec, req)
+			return rec
+		}
+		for _, name := range []string{"ghost1", "ghost2", "ghost3"} {
+			expectError(t, from(name, "nope"), http.StatusUnauthorized, "INVALID_CREDENTIALS")
+			advance(10 * time.Second)
+		}
+		// ผู้เดาเข้าบัญชีของตัวเองได้ แต่ตัวนับของ IP ยังอยู่
+		expectStatus(t, from("alice", testPassword), http.StatusOK)
+		expectError(t, from("ghost4", "nope"), http.StatusUnauthorized, "INVALID_CREDENTIALS")
+		// ล้มเหลว 4 ครั้งต้องรอ 4 วินาที (ถ้าตัวนับถูกล้างจะรอเพียง 1 วินาที)
+		advance(2 * time.Second)
+		expectError(t, from("ghost5", "nope"), http.StatusTooManyRequests, "TOO_MANY_ATTEMPTS")
+	})
+}
+
+func TestRefreshAndLogout(t *testing.T) {
+	s := newTestServer(t)
+	s.seedUser("alice", "member", nil)
+	sess := s.login("alice")
+
+	rec := s.do("POST", "/auth/refresh", "", map[string]string{"refresh_token": sess.RefreshToken})
+	expectStatus(t, rec, http.StatusOK)
+	var rotated session
+	decode(t, rec, &rotated)
+	if rotated.RefreshToken == sess.RefreshToken {
+		t.Fatal("refresh token was not rotated")
+	}
+	expectStatus(t, s.do("GET", "/api/me", rotated.Token, nil), http.StatusOK)
+
+	// การใช้ token เดิมซ้ำ revoke ทั้ง family รวมถึง access token ที่ออกไปแล้ว
+	expectError(t, s.do("POST", "/auth/refresh", "", map[string]string{"refresh_token": sess.RefreshToken}), http.StatusUnauthorized, "REFRESH_TOKEN_REUSED")
+	expectError(t, s.do("GET", "/api/me", rotated.Token, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+	// token ล่าสุดถูก revoke พร้อม family แต่ไม่ได้ถูก rotate จึงเป็นเพียง token ที่ใช้ไม่ได้
+	expectError(t, s.do("POST", "/auth/refresh", "", map[string]string{"refresh_token": rotated.RefreshToken}), http.StatusUnauthorized, "INVALID_REFRESH_TOKEN")
+	reuses := func() int {
+		entries, _, err := s.store.Audit().List(context.Background(), repository.AuditFilter{Action: "user.refresh_token_reuse"})
+		if err != nil || len(entries) > 0 && entries[0].EntityID != sess.User.ID {
+			t.Fatalf("audit = %+v, %v", entries, err)
+		}
+		return len(entries)
+	}
+	if n := reuses(); n != 1 {
+		t.Fatalf("reuse audit entries = %d, want 1", n)
+	}
+
+	expectError(t, s.do("POST", "/auth/refresh", "", map[string]string{"refresh_token": "garbage"}), http.StatusUnauthorized, "INVALID_REFRESH_TOKEN")
+	expectError(t, s.do("POST", "/auth/refresh", "", "{}"), http.StatusBadRequest, "INVALID_REQUEST")
+
+	t.Run("logout", func(t *testing.T) {
+		sess := s.login("alice")
+		expectStatus(t, s.do("POST", "/auth/logout", "", map[string]string{"refresh_token": sess.RefreshToken}), http.StatusOK)
+		expectError(t, s.do("GET", "/api/me", sess.Token, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+		// logout ซ้ำยังตอบสำเร็จ
+		expectStatus(t, s.do("POST", "/auth/logout", "", map[string]string{"refresh_token": sess.RefreshToken}), http.StatusOK)
+		// refresh หลัง logout ไม่ใช่การขโมย token
+		expectError(t, s.do("POST", "/auth/refresh", "", map[string]string{"refresh_token": sess.RefreshToken}), http.StatusUnauthorized, "INVALID_REFRESH_TOKEN")
+		if n := reuses(); n != 1 {
+			t.Fatalf("reuse audit entries = %d, want 1", n)
+		}
+	})
+
+	t.Run("logout all", func(t *testing.T) {
+		first := s.login("alice")
+		second := s.login("alice")
+		expectStatus(t, s.do("POST", "/auth/logout-all", "", map[string]string{"refresh_token": second.RefreshToken}), http.StatusOK)
+		expectError(t, s.do("GET", "/api/me", first.Token, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+		expectError(t, s.do("GET", "/api/me", second.Token, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+		expectError(t, s.do("POST", "/auth/logout-all", "", map[string]string{"refresh_token": second.RefreshToken}), http.StatusUnauthorized, "INVALID_REFRESH_TOKEN")
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		sess := s.login("alice")
+		s.store.Now = func() time.Time { return time.Now().Add(31 * 24 * time.Hour) }
+		defer func() { s.store.Now = time.Now }()
+		expectError(t, s.do("POST", "/auth/refresh", "", map[string]string{"refresh_token": sess.RefreshToken}), http.StatusUnauthorized, "REFRESH_TOKEN_EXPIRED")
+	})
+}
+
+func TestJWTRejections(t *testing.T) {
+	s := newTestServer(t)
+	s.seedUser("alice", "member", nil)
+	sess := s.login("alice")
+
+	cases := map[string]string{
+		"missing":   "",
+		"malformed": "not-a-jwt",
+		"tampered":  sess.Token[:len(sess.Token)-2] + "xx",
+	}
+	for name, token := range cases {
+		t.Run(name, func(t *testing.T) {
+			expectError(t, s.do("GET", "/api/users", token, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+		})
+	}
+
+	t.Run("deleted user", func(t *testing.T) {
+		_, admin := s.tokenFor("root", "admin", nil)
+		expectStatus(t, s.do("DELETE", "/api/users/"+strconv.Itoa(sess.User.ID), admin, nil), http.StatusOK)
+		expectError(t, s.do("GET", "/api/me", sess.Token, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+	})
+}
+
+func TestJWKS(t *testing.T) {
+	s := newTestServer(t)
+	s.seedUser("alice", "member", nil)
+	sess := s.login("alice")
+
+	rec := s.do("GET", "/.well-known/jwks.json", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if cc := rec.Header().Get("Cache-Control"); !strings.HasPrefix(cc, "public, max-age=") {
+		t.Fatalf("Cache-Control = %q", cc)
+	}
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	decode(t, rec, &set)
+	if len(set.Keys) != 1 || set.Keys[0]["kty"] != "OKP" || set.Keys[0]["crv"] != "Ed25519" || set.Keys[0]["d"] != "" {
+		t.Fatalf("jwks = %v", set.Keys)
+	}
+
+	// บริการอื่นตรวจ access token ได้ด้วย public key จาก JWKS เพียงอย่างเดียว
+	claims := &login.Claims{}
+	token, err := jwt.ParseWithClaims(sess.Token, claims, func(token *jwt.Token) (interface{}, error) {
+		for _, k := range set.Keys {
+			if k["kid"] == token.Header["kid"] {
+				x, err := base64.RawURLEncoding.DecodeString(k["x"])
+				return ed25519.PublicKey(x), err
+			}
+		}
+		return nil, fmt.Errorf("unknown kid %v", token.Header["kid"])
+	})
+	if err != nil {
+		t.Fatalf("verify with JWKS: %v", err)
+	}
+	if token.Method.Alg() != "EdDSA" || claims.Issuer != "golang-backend" || !claims.VerifyAudience("golang-backend", true) ||
+		claims.UserID != sess.User.ID || claims.SessionID == "" {
+		t.Fatalf("claims = %+v", claims)
+	}
+}
+
+func TestMe(t *testing.T) {
+	s := newTestServer(t)
+	alice, token := s.tokenFor("alice", "member", nil)
+
+	rec := s.do("GET", "/api/me", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var body struct {
+		User models.User `json:"user"`
+	}
+	decode(t, rec, &body)
+	if body.User.ID != alice.ID || body.User.Password != "" {
+		t.Fatalf("user = %+v", body.User)
+	}
+
+	expectStatus(t, s.do("PATCH", "/api/me", token, map[string]string{"firstname": "Alice"}), http.StatusOK)
+	// สมาชิกทั่วไปเปลี่ยน role หรือทีมของตัวเองไม่ได้
+	expectError(t, s.do("PATCH", "/api/me", token, map[string]string{"role": "admin"}), http.StatusForbidden, "FORBIDDEN")
+	expectError(t, s.do("PATCH", "/api/me", token, map[string]interface{}{"team_id": 1}), http.StatusForbidden, "FORBIDDEN")
+}
+
+func TestUserRoutes(t *testing.T) {
+	s := newTestServer(t)
+	team := s.seedTeam("Platform")
+	_, admin := s.tokenFor("root", "admin", nil)
+	_, member := s.tokenFor("mia", "member", &team.ID)
+
+	var created models.User
+	t.Run("create", func(t *testing.T) {
+		rec := s.do("POST", "/api/users", admin, map[string]interface{}{
+			"username": "carol", "password": testPassword, "email": "carol@example.com", "team_id": team.ID,
+		})
+		expectStatus(t, rec, http.StatusCreated)
+		decode(t, rec, &created)
+		if created.ID == 0 || created.Role != "member" || created.Password != "" {
+			t.Fatalf("created = %+v", created)
+		}
+		expectFieldErrors(t, s.do("POST", "/api/users", admin, map[string]string{"username": "x"}), map[string]string{
+			"username": "invalid_format", "password": "required", "email": "required",
+		})
+		expectError(t, s.do("POST", "/api/users", admin, "["), http.StatusBadRequest, "INVALID_REQUEST")
+		expectError(t, s.do("POST", "/api/users", member, map[string]string{"username": "x", "password": "pw", "email": "x@example.com"}), http.StatusForbidden, "FORBIDDEN")
+	})
+
+	t.Run("created user can log in", func(t *testing.T) {
+		rec := s.do("POST", "/login", "", map[string]string{"identifier": "carol", "password": testPassword})
+		expectStatus(t, rec, http.StatusOK)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		rec := s.do("GET", "/api/users?sort=-username&limit=2", member, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var body struct {
+			Users []models.User `json:"users"`
+			Meta  struct{ Limit, Offset, Total int }
+		}
+		decode(t, rec, &body)
+		if body.Meta.Total != 3 || len(body.Users) != 2 || body.Users[0].Username != "root" {
+			t.Fatalf("body = %+v", body)
+		}
+		expectError(t, s.do("GET", "/api/users?sort=password", member, nil), http.StatusBadRequest, "INVALID_QUERY")
+	})
+
+	t.Run("get", func(t *testing.T) {
+		rec := s.do("GET", "/api/users/"+strconv.Itoa(created.ID), member, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var body struct {
+			User models.User `json:"user"`
+		}
+		decode(t, rec, &body)
+		if body.User.Username != "carol" || body.User.TeamName == nil || *body.User.TeamName != "Platform" {
+			t.Fatalf("user = %+v", body.User)
+		}
+		expectError(t, s.do("GET", "/api/users/999", member, nil), http.StatusNotFound, "USER_NOT_FOUND")
+		expectError(t, s.do("GET", "/api/users/abc", member, nil), http.StatusBadRequest, "INVALID_REQUEST")
+	})
+
+	t.Run("by team", func(t *testing.T) {
+		rec := s.do("GET", "/api/users/team/"+strconv.Itoa(team.ID), member, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var body struct {
+			Users []models.User `json:"users"`
+		}
+		decode(t, rec, &body)
+		if len(body.Users) != 2 {
+			t.Fatalf("users = %+v", body.Users)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		path := "/api/users/" + strconv.Itoa(created.ID)
+		expectError(t, s.do("DELETE", path, member, nil), http.StatusForbidden, "FORBIDDEN")
+		expectStatus(t, s.do("DELETE", path, admin, nil), http.StatusOK)
+		expectError(t, s.do("DELETE", path, admin, nil), http.StatusNotFound, "USER_NOT_FOUND")
+	})
+}
+
+func TestUserListFilters(t *testing.T) {
+	s := newTestServer(t)
+	platform := s.seedTeam("Platform")
+	at := func(v string) {
+		ts, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.store.Now = func() time.Time { return ts }
+	}
+	seed := func(username, role, email string, teamID *int) {
+		u := s.seedUser(username, role, teamID)
+		if err := s.store.Users().Update(context.Background(), u.ID, repository.UserUpdate{Email: &email}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	at("2023-06-01T09:00:00Z")
+	s.seedUser("root", "admin", nil)
+	at("2024-01-15T10:00:00Z")
+	seed("ann", "admin", "ann@corp.example", &platform.ID)
+	at("2024-02-01T00:00:00Z")
+	seed("ben", "member", "ben@example.com", &platform.ID)
+	at("2024-02-29T23:59:59Z")
+	seed("cat", "team_lead", "cat@corp.example", nil)
+	at("2024-03-01T00:00:00Z")
+	seed("dan", "member", "dan@example.com", nil)
+	s.store.Now = time.Now
+	admin := s.login("root").Token
+
+	type listBody struct {
+		Users []models.User `json:"users"`
+		Meta  struct{ Limit, Offset, Total int }
+		Links struct {
+			Self       string
+			Next, Prev *string
+		}
+	}
+	list := func(t *testing.T, query string) listBody {
+		t.Helper()
+		rec := s.do("GET", "/api/users?"+query, admin, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var body listBody
+		decode(t, rec, &body)
+		return body
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"role=member", []string{"ben", "dan"}},
+		{"role=team_lead", []string{"cat"}},
+		{"team_id=" + strconv.Itoa(platform.ID), []string{"ann", "ben"}},
+		{"team_id=999", []string{}},
+		{"email_domain=corp.example", []string{"ann", "cat"}},
+		{"email_domain=@CORP.example", []string{"ann", "cat"}},
+		{"role=member&email_domain=example.com", []string{"ben", "dan"}},
+		// วันที่แบบไม่มีเวลานับรวมทั้งวันของทั้งสองขอบ
+		{"created_from=2024-02-01", []string{"ben", "cat", "dan"}},
+		{"created_to=2024-02-29", []string{"ann", "ben", "cat", "root"}},
+		{"created_from=2024-02-01&created_to=2024-02-29", []string{"ben", "cat"}},
+		// RFC3339 รวมวินาทีที่ระบุ
+		{"created_from=2024-03-01T00:00:00Z", []string{"dan"}},
+		{"created_to=2024-02-29T23:59:58Z", []string{"ann", "ben", "root"}},
+		{"created_to=2024-02-29T23:59:59Z", []string{"ann", "ben", "cat", "root"}},
+		{"created_from=2024-03-02", []string{}},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			body := list(t, tc.query+"&sort=username")
+			got := []string{}
+			for _, u := range body.Users {
+				got = append(got, u.Username)
+			}
+			if !slices.Equal(got, tc.want) || body.Meta.Total != len(tc.want) {
+				t.Fatalf("users = %v (total %d), want %v", got, body.Meta.Total, tc.want)
+			}
+		})
+	}
+
+	t.Run("invalid filters", func(t *testing.T) {
+		for _, query := range []string{"team_id=x", "created_from=yesterday", "created_to=2024-13-01", "limit=0", "limit=201", "offset=-1"} {
+			expectError(t, s.do("GET", "/api/users?"+query, admin, nil), http.StatusBadRequest, "INVALID_QUERY")
+		}
+	})
+
+	t.Run("links", func(t *testing.T) {
+		link := func(offset int) *string {
+			l := "/api/users?limit=2&offset=" + strconv.Itoa(offset) + "&sort=username"
+			return &l
+		}
+		for _, tc := range []struct {
+			offset     int
+			users      []string
+			next, prev *string
+		}{
+			{0, []string{"ann", "ben"}, link(2), nil},
+			{2, []string{"cat", "dan"}, link(4), link(0)},
+			{4, []string{"root"}, nil, link(2)},
+			// prev ไม่ติดลบเมื่อ offset ไม่ลงตัวกับ limit
+			{1, []string{"ben", "cat"}, link(3), link(0)},
+		} {
+			body := list(t, "sort=username&limit=2&offset="+strconv.Itoa(tc.offset))
+			var got []string
+			for _, u := range body.Users {
+				got = append(got, u.Username)
+			}
+			if !slices.Equal(got, tc.users) || body.Meta.Total != 5 || body.Meta.Limit != 2 || body.Meta.Offset != tc.offset {
+				t.Fatalf("offset %d: users = %v, meta = %+v", tc.offset, got, body.Meta)
+			}
+			if body.Links.Self != *link(tc.offset) {
+				t.Fatalf("offset %d: self = %q", tc.offset, body.Links.Self)
+			}
+			for name, pair := range map[string][2]*string{"next": {body.Links.Next, tc.next}, "prev": {body.Links.Prev, tc.prev}} {
+				got, want := pair[0], pair[1]
+				if (got == nil) != (want == nil) || (got != nil && *got != *want) {
+					t.Fatalf("offset %d: %s = %v, want %v", tc.offset, name, deref(got), deref(want))
+				}
+			}
+		}
+	})
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return "<nil>"
+	}
+	return *s
+}
+
+func TestUserValidation(t *testing.T) {
+	s := newTestServer(t)
+	_, admin := s.tokenFor("root", "admin", nil)
+
+	expectFieldErrors(t, s.do("POST", "/api/users", admin, map[string]interface{}{
+		"username": "bad name!", "password": testPassword, "email": "Dan <dan@example.com>",
+		"phone": "081-234-5678", "role": "root", "firstname": strings.Repeat("ก", 101), "team_id": 999,
+	}), map[string]string{
+		"username": "invalid_format", "email": "invalid_email", "phone": "invalid_phone",
+		"role": "invalid_role", "firstname": "too_long", "team_id": "not_found",
+	})
+	expectFieldErrors(t, s.do("POST", "/api/users", admin, map[string]interface{}{
+		"username": "dan", "password": testPassword, "email": "dan@localhost", "team_id": "1",
+	}), map[string]string{"email": "invalid_email", "team_id": "invalid_type"})
+
+	rec := s.do("POST", "/api/users", admin, map[string]interface{}{
+		"username": "dan.o-k_1", "password": testPassword, "email": "dan@example.co.th", "phone": "+66812345678", "role": "team_lead",
+	})
+	expectStatus(t, rec, http.StatusCreated)
+	var dan models.User
+	decode(t, rec, &dan)
+	if dan.Phone != "+66812345678" || dan.Role != "team_lead" {
+		t.Fatalf("created = %+v", dan)
+	}
+	expectFieldErrors(t, s.do("PATCH", "/api/users/"+strconv.Itoa(dan.ID), admin, map[string]string{"phone": "12345", "email": "", "username": "ab"}), map[string]string{
+		"phone": "invalid_phone", "email": "invalid_email", "username": "invalid_format",
+	})
+	// phone ว่างคือการล้างค่า
+	expectStatus(t, s.do("PATCH", "/api/users/"+strconv.Itoa(dan.ID), admin, map[string]string{"phone": ""}), http.StatusOK)
+}
+
+func expectConflict(t *testing.T, rec *httptest.ResponseRecorder, field string) {
+	t.Helper()
+	expectError(t, rec, http.StatusConflict, "CONFLICT")
+	var body struct {
+		Error struct {
+			Details []struct{ Field, Code string }
+		}
+	}
+	decode(t, rec, &body)
+	if len(body.Error.Details) != 1 || body.Error.Details[0].Field != field || body.Error.Details[0].Code != "taken" {
+		t.Fatalf("details = %+v, want %s taken", body.Error.Details, field)
+	}
+}
+
+func TestUniqueness(t *testing.T) {
+	s := newTestServer(t)
+	_, admin := s.tokenFor("root", "admin", nil)
+	bob := s.seedUser("bob", "member", nil)
+	carol := s.seedUser("carol", "member", nil)
+	platform := s.seedTeam("Platform")
+	infra := s.seedTeam("Infra")
+
+	t.Run("users", func(t *testing.T) {
+		// เทียบแบบไม่สนตัวพิมพ์เล็กใหญ่
+		expectConflict(t, s.do("POST", "/api/users", admin, map[string]string{
+			"username": "BOB", "password": testPassword, "email": "bobby@example.com",
+		}), "username")
+		expectConflict(t, s.do("POST", "/api/users", admin, map[string]string{
+			"username": "bobby", "password": testPassword, "email": "Bob@Example.com",
+		}), "email")
+		expectConflict(t, s.do("PATCH", "/api/users/"+strconv.Itoa(carol.ID), admin, map[string]string{"username": "bob"}), "username")
+		expectConflict(t, s.do("PATCH", "/api/users/"+strconv.Itoa(carol.ID), admin, map[string]string{"email": "bob@example.com"}), "email")
+		// ค่าเดิมของตัวเองไม่ถือว่าซ้ำ
+		expectStatus(t, s.do("PATCH", "/api/users/"+strconv.Itoa(bob.ID), admin, map[string]string{"username": "Bob"}), http.StatusOK)
+	})
+
+	t.Run("teams", func(t *testing.T) {
+		expectConflict(t, s.do("POST", "/api/teams", admin, map[string]string{"team_name": "platform"}), "team_name")
+		expectConflict(t, s.do("PATCH", "/api/teams/"+strconv.Itoa(infra.ID), admin, map[string]string{"team_name": "Platform"}), "team_name")
+		expectStatus(t, s.do("PATCH", "/api/teams/"+strconv.Itoa(platform.ID), admin, map[string]string{"team_name": "Platform"}), http.StatusOK)
+	})
+
+	t.Run("deleted rows free their names", func(t *testing.T) {
+		expectStatus(t, s.do("DELETE", "/api/users/"+strconv.Itoa(carol.ID), admin, nil), http.StatusOK)
+		rec := s.do("POST", "/api/users", admin, map[string]string{
+			"username": "carol", "password": testPassword, "email": "carol@example.com",
+		})
+		expectStatus(t, rec, http.StatusCreated)
+		// คืนผู้ใช้เดิมไม่ได้ระหว่างที่ชื่อถูกใช้อยู่
+		expectConflict(t, s.do("POST", "/api/users/"+strconv.Itoa(carol.ID)+"/restore", admin, nil), "username")
+
+		expectStatus(t, s.do("DELETE", "/api/teams/"+strconv.Itoa(infra.ID), admin, nil), http.StatusOK)
+		expectStatus(t, s.do("POST", "/api/teams", admin, map[string]string{"team_name": "Infra"}), http.StatusCreated)
+		expectConflict(t, s.do("POST", "/api/teams/"+strconv.Itoa(infra.ID)+"/restore", admin, nil), "team_name")
+	})
+
+	t.Run("availability", func(t *testing.T) {
+		_, member := s.tokenFor("dave", "member", nil)
+		rec := s.do("GET", "/api/users/availability?username=BOB&email=new@example.com", member, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var got map[string]struct {
+			Available bool
+			Reason    string
+		}
+		decode(t, rec, &got)
+		if len(got) != 2 || got["username"].Available || got["username"].Reason != "taken" || !got["email"].Available {
+			t.Fatalf("availability = %+v", got)
+		}
+
+		rec = s.do("GET", "/api/users/availability?username=a", member, nil)
+		expectStatus(t, rec, http.StatusOK)
+		got = nil
+		decode(t, rec, &got)
+		if len(got) != 1 || got["username"].Available || got["username"].Reason != "invalid_format" {
+			t.Fatalf("availability = %+v", got)
+		}
+		expectError(t, s.do("GET", "/api/users/availability", member, nil), http.StatusBadRequest, "INVALID_QUERY")
+	})
+}
+
+func TestPatchUser(t *testing.T) {
+	s := newTestServer(t)
+	team := s.seedTeam("Platform")
+	_, admin := s.tokenFor("root", "admin", nil)
+	bob := s.seedUser("bob", "member", nil)
+	bobSession := s.login("bob")
+	path := "/api/users/" + strconv.Itoa(bob.ID)
+
+	getBob := func() models.User {
+		t.Helper()
+		u, err := s.store.Users().GetByID(context.Background(), bob.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+
+	t.Run("partial update keeps other fields", func(t *testing.T) {
+		expectStatus(t, s.do("PATCH", path, admin, map[string]string{"lastname": "Builder"}), http.StatusOK)
+		u := getBob()
+		if u.LastName != "Builder" || u.Username != "bob" || u.Email != "bob@example.com" {
+			t.Fatalf("user = %+v", u)
+		}
+	})
+
+	t.Run("team assignment and clearing", func(t *testing.T) {
+		expectStatus(t, s.do("PATCH", path, admin, map[string]interface{}{"team_id": team.ID}), http.StatusOK)
+		if u := getBob(); u.TeamId == nil || *u.TeamId != team.ID {
+			t.Fatalf("team_id = %v", u.TeamId)
+		}
+		// token เดิมมี team_id เก่าจึงถูก revoke
+		expectError(t, s.do("GET", "/api/me", bobSession.Token, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+		bobSession = s.login("bob")
+
+		// ส่งทีมเดิมซ้ำไม่ต้อง login ใหม่
+		expectStatus(t, s.do("PATCH", path, admin, map[string]interface{}{"team_id": team.ID, "lastname": "Builder"}), http.StatusOK)
+		expectStatus(t, s.do("GET", "/api/me", bobSession.Token, nil), http.StatusOK)
+
+		expectStatus(t, s.do("PATCH", path, admin, map[string]interface{}{"team_id": nil}), http.StatusOK)
+		if u := getBob(); u.TeamId != nil {
+			t.Fatalf("team_id = %v, want null", *u.TeamId)
+		}
+		expectError(t, s.do("GET", "/api/me", bobSession.Token, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+		bobSession = s.login("bob")
+	})
+
+	t.Run("password", func(t *testing.T) {
+		other := s.login("bob")
+		rec := s.do("POST", "/api/me/api-keys", bobSession.Token, map[string]interface{}{"name": "ci", "scopes": []string{"users:read"}})
+		expectStatus(t, rec, http.StatusCreated)
+		var key struct{ Key string }
+		decode(t, rec, &key)
+
+		// เปลี่ยนรหัสผ่านของตัวเองต้องยืนยันรหัสผ่านเดิม ถ้าไม่ผ่าน session อื่นยังใช้ได้
+		expectFieldErrors(t, s.do("PATCH", path, bobSession.Token, map[string]string{"password": "new-password"}), map[string]string{
+			"current_password": "required",
+		})
+		expectError(t, s.do("PATCH", "/api/me", bobSession.Token, map[string]string{"password": "new-password", "current_password": "wrong"}),
+			http.StatusForbidden, "INVALID_CREDENTIALS")
+		expectStatus(t, s.do("GET", "/api/me", other.Token, nil), http.StatusOK)
+
+		// session อื่นและ API key ถูก revoke แต่ session ที่ใช้เปลี่ยนรหัสผ่านยังใช้ได้
+		expectStatus(t, s.do("PATCH", path, bobSession.Token, map[string]string{"password": "new-password", "current_password": testPassword}), http.StatusOK)
+		expectStatus(t, s.do("GET", "/api/me", bobSession.Token, nil), http.StatusOK)
+		expectError(t, s.do("GET", "/api/me", other.Token, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+		expectError(t, s.do("POST", "/auth/refresh", "", map[string]string{"refresh_token": other.RefreshToken}), http.StatusUnauthorized, "INVALID_REFRESH_TOKEN")
+		expectError(t, s.do("GET", "/api/users", key.Key, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+		expectStatus(t, s.do("POST", "/login", "", map[string]string{"identifier": "bob", "password": "new-password"}), http.StatusOK)
+
+		// admin เปลี่ยนรหัสผ่านให้ ทุก session ของ bob ถูก revoke
+		expectStatus(t, s.do("PATCH", path, admin, map[string]string{"password": "admin-set-password"}), http.StatusOK)
+		expectError(t, s.do("GET", "/api/me", bobSession.Token, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+	})
+
+	t.Run("invalid payloads", func(t *testing.T) {
+		expectError(t, s.do("PATCH", path, admin, map[string]interface{}{}), http.StatusBadRequest, "NO_FIELDS_TO_UPDATE")
+		expectFieldErrors(t, s.do("PATCH", path, admin, map[string]interface{}{"unknown": 1, "id": 7}), map[string]string{
+			"unknown": "unknown_field", "id": "unknown_field",
+		})
+		// ชนิดผิดถูกรายงานพร้อมกันทุก field
+		expectFieldErrors(t, s.do("PATCH", path, admin, map[string]interface{}{"email": 5, "password": 5, "team_id": "x"}), map[string]string{
+			"email": "invalid_type", "password": "invalid_type", "team_id": "invalid_type",
+		})
+		expectFieldErrors(t, s.do("PATCH", path, admin, map[string]interface{}{"role": "root", "password": "", "team_id": 999}), map[string]string{
+			"role": "invalid_role", "password": "required", "team_id": "not_found",
+		})
+		expectError(t, s.do("PATCH", path, admin, "["), http.StatusBadRequest, "INVALID_REQUEST")
+		expectError(t, s.do("PATCH", "/api/users/999", admin, map[string]string{"lastname": "x"}), http.StatusNotFound, "USER_NOT_FOUND")
+	})
+
+	t.Run("other users need users:update", func(t *testing.T) {
+		_, other := s.tokenFor("eve", "member", nil)
+		expectError(t, s.do("PATCH", path, other, map[string]string{"lastname": "x"}), http.StatusForbidden, "FORBIDDEN")
+	})
+
+	t.Run("role change revokes sessions", func(t *testing.T) {
+		rec := s.do("POST", "/login", "", map[string]string{"identifier": "bob", "password": "admin-set-password"})
+		expectStatus(t, rec, http.StatusOK)
+		var sess session
+		decode(t, rec, &sess)
+		expectStatus(t, s.do("PATCH", path, admin, map[string]string{"role": "team_lead"}), http.StatusOK)
+		expectError(t, s.do("GET", "/api/me", sess.Token, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+		if u := getBob(); u.Role != "team_lead" {
+			t.Fatalf("role = %q", u.Role)
+		}
+	})
+}
+
+func TestPatchFormats(t *testing.T) {
+	s := newTestServer(t)
+	team := s.seedTeam("Platform")
+	other := s.seedTeam("Infra")
+	_, admin := s.tokenFor("root", "admin", nil)
+	bob := s.seedUser("bob", "member", &team.ID)
+	path := "/api/users/" + strconv.Itoa(bob.ID)
+	const mergePatch, jsonPatch = "application/merge-patch+json", "application/json-patch+json"
+
+	t.Run("merge patch returns the updated user", func(t *testing.T) {
+		rec := s.doAs(mergePatch, "PATCH", path, admin, `{"lastname": "Builder", "team_id": null}`)
+		expectStatus(t, rec, http.StatusOK)
+		if got := rec.Header().Get("Accept-Patch"); got != mergePatch+", "+jsonPatch {
+			t.Fatalf("Accept-Patch = %q", got)
+		}
+		var u models.User
+		decode(t, rec, &u)
+		if u.ID != bob.ID || u.LastName != "Builder" || u.TeamId != nil || u.FirstName != bob.FirstName {
+			t.Fatalf("user = %+v", u)
+		}
+		// null ใช้ได้เฉพาะ field ที่ล้างค่าได้
+		expectFieldErrors(t, s.doAs(mergePatch, "PATCH", path, admin, `{"username": null}`), map[string]string{"username": "invalid_type"})
+	})
+
+	t.Run("json patch", func(t *testing.T) {
+		rec := s.doAs(jsonPatch, "PATCH", path, admin, []map[string]interface{}{
+			{"op": "test", "path": "/username", "value": "bob"},
+			{"op": "replace", "path": "/firstname", "value": "Robert"},
+			{"op": "add", "path": "/team_id", "value": other.ID},
+			{"op": "copy", "from": "/firstname", "path": "/lastname"},
+		})
+		expectStatus(t, rec, http.StatusOK)
+		var u models.User
+		decode(t, rec, &u)
+		if u.FirstName != "Robert" || u.LastName != "Robert" || u.TeamId == nil || *u.TeamId != other.ID {
+			t.Fatalf("user = %+v", u)
+		}
+
+		expectStatus(t, s.doAs(jsonPatch, "PATCH", path, admin, `[{"op": "remove", "path": "/team_id"}]`), http.StatusOK)
+		if u, _ := s.store.Users().GetByID(context.Background(), bob.ID); u.TeamId != nil {
+			t.Fatalf("team_id = %v, want null", *u.TeamId)
+		}
+
+		// password ไม่อยู่ใน resource แต่เพิ่มได้ด้วย add
+		expectStatus(t, s.doAs(jsonPatch, "PATCH", path, admin, `[{"op": "add", "path": "/password", "value": "new-password"}]`), http.StatusOK)
+		expectStatus(t, s.do("POST", "/login", "", map[string]string{"identifier": "bob", "password": "new-password"}), http.StatusOK)
+	})
+
+	t.Run("json patch errors", func(t *testing.T) {
+		// test ที่ไม่ผ่านทำให้ทั้ง patch ไม่ถูกบันทึก
+		expectError(t, s.doAs(jsonPatch, "PATCH", path, admin, `[
+			{"op": "replace", "path": "/firstname", "value": "Bobby"},
+			{"op": "test", "path": "/role", "value": "admin"}
+		]`), http.StatusConflict, "PATCH_TEST_FAILED")
+		if u, _ := s.store.Users().GetByID(context.Background(), bob.ID); u.FirstName != "Robert" {
+			t.Fatalf("firstname = %q, patch should not be applied", u.FirstName)
+		}
+
+		expectError(t, s.doAs(jsonPatch, "PATCH", path, admin, `{"op": "add"}`), http.StatusBadRequest, "INVALID_PATCH")
+		expectError(t, s.doAs(jsonPatch, "PATCH", path, admin, `[{"op": "replace", "path": "/nickname", "value": "b"}]`), http.StatusBadRequest, "INVALID_PATCH")
+		expectError(t, s.doAs(jsonPatch, "PATCH", path, admin, `[{"op": "add", "path": "/firstname"}]`), http.StatusBadRequest, "INVALID_PATCH")
+		expectError(t, s.doAs(jsonPatch, "PATCH", path, admin, `[{"op": "frobnicate", "path": "/firstname"}]`), http.StatusBadRequest, "INVALID_PATCH")
+		// field ที่อ่านได้อย่างเดียวหรือไม่รู้จักถูกรายงานเหมือน merge patch
+		expectFieldErrors(t, s.doAs(jsonPatch, "PATCH", path, admin, `[
+			{"op": "replace", "path": "/created_at", "value": "2020-01-01 00:00:00"},
+			{"op": "add", "path": "/nickname", "value": "b"},
+			{"op": "remove", "path": "/username"}
+		]`), map[string]string{"created_at": "unknown_field", "nickname": "unknown_field", "username": "invalid_type"})
+		expectError(t, s.doAs(jsonPatch, "PATCH", "/api/users/999", admin, `[]`), http.StatusNotFound, "USER_NOT_FOUND")
+		expectError(t, s.doAs("text/plain", "PATCH", path, admin, `lastname=x`), http.StatusUnsupportedMediaType, "UNSUPPORTED_MEDIA_TYPE")
+	})
+
+	t.Run("teams", func(t *testing.T) {
+		teamPath := "/api/teams/" + strconv.Itoa(other.ID)
+		rec := s.doAs(jsonPatch, "PATCH", teamPath, admin, []map[string]interface{}{
+			{"op": "test", "path": "/parent_team_id", "value": nil},
+			{"op": "replace", "path": "/parent_team_id", "value": team.ID},
+			{"op": "replace", "path": "/team_name", "value": "Infrastructure"},
+		})
+		expectStatus(t, rec, http.StatusOK)
+		var got models.Team
+		decode(t, rec, &got)
+		if got.ID != other.ID || got.TeamName != "Infrastructure" || got.ParentTeamID == nil || *got.ParentTeamID != team.ID {
+			t.Fatalf("team = %+v", got)
+		}
+
+		rec = s.doAs(mergePatch, "PATCH", teamPath, admin, `{"parent_team_id": null}`)
+		expectStatus(t, rec, http.StatusOK)
+		got = models.Team{}
+		decode(t, rec, &got)
+		if got.ParentTeamID != nil {
+			t.Fatalf("parent_team_id = %v, want null", *got.ParentTeamID)
+		}
+		expectFieldErrors(t, s.doAs(mergePatch, "PATCH", teamPath, admin, `{"team_id": 5, "team_name": null}`), map[string]string{
+			"team_id": "unknown_field", "team_name": "invalid_type",
+		})
+		expectError(t, s.doAs(jsonPatch, "PATCH", teamPath, admin, `[{"op": "test", "path": "/team_name", "value": "Infra"}]`), http.StatusConflict, "PATCH_TEST_FAILED")
+	})
+
+	t.Run("test guards concurrent patches", func(t *testing.T) {
+		expectStatus(t, s.doAs(mergePatch, "PATCH", path, admin, `{"lastname": "Builder"}`), http.StatusOK)
+		// patch ทุกตัว test ค่าเดียวกันก่อนแก้ จึงต้องสำเร็จเพียงตัวเดียว (การ hash รหัสผ่านทำให้ request ซ้อนกัน)
+		const n = 8
+		statuses := make([]int, n)
+		var wg sync.WaitGroup
+		for i := range n {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rec := s.doAs(jsonPatch, "PATCH", path, admin, []map[string]interface{}{
+					{"op": "test", "path": "/lastname", "value": "Builder"},
+					{"op": "replace", "path": "/lastname", "value": "Writer " + strconv.Itoa(i)},
+					{"op": "add", "path": "/password", "value": "new-password"},
+				})
+				statuses[i] = rec.Code
+			}()
+		}
+		wg.Wait()
+
+		var ok int
+		for _, status := range statuses {
+			switch status {
+			case http.StatusOK:
+				ok++
+			case http.StatusConflict:
+			default:
+				t.Fatalf("statuses = %v", statuses)
+			}
+		}
+		if ok != 1 {
+			t.Fatalf("statuses = %v, want exactly one success", statuses)
+		}
+	})
+}
+
+func TestTeamRoutes(t *testing.T) {
+	s := newTestServer(t)
+	_, admin := s.tokenFor("root", "admin", nil)
+	_, lead := s.tokenFor("lena", "team_lead", nil)
+	_, member := s.tokenFor("mia", "member", nil)
+
+	var team models.Team
+	t.Run("create", func(t *testing.T) {
+		rec := s.do("POST", "/api/teams", admin, map[string]string{"team_name": "Platform"})
+		expectStatus(t, rec, http.StatusCreated)
+		decode(t, rec, &team)
+		if team.ID == 0 || team.TeamName != "Platform" || team.CreatedAt == "" {
+			t.Fatalf("team = %+v", team)
+		}
+		expectFieldErrors(t, s.do("POST", "/api/teams", admin, map[string]string{}), map[string]string{"team_name": "required"})
+		expectFieldErrors(t, s.do("POST", "/api/teams", admin, map[string]interface{}{"team_name": strings.Repeat("x", 256), "parent_team_id": 999}), map[string]string{
+			"team_name": "too_long", "parent_team_id": "not_found",
+		})
+		expectError(t, s.do("POST", "/api/teams", lead, map[string]string{"team_name": "Ops"}), http.StatusForbidden, "FORBIDDEN")
+	})
+
+	path := "/api/teams/" + strconv.Itoa(team.ID)
+
+	t.Run("list and get", func(t *testing.T) {
+		rec := s.do("GET", "/api/teams", member, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var list struct {
+			Teams []models.Team `json:"teams"`
+		}
+		decode(t, rec, &list)
+		if len(list.Teams) != 1 {
+			t.Fatalf("teams = %+v", list.Teams)
+		}
+		expectStatus(t, s.do("GET", path, member, nil), http.StatusOK)
+		expectError(t, s.do("GET", "/api/teams/999", member, nil), http.StatusNotFound, "TEAM_NOT_FOUND")
+	})
+
+	t.Run("patch", func(t *testing.T) {
+		expectStatus(t, s.do("PATCH", path, lead, map[string]string{"team_name": "Platform Eng"}), http.StatusOK)
+		got, err := s.store.Teams().GetByID(context.Background(), team.ID)
+		if err != nil || got.TeamName != "Platform Eng" || got.CreatedAt != team.CreatedAt {
+			t.Fatalf("team = %+v, err = %v", got, err)
+		}
+		expectError(t, s.do("PATCH", path, lead, map[string]interface{}{}), http.StatusBadRequest, "NO_FIELDS_TO_UPDATE")
+		expectFieldErrors(t, s.do("PATCH", path, lead, map[string]string{"team_name": " "}), map[string]string{"team_name": "required"})
+		expectError(t, s.do("PATCH", path, member, map[string]string{"team_name": "x"}), http.StatusForbidden, "FORBIDDEN")
+		expectError(t, s.do("PATCH", "/api/teams/999", lead, map[string]string{"team_name": "x"}), http.StatusNotFound, "TEAM_NOT_FOUND")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		expectError(t, s.do("DELETE", path, lead, nil), http.StatusForbidden, "FORBIDDEN")
+		expectStatus(t, s.do("DELETE", path, admin, nil), http.StatusOK)
+		expectError(t, s.do("DELETE", path, admin, nil), http.StatusNotFound, "TEAM_NOT_FOUND")
+		expectError(t, s.do("GET", path, admin, nil), http.StatusNotFound, "TEAM_NOT_FOUND")
+	})
+}
+
+func TestSearch(t *testing.T) {
+	s := newTestServer(t)
+	s.seedTeam("Platform")
+	_, token := s.tokenFor("johnny", "member", nil)
+	thai := s.seedUser("somchai", "member", nil)
+	firstName := "สมชาย"
+	if err := s.store.Users().Update(context.Background(), thai.ID, repository.UserUpdate{FirstName: &firstName}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := s.do("GET", "/api/search?q=jhonny", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if !strings.Contains(rec.Body.String(), `"johnny"`) {
+		t.Fatalf("body = %s", rec.Body)
+	}
+	expectError(t, s.do("GET", "/api/search", token, nil), http.StatusBadRequest, "INVALID_REQUEST")
+
+	// ตัวอักษรไทยยาว 3 byte ส่วนต้นของชื่อต้องตัดตามตัวอักษรจึงจะเทียบกับคำค้นที่พิมพ์ผิดได้
+	rec = s.do("GET", "/api/search?q="+url.QueryEscape("สxชา"), token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if !strings.Contains(rec.Body.String(), `"somchai"`) {
+		t.Fatalf("body = %s", rec.Body)
+	}
+}
+
+func TestUnknownRoutes(t *testing.T) {
+	s := newTestServer(t)
+	expectError(t, s.do("GET", "/nope", "", nil), http.StatusNotFound, "NOT_FOUND")
+	expectError(t, s.do("GET", "/login", "", nil), http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED")
+
+	rec := s.do("GET", "/", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if rec.Header().Get("X-Request-ID") == "" {
+		t.Fatal("missing X-Request-ID header")
+	}
+}
+
+func TestTeamMembers(t *testing.T) {
+	s := newTestServer(t)
+	platform := s.seedTeam("Platform")
+	payments := s.seedTeam("Payments")
+	_, admin := s.tokenFor("root", "admin", nil)
+	_, lead := s.tokenFor("lena", "team_lead", nil)
+	_, member := s.tokenFor("mia", "member", nil)
+	bob := s.seedUser("bob", "member", &platform.ID)
+
+	membersPath := func(team models.Team) string { return "/api/teams/" + strconv.Itoa(team.ID) + "/members" }
+	bobPath := func(team models.Team) string { return membersPath(team) + "/" + strconv.Itoa(bob.ID) }
+
+	type memberBody struct {
+		Member models.TeamMember `json:"member"`
+	}
+
+	t.Run("add", func(t *testing.T) {
+		rec := s.do("POST", bobPath(payments), lead, map[string]string{"role": "observer"})
+		expectStatus(t, rec, http.StatusCreated)
+		var body memberBody
+		decode(t, rec, &body)
+		if body.Member.UserID != bob.ID || body.Member.Role != "observer" || body.Member.JoinedAt == "" {
+			t.Fatalf("member = %+v", body.Member)
+		}
+
+		// เพิ่มซ้ำคือการเปลี่ยน role
+		rec = s.do("POST", bobPath(payments), lead, map[string]string{"role": "lead"})
+		expectStatus(t, rec, http.StatusOK)
+		decode(t, rec, &body)
+		if body.Member.Role != "lead" {
+			t.Fatalf("role = %q", body.Member.Role)
+		}
+
+		expectError(t, s.do("POST", bobPath(payments), lead, map[string]string{"role": "owner"}), http.StatusBadRequest, "INVALID_ROLE")
+		expectError(t, s.do("POST", bobPath(payments), member, nil), http.StatusForbidden, "FORBIDDEN")
+		expectError(t, s.do("POST", membersPath(payments)+"/999", lead, nil), http.StatusNotFound, "USER_NOT_FOUND")
+		expectError(t, s.do("POST", "/api/teams/999/members/"+strconv.Itoa(bob.ID), lead, nil), http.StatusNotFound, "TEAM_NOT_FOUND")
+	})
+
+	t.Run("list", func(t *testing.T) {
+		rec := s.do("GET", membersPath(platform), member, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var body struct {
+			Members []models.TeamMember `json:"members"`
+		}
+		decode(t, rec, &body)
+		if len(body.Members) != 1 || body.Members[0].Username != "bob" || body.Members[0].Role != "member" {
+			t.Fatalf("members = %+v", body.Members)
+		}
+	})
+
+	t.Run("user payload lists memberships", func(t *testing.T) {
+		rec := s.do("GET", "/api/users/"+strconv.Itoa(bob.ID), member, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var body struct {
+			User models.User `json:"user"`
+		}
+		decode(t, rec, &body)
+		got := body.User.Memberships
+		if len(got) != 2 || got[0].TeamName != "Platform" || got[1].TeamName != "Payments" || got[1].Role != "lead" {
+			t.Fatalf("memberships = %+v", got)
+		}
+		if body.User.TeamId == nil || *body.User.TeamId != platform.ID {
+			t.Fatalf("team_id = %v", body.User.TeamId)
+		}
+	})
+
+	t.Run("users by team includes secondary teams", func(t *testing.T) {
+		rec := s.do("GET", "/api/users/team/"+strconv.Itoa(payments.ID), member, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var body struct {
+			Users []models.User `json:"users"`
+		}
+		decode(t, rec, &body)
+		if len(body.Users) != 1 || body.Users[0].ID != bob.ID || len(body.Users[0].Memberships) != 2 {
+			t.Fatalf("users = %+v", body.Users)
+		}
+	})
+
+	t.Run("remove primary team", func(t *testing.T) {
+		expectStatus(t, s.do("DELETE", bobPath(platform), lead, nil), http.StatusOK)
+		expectError(t, s.do("DELETE", bobPath(platform), lead, nil), http.StatusNotFound, "MEMBER_NOT_FOUND")
+		u, err := s.store.Users().GetByID(context.Background(), bob.ID)
+		if err != nil || u.TeamId != nil || len(u.Memberships) != 1 {
+			t.Fatalf("user = %+v, err = %v", u, err)
+		}
+	})
+
+	t.Run("deleting a team removes memberships", func(t *testing.T) {
+		expectStatus(t, s.do("DELETE", "/api/teams/"+strconv.Itoa(payments.ID), admin, nil), http.StatusOK)
+		u, err := s.store.Users().GetByID(context.Background(), bob.ID)
+		if err != nil || len(u.Memberships) != 0 {
+			t.Fatalf("user = %+v, err = %v", u, err)
+		}
+	})
+}
+
+func TestTeamHierarchy(t *testing.T) {
+	s := newTestServer(t)
+	_, admin := s.tokenFor("root", "admin", nil)
+
+	create := func(name string, parent *int) models.Team {
+		t.Helper()
+		rec := s.do("POST", "/api/teams", admin, map[string]interface{}{"team_name": name, "parent_team_id": parent})
+		expectStatus(t, rec, http.StatusCreated)
+		var team models.Team
+		decode(t, rec, &team)
+		return team
+	}
+	names := func(rec *httptest.ResponseRecorder) []string {
+		t.Helper()
+		expectStatus(t, rec, http.StatusOK)
+		var body struct {
+			Teams []models.Team `json:"teams"`
+		}
+		decode(t, rec, &body)
+		var out []string
+		for _, team := range body.Teams {
+			out = append(out, team.TeamName)
+		}
+		return out
+	}
+
+	eng := create("Engineering", nil)
+	platform := create("Platform", &eng.ID)
+	infra := create("Infra", &platform.ID)
+	payments := create("Payments", &eng.ID)
+	sales := create("Sales", nil)
+
+	teamPath := func(team models.Team) string { return "/api/teams/" + strconv.Itoa(team.ID) }
+
+	t.Run("ancestors", func(t *testing.T) {
+		got := strings.Join(names(s.do("GET", teamPath(infra)+"/ancestors", admin, nil)), ",")
+		if got != "Engineering,Platform" {
+			t.Fatalf("ancestors = %s", got)
+		}
+		expectError(t, s.do("GET", "/api/teams/999/ancestors", admin, nil), http.StatusNotFound, "TEAM_NOT_FOUND")
+	})
+
+	t.Run("descendants", func(t *testing.T) {
+		got := strings.Join(names(s.do("GET", teamPath(eng)+"/descendants", admin, nil)), ",")
+		if got != "Platform,Payments,Infra" {
+			t.Fatalf("descendants = %s", got)
+		}
+	})
+
+	t.Run("tree", func(t *testing.T) {
+		rec := s.do("GET", "/api/teams/tree", admin, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var body struct {
+			Teams []models.TeamNode `json:"teams"`
+		}
+		decode(t, rec, &body)
+		if len(body.Teams) != 2 || body.Teams[0].TeamName != "Engineering" || body.Teams[1].TeamName != "Sales" {
+			t.Fatalf("roots = %+v", body.Teams)
+		}
+		children := body.Teams[0].Children
+		if len(children) != 2 || len(children[0].Children) != 1 || children[0].Children[0].TeamName != "Infra" {
+			t.Fatalf("children = %+v", children)
+		}
+	})
+
+	t.Run("cycle prevention", func(t *testing.T) {
+		expectError(t, s.do("PATCH", teamPath(eng), admin, map[string]interface{}{"parent_team_id": infra.ID}), http.StatusConflict, "TEAM_CYCLE")
+		expectError(t, s.do("PATCH", teamPath(eng), admin, map[string]interface{}{"parent_team_id": eng.ID}), http.StatusConflict, "TEAM_CYCLE")
+		expectFieldErrors(t, s.do("PATCH", teamPath(eng), admin, map[string]interface{}{"parent_team_id": 999}), map[string]string{"parent_team_id": "not_found"})
+		expectFieldErrors(t, s.do("PATCH", teamPath(eng), admin, map[string]interface{}{"parent_team_id": "x"}), map[string]string{"parent_team_id": "invalid_type"})
+
+		// ย้ายไปใต้ทีมอื่นที่ไม่ใช่ทีมย่อยได้ และย้ายกลับเป็นระดับบนสุดด้วย null
+		expectStatus(t, s.do("PATCH", teamPath(payments), admin, map[string]interface{}{"parent_team_id": sales.ID}), http.StatusOK)
+		got := strings.Join(names(s.do("GET", teamPath(payments)+"/ancestors", admin, nil)), ",")
+		if got != "Sales" {
+			t.Fatalf("ancestors after move = %s", got)
+		}
+		expectStatus(t, s.do("PATCH", teamPath(payments), admin, map[string]interface{}{"parent_team_id": nil}), http.StatusOK)
+		team, _ := s.store.Teams().GetByID(context.Background(), payments.ID)
+		if team.ParentTeamID != nil || team.TeamName != "Payments" {
+			t.Fatalf("team = %+v", team)
+		}
+	})
+
+	t.Run("recursive users by team", func(t *testing.T) {
+		s.seedUser("ava", "member", &eng.ID)
+		s.seedUser("ian", "member", &infra.ID)
+		s.seedUser("sam", "member", &sales.ID)
+
+		users := func(query string) int {
+			rec := s.do("GET", "/api/users/team/"+strconv.Itoa(eng.ID)+query, admin, nil)
+			expectStatus(t, rec, http.StatusOK)
+			var body struct {
+				Users []models.User `json:"users"`
+			}
+			decode(t, rec, &body)
+			return len(body.Users)
+		}
+		if n := users(""); n != 1 {
+			t.Fatalf("direct members = %d, want 1", n)
+		}
+		if n := users("?recursive=true"); n != 2 {
+			t.Fatalf("recursive members = %d, want 2", n)
+		}
+		expectError(t, s.do("GET", "/api/users/team/"+strconv.Itoa(eng.ID)+"?recursive=maybe", admin, nil), http.StatusBadRequest, "INVALID_QUERY")
+		expectError(t, s.do("GET", "/api/users/team/999", admin, nil), http.StatusNotFound, "TEAM_NOT_FOUND")
+	})
+
+	t.Run("deleted parents are skipped", func(t *testing.T) {
+		expectStatus(t, s.do("DELETE", teamPath(platform), admin, nil), http.StatusOK)
+		got := strings.Join(names(s.do("GET", teamPath(infra)+"/ancestors", admin, nil)), ",")
+		if got != "Engineering" {
+			t.Fatalf("ancestors = %s", got)
+		}
+
+		// ทีมย่อยและสมาชิกใต้ทีมที่ถูกลบไม่ถูกรวม
+		if got := names(s.do("GET", teamPath(eng)+"/descendants", admin, nil)); len(got) != 0 {
+			t.Fatalf("descendants = %v", got)
+		}
+		rec := s.do("GET", "/api/users/team/"+strconv.Itoa(eng.ID)+"?recursive=true", admin, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var body struct {
+			Users []models.User `json:"users"`
+		}
+		decode(t, rec, &body)
+		if len(body.Users) != 1 || body.Users[0].Username != "ava" {
+			t.Fatalf("recursive members = %+v", body.Users)
+		}
+		expectError(t, s.do("GET", "/api/users/team/"+strconv.Itoa(platform.ID), admin, nil), http.StatusNotFound, "TEAM_NOT_FOUND")
+	})
+
+	t.Run("cycle check walks the locked ancestors", func(t *testing.T) {
+		// สายทีมแม่ของ Infra ผ่าน Platform ที่ถูกลบไปแล้วขึ้นไปถึง Engineering ซึ่งการหาทีมย่อยมองไม่เห็น
+		expectError(t, s.do("PATCH", teamPath(eng), admin, map[string]interface{}{"parent_team_id": infra.ID}), http.StatusConflict, "TEAM_CYCLE")
+		// การสลับทีมแม่ของสองทีม: ย้ายครั้งแรกได้ ครั้งที่สองจะทำให้วน
+		expectStatus(t, s.do("PATCH", teamPath(sales), admin, map[string]interface{}{"parent_team_id": payments.ID}), http.StatusOK)
+		expectError(t, s.do("PATCH", teamPath(payments), admin, map[string]interface{}{"parent_team_id": sales.ID}), http.StatusConflict, "TEAM_CYCLE")
+		team, err := s.store.Teams().GetByID(context.Background(), payments.ID)
+		if err != nil || team.ParentTeamID != nil {
+			t.Fatalf("team = %+v, err = %v", team, err)
+		}
+	})
+}
+
+func TestSoftDelete(t *testing.T) {
+	s := newTestServer(t)
+	team := s.seedTeam("Platform")
+	child := models.Team{TeamName: "Infra", ParentTeamID: &team.ID}
+	if err := s.store.Teams().Create(context.Background(), &child); err != nil {
+		t.Fatal(err)
+	}
+	_, admin := s.tokenFor("root", "admin", nil)
+	_, lead := s.tokenFor("lena", "team_lead", nil)
+	bob := s.seedUser("bob", "member", &team.ID)
+	bobSession := s.login("bob")
+
+	userPath := "/api/users/" + strconv.Itoa(bob.ID)
+	teamPath := "/api/teams/" + strconv.Itoa(team.ID)
+
+	countUsers := func(query string) int {
+		t.Helper()
+		rec := s.do("GET", "/api/users"+query, admin, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var body struct {
+			Meta struct{ Total int }
+		}
+		decode(t, rec, &body)
+		return body.Meta.Total
+	}
+
+	t.Run("deleted user is hidden and logged out", func(t *testing.T) {
+		expectStatus(t, s.do("DELETE", userPath, admin, nil), http.StatusOK)
+		expectError(t, s.do("GET", userPath, admin, nil), http.StatusNotFound, "USER_NOT_FOUND")
+		expectError(t, s.do("GET", "/api/me", bobSession.Token, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+		expectError(t, s.do("POST", "/login", "", map[string]string{"identifier": "bob", "password": testPassword}), http.StatusUnauthorized, "INVALID_CREDENTIALS")
+		if n := countUsers(""); n != 2 {
+			t.Fatalf("total = %d, want 2", n)
+		}
+		if n := countUsers("?include_deleted=true"); n != 3 {
+			t.Fatalf("total with deleted = %d, want 3", n)
+		}
+		expectError(t, s.do("GET", "/api/users?include_deleted=true", lead, nil), http.StatusForbidden, "FORBIDDEN")
+	})
+
+	t.Run("restore user", func(t *testing.T) {
+		expectError(t, s.do("POST", userPath+"/restore", lead, nil), http.StatusForbidden, "FORBIDDEN")
+		rec := s.do("POST", userPath+"/restore", admin, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var u models.User
+		decode(t, rec, &u)
+		if u.ID != bob.ID || u.DeletedAt != nil || u.TeamId == nil || len(u.Memberships) != 1 {
+			t.Fatalf("user = %+v", u)
+		}
+		expectError(t, s.do("POST", userPath+"/restore", admin, nil), http.StatusNotFound, "USER_NOT_FOUND")
+		s.login("bob")
+	})
+
+	t.Run("deleted team is hidden", func(t *testing.T) {
+		expectStatus(t, s.do("DELETE", teamPath, admin, nil), http.StatusOK)
+		rec := s.do("GET", "/api/teams", lead, nil)
+		expectStatus(t, rec, http.StatusOK)
+		if strings.Contains(rec.Body.String(), `"Platform"`) {
+			t.Fatalf("deleted team listed: %s", rec.Body)
+		}
+		rec = s.do("GET", "/api/teams?include_deleted=1", admin, nil)
+		expectStatus(t, rec, http.StatusOK)
+		if !strings.Contains(rec.Body.String(), `"deleted_at"`) {
+			t.Fatalf("deleted team missing: %s", rec.Body)
+		}
+		expectError(t, s.do("GET", "/api/teams?include_deleted=true", lead, nil), http.StatusForbidden, "FORBIDDEN")
+		expectError(t, s.do("PATCH", teamPath, admin, map[string]string{"team_name": "x"}), http.StatusNotFound, "TEAM_NOT_FOUND")
+
+		// ทีมหลักที่ถูกลบไม่แสดงในข้อมูลผู้ใช้ เช่นเดียวกับ memberships
+		rec = s.do("GET", userPath, admin, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var body struct {
+			User models.User `json:"user"`
+		}
+		decode(t, rec, &body)
+		if u := body.User; u.ID != bob.ID || u.TeamId != nil || u.TeamName != nil || len(u.Memberships) != 0 {
+			t.Fatalf("user = %+v", u)
+		}
+	})
+
+	t.Run("restore team keeps members", func(t *testing.T) {
+		rec := s.do("POST", teamPath+"/restore", admin, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var got models.Team
+		decode(t, rec, &got)
+		if got.ID != team.ID || got.TeamName != "Platform" || got.DeletedAt != nil {
+			t.Fatalf("team = %+v", got)
+		}
+		rec = s.do("GET", userPath, admin, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var body struct {
+			User models.User `json:"user"`
+		}
+		decode(t, rec, &body)
+		if u := body.User; u.TeamId == nil || *u.TeamId != team.ID || u.TeamName == nil || *u.TeamName != "Platform" {
+			t.Fatalf("user = %+v", u)
+		}
+		members, err := s.store.TeamMembers().ListByTeam(context.Background(), team.ID)
+		if err != nil || len(members) != 1 {
+			t.Fatalf("members = %+v, err = %v", members, err)
+		}
+		expectError(t, s.do("POST", teamPath+"/restore", admin, nil), http.StatusNotFound, "TEAM_NOT_FOUND")
+	})
+
+	t.Run("purge after retention", func(t *testing.T) {
+		expectStatus(t, s.do("DELETE", userPath, admin, nil), http.StatusOK)
+		expectStatus(t, s.do("DELETE", teamPath, admin, nil), http.StatusOK)
+		repos := repositories{users: s.store.Users(), teams: s.store.Teams()}
+		ctx := context.Background()
+
+		// ยังไม่พ้นระยะเวลาเก็บรักษา
+		purgeDeleted(ctx, time.Hour, repos)
+		expectStatus(t, s.do("POST", userPath+"/restore", admin, nil), http.StatusOK)
+		expectStatus(t, s.do("DELETE", userPath, admin, nil), http.StatusOK)
+
+		s.store.Now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+		defer func() { s.store.Now = time.Now }()
+		purgeDeleted(ctx, time.Hour, repos)
+
+		expectError(t, s.do("POST", userPath+"/restore", admin, nil), http.StatusNotFound, "USER_NOT_FOUND")
+		expectError(t, s.do("POST", teamPath+"/restore", admin, nil), http.StatusNotFound, "TEAM_NOT_FOUND")
+		got, err := s.store.Teams().GetByID(ctx, child.ID)
+		if err != nil || got.ParentTeamID != nil {
+			t.Fatalf("child = %+v, err = %v", got, err)
+		}
+	})
+}
+
+func TestAuditLog(t *testing.T) {
+	s := newTestServer(t)
+	adminUser, admin := s.tokenFor("root", "admin", nil)
+	_, lead := s.tokenFor("lead", "team_lead", nil)
+
+	type entries struct {
+		Entries []models.AuditEntry `json:"entries"`
+		Meta    struct {
+			Total int `json:"total"`
+		} `json:"meta"`
+	}
+	list := func(query string) entries {
+		t.Helper()
+		rec := s.do("GET", "/api/audit"+query, admin, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var body entries
+		decode(t, rec, &body)
+		return body
+	}
+
+	rec := s.do("POST", "/api/users", admin, map[string]string{"username": "carol", "email": "carol@example.com", "password": testPassword})
+	expectStatus(t, rec, http.StatusCreated)
+	var carol models.User
+	decode(t, rec, &carol)
+	carolPath := "/api/users/" + strconv.Itoa(carol.ID)
+
+	rec = s.do("POST", "/api/teams", admin, map[string]string{"team_name": "Platform"})
+	expectStatus(t, rec, http.StatusCreated)
+	var team models.Team
+	decode(t, rec, &team)
+	teamPath := "/api/teams/" + strconv.Itoa(team.ID)
+
+	expectStatus(t, s.do("PATCH", carolPath, admin, map[string]string{"firstname": "Carol", "password": "new password"}), http.StatusOK)
+	expectStatus(t, s.do("PATCH", teamPath, admin, map[string]string{"team_name": "Core"}), http.StatusOK)
+	expectStatus(t, s.do("POST", teamPath+"/members/"+strconv.Itoa(carol.ID), admin, nil), http.StatusCreated)
+	expectStatus(t, s.do("DELETE", teamPath+"/members/"+strconv.Itoa(carol.ID), admin, nil), http.StatusOK)
+	expectStatus(t, s.do("DELETE", carolPath, admin, nil), http.StatusOK)
+	expectStatus(t, s.do("DELETE", teamPath, admin, nil), http.StatusOK)
+
+	t.Run("records every mutation newest first", func(t *testing.T) {
+		body := list("")
+		want := []string{"team.delete", "user.delete", "team.member_remove", "team.member_add", "team.update", "user.update", "team.create", "user.create"}
+		if body.Meta.Total != len(want) {
+			t.Fatalf("total = %d, want %d", body.Meta.Total, len(want))
+		}
+		for i, e := range body.Entries {
+			if e.Action != want[i] {
+				t.Fatalf("entry %d = %s, want %s", i, e.Action, want[i])
+			}
+			if e.ActorID == nil || *e.ActorID != adminUser.ID || e.ActorUsername != "root" || e.IP == "" || e.CreatedAt == "" {
+				t.Fatalf("entry %d = %+v", i, e)
+			}
+		}
+	})
+
+	t.Run("field level diff", func(t *testing.T) {
+		body := list("?action=user.update")
+		if len(body.Entries) != 1 {
+			t.Fatalf("entries = %+v", body.Entries)
+		}
+		changes := body.Entries[0].Changes
+		if len(changes) != 2 || changes["firstname"].From != "" || changes["firstname"].To != "Carol" {
+			t.Fatalf("changes = %+v", changes)
+		}
+		if changes["password"].To != "[redacted]" {
+			t.Fatalf("password change = %+v", changes["password"])
+		}
+
+		body = list("?action=team.update")
+		if c := body.Entries[0].Changes; len(c) != 1 || c["team_name"].From != "Platform" || c["team_name"].To != "Core" {
+			t.Fatalf("changes = %+v", c)
+		}
+		body = list("?action=user.create")
+		if c := body.Entries[0].Changes; c["username"].From != nil || c["username"].To != "carol" {
+			t.Fatalf("changes = %+v", c)
+		}
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		if body := list("?entity_type=team&entity_id=" + strconv.Itoa(team.ID)); body.Meta.Total != 5 {
+			t.Fatalf("team entries = %d, want 5", body.Meta.Total)
+		}
+		if body := list("?actor_id=" + strconv.Itoa(adminUser.ID) + "&limit=2"); body.Meta.Total != 8 || len(body.Entries) != 2 {
+			t.Fatalf("actor entries = %+v", body)
+		}
+		if body := list("?to=2000-01-01"); body.Meta.Total != 0 {
+			t.Fatalf("old entries = %d", body.Meta.Total)
+		}
+		expectError(t, s.do("GET", "/api/audit?entity_id=x", admin, nil), http.StatusBadRequest, "INVALID_QUERY")
+	})
+
+	t.Run("admin only", func(t *testing.T) {
+		expectError(t, s.do("GET", "/api/audit", lead, nil), http.StatusForbidden, "FORBIDDEN")
+	})
+
+	t.Run("failed request leaves no entry", func(t *testing.T) {
+		expectError(t, s.do("PATCH", "/api/users/999", admin, map[string]string{"firstname": "x"}), http.StatusNotFound, "USER_NOT_FOUND")
+		if body := list(""); body.Meta.Total != 8 {
+			t.Fatalf("total = %d, want 8", body.Meta.Total)
+		}
+	})
+
+	t.Run("rollback discards changes", func(t *testing.T) {
+		ctx := context.Background()
+		err := s.store.Transactor().WithinTx(ctx, func(ctx context.Context) error {
+			u := models.User{Username: "ghost", Email: "ghost@example.com", Role: "member"}
+			if err := s.store.Users().Create(ctx, &u); err != nil {
+				return err
+			}
+			return context.Canceled
+		})
+		if err != context.Canceled {
+			t.Fatalf("err = %v", err)
+		}
+		if _, err := s.store.Users().GetByIdentifier(ctx, "ghost"); err == nil {
+			t.Fatal("user created inside a failed transaction")
+		}
+	})
+}
+
+func TestTwoFactor(t *testing.T) {
+	s := newTestServer(t)
+	alice, token := s.tokenFor("alice", "member", nil)
+
+	code := func(secret string, offset time.Duration) string {
+		t.Helper()
+		c, err := login.TOTPCode(secret, time.Now().Add(offset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	var secret, firstCode string
+	var recovery []string
+
+	t.Run("enroll and activate", func(t *testing.T) {
+		expectError(t, s.do("POST", "/api/me/2fa/verify", token, map[string]string{"code": "123456"}), http.StatusConflict, "TWO_FACTOR_NOT_ENABLED")
+
+		rec := s.do("POST", "/api/me/2fa/enroll", token, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var enroll struct {
+			Secret     string `json:"secret"`
+			OtpauthURI string `json:"otpauth_uri"`
+		}
+		decode(t, rec, &enroll)
+		secret = enroll.Secret
+		if secret == "" || !strings.HasPrefix(enroll.OtpauthURI, "otpauth://totp/") || !strings.Contains(enroll.OtpauthURI, "secret="+secret) {
+			t.Fatalf("enroll = %+v", enroll)
+		}
+
+		// ยังไม่เปิดใช้จนกว่าจะยืนยันรหัสแรก login จึงยังได้ token ตามปกติ
+		s.login("alice")
+
+		expectError(t, s.do("POST", "/api/me/2fa/verify", token, map[string]string{"code": "000000"}), http.StatusBadRequest, "INVALID_TWO_FACTOR_CODE")
+		firstCode = code(secret, 0)
+		rec = s.do("POST", "/api/me/2fa/verify", token, map[string]string{"code": firstCode})
+		expectStatus(t, rec, http.StatusOK)
+		var activated struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		}
+		decode(t, rec, &activated)
+		recovery = activated.RecoveryCodes
+		if len(recovery) != login.RecoveryCodeCount {
+			t.Fatalf("recovery codes = %v", recovery)
+		}
+
+		expectError(t, s.do("POST", "/api/me/2fa/enroll", token, nil), http.StatusConflict, "TWO_FACTOR_ALREADY_ENABLED")
+		rec = s.do("GET", "/api/me", token, nil)
+		if !strings.Contains(rec.Body.String(), `"two_factor_enabled":true`) {
+			t.Fatalf("me = %s", rec.Body)
+		}
+	})
+
+	challenge := func() string {
+		t.Helper()
+		rec := s.do("POST", "/login", "", map[string]string{"identifier": "alice", "password": testPassword})
+		expectStatus(t, rec, http.StatusOK)
+		var body struct {
+			TwoFactorRequired bool   `json:"two_factor_required"`
+			ChallengeToken    string `json:"challenge_token"`
+			Token             string `json:"token"`
+		}
+		decode(t, rec, &body)
+		if !body.TwoFactorRequired || body.ChallengeToken == "" || body.Token != "" {
+			t.Fatalf("login = %s", rec.Body)
+		}
+		return body.ChallengeToken
+	}
+
+	t.Run("login requires a second factor", func(t *testing.T) {
+		ch := challenge()
+		// challenge token ใช้แทน access token ไม่ได้
+		expectError(t, s.do("GET", "/api/me", ch, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+		expectError(t, s.do("POST", "/auth/2fa", "", map[string]string{"challenge_token": token, "code": code(secret, 0)}), http.StatusUnauthorized, "INVALID_CHALLENGE")
+		expectError(t, s.do("POST", "/auth/2fa", "", map[string]string{"challenge_token": ch, "code": "000000"}), http.StatusUnauthorized, "INVALID_TWO_FACTOR_CODE")
+
+		// รหัสของ time step ที่ใช้ยืนยันตอนเปิด 2FA ใช้ซ้ำไม่ได้
+		expectError(t, s.do("POST", "/auth/2fa", "", map[string]string{"challenge_token": ch, "code": firstCode}), http.StatusUnauthorized, "INVALID_TWO_FACTOR_CODE")
+
+		rec := s.do("POST", "/auth/2fa", "", map[string]string{"challenge_token": ch, "code": code(secret, 30*time.Second)})
+		expectStatus(t, rec, http.StatusOK)
+		var sess session
+		decode(t, rec, &sess)
+		expectStatus(t, s.do("GET", "/api/me", sess.Token, nil), http.StatusOK)
+	})
+
+	t.Run("recovery codes are single use", func(t *testing.T) {
+		rec := s.do("POST", "/auth/2fa", "", map[string]string{"challenge_token": challenge(), "code": strings.ToUpper(recovery[0])})
+		expectStatus(t, rec, http.StatusOK)
+		expectError(t, s.do("POST", "/auth/2fa", "", map[string]string{"challenge_token": challenge(), "code": recovery[0]}), http.StatusUnauthorized, "INVALID_TWO_FACTOR_CODE")
+
+		rec = s.do("GET", "/api/me/2fa", token, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var status struct {
+			Enabled           bool `json:"enabled"`
+			RecoveryCodesLeft int  `json:"recovery_codes_left"`
+		}
+		decode(t, rec, &status)
+		if !status.Enabled || status.RecoveryCodesLeft != login.RecoveryCodeCount-1 {
+			t.Fatalf("status = %+v", status)
+		}
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		expectError(t, s.do("DELETE", "/api/me/2fa", token, map[string]string{"code": "000000"}), http.StatusBadRequest, "INVALID_TWO_FACTOR_CODE")
+		expectStatus(t, s.do("DELETE", "/api/me/2fa", token, map[string]string{"code": recovery[1]}), http.StatusOK)
+		expectError(t, s.do("DELETE", "/api/me/2fa", token, map[string]string{"code": recovery[2]}), http.StatusConflict, "TWO_FACTOR_NOT_ENABLED")
+		s.login("alice")
+
+		entries, _, err := s.store.Audit().List(context.Background(), repository.AuditFilter{EntityID: &alice.ID})
+		if err != nil || len(entries) != 2 || entries[0].Action != "user.2fa_disable" || entries[1].Action != "user.2fa_enable" {
+			t.Fatalf("audit = %+v, err = %v", entries, err)
+		}
+	})
+}
+
+func TestTwoFactorThrottle(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Login.MaxFailures = 3
+		cfg.Login.BackoffBase = config.Duration(time.Second)
+		cfg.Login.BackoffMax = config.Duration(4 * time.Second)
+	})
+	var offset time.Duration
+	s.store.Now = func() time.Time { return time.Now().Add(offset) }
+	_, token := s.tokenFor("alice", "member", nil)
+
+	rec := s.do("POST", "/api/me/2fa/enroll", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var enroll struct{ Secret string }
+	decode(t, rec, &enroll)
+	code, err := login.TOTPCode(enroll.Secret, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	throttled := func(rec *httptest.ResponseRecorder) {
+		t.Helper()
+		expectError(t, rec, http.StatusTooManyRequests, "TOO_MANY_ATTEMPTS")
+		if rec.Header().Get("Retry-After") == "" {
+			t.Fatal("missing Retry-After")
+		}
+	}
+
+	// รหัสที่ผิดทำให้ต้องรอก่อนลองใหม่ แม้รหัสถัดไปจะถูก
+	expectError(t, s.do("POST", "/api/me/2fa/verify", token, map[string]string{"code": "000000"}), http.StatusBadRequest, "INVALID_TWO_FACTOR_CODE")
+	throttled(s.do("POST", "/api/me/2fa/verify", token, map[string]string{"code": code}))
+	offset += 2 * time.Second
+	expectStatus(t, s.do("POST", "/api/me/2fa/verify", token, map[string]string{"code": code}), http.StatusOK)
+
+	// การปิด 2FA ถูกจำกัดเช่นกัน และนับรวมกับการ login ของบัญชีจนถูกล็อก
+	for i := 0; i < 3; i++ {
+		offset += 5 * time.Second
+		expectError(t, s.do("DELETE", "/api/me/2fa", token, map[string]string{"code": "abcd-efgh"}), http.StatusBadRequest, "INVALID_TWO_FACTOR_CODE")
+	}
+	expectError(t, s.do("DELETE", "/api/me/2fa", token, map[string]string{"code": "abcd-efgh"}), http.StatusLocked, "ACCOUNT_LOCKED")
+	expectError(t, s.do("POST", "/login", "", map[string]string{"identifier": "alice", "password": testPassword}), http.StatusLocked, "ACCOUNT_LOCKED")
+}
+
+func TestForgotPasswordThrottle(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Login.MaxFailures = 3
+		cfg.Login.BackoffBase = config.Duration(time.Second)
+		cfg.Login.BackoffMax = config.Duration(4 * time.Second)
+	})
+	alice := s.seedUser("alice", "member", nil)
+	var offset time.Duration
+	s.store.Now = func() time.Time { return time.Now().Add(offset) }
+
+	forgot := func(ip, email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/auth/forgot-password", strings.NewReader(`{"email":"`+email+`"}`))
+		req.RemoteAddr = ip + ":4000"
+		rec := httptest.NewRecorder()
+		s.handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	expectStatus(t, forgot("192.0.2.1", alice.Email), http.StatusAccepted)
+	s.mailedToken(alice.Email, "/reset-password")
+	rec := forgot("192.0.2.1", alice.Email)
+	expectError(t, rec, http.StatusTooManyRequests, "TOO_MANY_ATTEMPTS")
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("missing Retry-After")
+	}
+	// IP เดียวกันขออีเมลอื่นก็ต้องรอ ไม่ว่าอีเมลนั้นจะมีบัญชีหรือไม่
+	expectError(t, forgot("192.0.2.1", "nobody@example.com"), http.StatusTooManyRequests, "TOO_MANY_ATTEMPTS")
+
+	// อีเมลเดียวกันจากหลาย IP ถูกจำกัดที่ MaxFailures ครั้งต่อช่วง Lockout
+	offset += time.Minute
+	expectStatus(t, forgot("198.51.100.1", alice.Email), http.StatusAccepted)
+	offset += time.Minute
+	expectStatus(t, forgot("198.51.100.2", "ALICE@example.com"), http.StatusAccepted)
+	offset += time.Minute
+	expectError(t, forgot("198.51.100.3", alice.Email), http.StatusTooManyRequests, "TOO_MANY_ATTEMPTS")
+}
+
+func TestPasswordResetAndVerification(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.seedUser("alice", "member", nil)
+	sess := s.login("alice")
+	const newPassword = "a brand new passphrase"
+
+	t.Run("forgot password does not reveal accounts", func(t *testing.T) {
+		unknown := s.do("POST", "/auth/forgot-password", "", map[string]string{"email": "nobody@example.com"})
+		expectStatus(t, unknown, http.StatusAccepted)
+		// username ไม่ใช่อีเมล จึงต้องไม่ส่งลิงก์แม้จะพบผู้ใช้
+		byUsername := s.do("POST", "/auth/forgot-password", "", map[string]string{"email": "alice"})
+		expectStatus(t, byUsername, http.StatusAccepted)
+		if unknown.Body.String() != byUsername.Body.String() {
+			t.Fatalf("responses differ: %s vs %s", unknown.Body, byUsername.Body)
+		}
+		if s.mail.String() != "" {
+			t.Fatalf("mail sent: %s", s.mail)
+		}
+		expectError(t, s.do("POST", "/auth/forgot-password", "", map[string]string{}), http.StatusBadRequest, "INVALID_REQUEST")
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		expectStatus(t, s.do("POST", "/auth/forgot-password", "", map[string]string{"email": alice.Email}), http.StatusAccepted)
+		token := s.mailedToken(alice.Email, "/reset-password")
+		s.store.Now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+		defer func() { s.store.Now = time.Now }()
+		expectError(t, s.do("POST", "/auth/reset-password", "", map[string]string{"token": token, "password": newPassword}), http.StatusBadRequest, "INVALID_TOKEN")
+	})
+
+	t.Run("reset password", func(t *testing.T) {
+		expectStatus(t, s.do("POST", "/auth/forgot-password", "", map[string]string{"email": alice.Email}), http.StatusAccepted)
+		token := s.mailedToken(alice.Email, "/reset-password")
+
+		expectError(t, s.do("POST", "/auth/reset-password", "", map[string]string{"token": "bogus", "password": newPassword}), http.StatusBadRequest, "INVALID_TOKEN")
+		expectStatus(t, s.do("POST", "/auth/reset-password", "", map[string]string{"token": token, "password": newPassword}), http.StatusOK)
+		// token ใช้ได้ครั้งเดียว
+		expectError(t, s.do("POST", "/auth/reset-password", "", map[string]string{"token": token, "password": "another"}), http.StatusBadRequest, "INVALID_TOKEN")
+
+		// session เดิมถูก sign out และรหัสผ่านเดิมใช้ไม่ได้
+		expectError(t, s.do("GET", "/api/me", sess.Token, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+		expectError(t, s.do("POST", "/login", "", map[string]string{"identifier": "alice", "password": testPassword}), http.StatusUnauthorized, "INVALID_CREDENTIALS")
+		expectStatus(t, s.do("POST", "/login", "", map[string]string{"identifier": "alice", "password": newPassword}), http.StatusOK)
+
+		entries, _, err := s.store.Audit().List(context.Background(), repository.AuditFilter{Action: "user.password_reset"})
+		if err != nil || len(entries) != 1 || entries[0].EntityID != alice.ID {
+			t.Fatalf("audit = %+v, %v", entries, err)
+		}
+	})
+
+	t.Run("email verification", func(t *testing.T) {
+		_, admin := s.tokenFor("root", "admin", nil)
+		rec := s.do("POST", "/api/users", admin, map[string]string{"username": "bob", "email": "bob@example.com", "password": testPassword})
+		expectStatus(t, rec, http.StatusCreated)
+		var bob models.User
+		decode(t, rec, &bob)
+		if bob.EmailVerified {
+			t.Fatal("new user is already verified")
+		}
+
+		token := s.mailedToken("bob@example.com", "/verify-email")
+		// token ของอีกจุดประสงค์ใช้แทนกันไม่ได้
+		expectError(t, s.do("POST", "/auth/reset-password", "", map[string]string{"token": token, "password": newPassword}), http.StatusBadRequest, "INVALID_TOKEN")
+		expectStatus(t, s.do("POST", "/auth/verify-email", "", map[string]string{"token": token}), http.StatusOK)
+		expectError(t, s.do("POST", "/auth/verify-email", "", map[string]string{"token": token}), http.StatusBadRequest, "INVALID_TOKEN")
+
+		bobToken := s.login("bob").Token
+		var me struct{ User models.User }
+		decode(t, s.do("GET", "/api/me", bobToken, nil), &me)
+		if !me.User.EmailVerified {
+			t.Fatal("email_verified = false after verification")
+		}
+		expectError(t, s.do("POST", "/api/me/verify-email", bobToken, nil), http.StatusConflict, "EMAIL_ALREADY_VERIFIED")
+
+		// เปลี่ยนอีเมลแล้วต้องยืนยันใหม่ โดยลิงก์ถูกส่งไปยังอีเมลใหม่
+		expectStatus(t, s.do("PATCH", "/api/me", bobToken, map[string]string{"email": "bob@new.example.com"}), http.StatusOK)
+		decode(t, s.do("GET", "/api/me", bobToken, nil), &me)
+		if me.User.EmailVerified {
+			t.Fatal("email_verified = true after email change")
+		}
+		stale := s.mailedToken("bob@new.example.com", "/verify-email")
+		expectStatus(t, s.do("POST", "/api/me/verify-email", bobToken, nil), http.StatusAccepted)
+		fresh := s.mailedToken("bob@new.example.com", "/verify-email")
+		if stale == fresh {
+			t.Fatal("resend returned the same token")
+		}
+		expectStatus(t, s.do("POST", "/auth/verify-email", "", map[string]string{"token": fresh}), http.StatusOK)
+		// การใช้ token หนึ่งทำให้ token ยืนยันอีเมลอื่นของผู้ใช้ใช้ไม่ได้
+		expectError(t, s.do("POST", "/auth/verify-email", "", map[string]string{"token": stale}), http.StatusBadRequest, "INVALID_TOKEN")
+	})
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Password.RequireDigit = true
+		cfg.Password.Algorithm = config.PasswordBcrypt
+		// seedUser ใช้ MinCost จึงต้องถูก hash ใหม่เมื่อ login
+		cfg.Password.BcryptCost = bcrypt.MinCost + 1
+	})
+	_, admin := s.tokenFor("root", "admin", nil)
+
+	weak := func(t *testing.T, rec *httptest.ResponseRecorder, problem string) {
+		t.Helper()
+		expectError(t, rec, http.StatusBadRequest, "WEAK_PASSWORD")
+		var body struct {
+			Error struct{ Details []string } `json:"error"`
+		}
+		decode(t, rec, &body)
+		if !slices.Contains(body.Error.Details, problem) {
+			t.Fatalf("details = %q, want %q", body.Error.Details, problem)
+		}
+	}
+	create := func(password string) *httptest.ResponseRecorder {
+		return s.do("POST", "/api/users", admin, map[string]string{"username": "carol", "email": "carol.smith@example.com", "password": password})
+	}
+
+	t.Run("create", func(t *testing.T) {
+		weak(t, create("short1"), "must be at least 8 characters")
+		weak(t, create(strings.Repeat("long1", 15)), "must be at most 72 bytes")
+		weak(t, create("no digits at all"), "must contain a digit")
+		weak(t, create("Password123"), "is too common")
+		weak(t, create("Carol.Smith"), "must not be the same as your username or email")
+		expectStatus(t, create("plenty of words 4 you"), http.StatusCreated)
+
+		u, err := s.store.Users().GetByIdentifier(context.Background(), "carol")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cost, _ := bcrypt.Cost([]byte(u.Password)); cost != bcrypt.MinCost+1 {
+			t.Fatalf("cost = %d", cost)
+		}
+	})
+
+	t.Run("patch", func(t *testing.T) {
+		bob, token := s.tokenFor("bob", "member", nil)
+		weak(t, s.do("PATCH", "/api/me", token, map[string]string{"password": "bob", "current_password": testPassword}), "must be at least 8 characters")
+		// เทียบกับ username ใหม่ที่ส่งมาพร้อมกัน
+		weak(t, s.do("PATCH", "/api/me", token, map[string]string{"username": "robert2024", "password": "Robert2024", "current_password": testPassword}), "must not be the same as your username or email")
+		// bcrypt hash รหัสผ่านเกิน 72 ไบต์ไม่ได้ ต้องถูกปฏิเสธตามนโยบายก่อนถึงการ hash
+		long := strings.Repeat("long passphrase 1 ", 5)
+		weak(t, s.do("PATCH", "/api/users/"+strconv.Itoa(bob.ID), admin, map[string]string{"password": long}), "must be at most 72 bytes")
+		got, err := s.store.Users().GetByID(context.Background(), bob.ID)
+		if err != nil || got.Username != "bob" {
+			t.Fatalf("rejected patch was applied: %+v, %v", got, err)
+		}
+	})
+
+	t.Run("reset keeps token on weak password", func(t *testing.T) {
+		s.seedUser("dave", "member", nil)
+		expectStatus(t, s.do("POST", "/auth/forgot-password", "", map[string]string{"email": "dave@example.com"}), http.StatusAccepted)
+		token := s.mailedToken("dave@example.com", "/reset-password")
+		weak(t, s.do("POST", "/auth/reset-password", "", map[string]string{"token": token, "password": "password1"}), "is too common")
+		weak(t, s.do("POST", "/auth/reset-password", "", map[string]string{"token": token, "password": strings.Repeat("long passphrase 1 ", 5)}), "must be at most 72 bytes")
+		expectStatus(t, s.do("POST", "/auth/reset-password", "", map[string]string{"token": token, "password": "a better passphrase 9"}), http.StatusOK)
+	})
+
+	t.Run("login rehashes outdated hashes", func(t *testing.T) {
+		s.seedUser("erin", "member", nil)
+		s.login("erin")
+		u, err := s.store.Users().GetByIdentifier(context.Background(), "erin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cost, _ := bcrypt.Cost([]byte(u.Password)); cost != bcrypt.MinCost+1 {
+			t.Fatalf("cost after login = %d", cost)
+		}
+		// รหัสผ่านเดิมยังใช้ได้กับ hash ใหม่
+		s.login("erin")
+	})
+}
+
+func TestPasswordHashing(t *testing.T) {
+	s := newTestServer(t)
+	stored := func(username string) string {
+		t.Helper()
+		u, err := s.store.Users().GetByIdentifier(context.Background(), username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u.Password
+	}
+
+	t.Run("new passwords use argon2id", func(t *testing.T) {
+		_, admin := s.tokenFor("root", "admin", nil)
+		expectStatus(t, s.do("POST", "/api/users", admin, map[string]string{"username": "carol", "email": "carol@example.com", "password": testPassword}), http.StatusCreated)
+		if hash := stored("carol"); !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+			t.Fatalf("hash = %q", hash)
+		}
+		s.login("carol")
+	})
+
+	t.Run("bcrypt hash is upgraded on login", func(t *testing.T) {
+		s.seedUser("bob", "member", nil)
+		if hash := stored("bob"); !strings.HasPrefix(hash, "$2a$") {
+			t.Fatalf("seeded hash = %q", hash)
+		}
+		s.login("bob")
+		upgraded := stored("bob")
+		if !strings.HasPrefix(upgraded, "$argon2id$") {
+			t.Fatalf("hash after login = %q", upgraded)
+		}
+		s.login("bob")
+		if stored("bob") != upgraded {
+			t.Fatal("current hash was rehashed again")
+		}
+		expectError(t, s.do("POST", "/login", "", map[string]string{"identifier": "bob", "password": "wrong password"}), http.StatusUnauthorized, "INVALID_CREDENTIALS")
+	})
+
+	t.Run("argon2id parameters are upgraded on login", func(t *testing.T) {
+		cfg := config.Default().Password
+		cfg.Argon2Memory, cfg.Argon2Time = 32, 1
+		old, err := password.NewService(cfg).Hash(testPassword)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dave := s.seedUser("dave", "member", nil)
+		if err := s.store.Users().Update(context.Background(), dave.ID, repository.UserUpdate{PasswordHash: &old}); err != nil {
+			t.Fatal(err)
+		}
+		s.login("dave")
+		if hash := stored("dave"); !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+			t.Fatalf("hash after login = %q", hash)
+		}
+	})
+
+	t.Run("malformed hash", func(t *testing.T) {
+		erin := s.seedUser("erin", "member", nil)
+		for _, hash := range []string{"plaintext", "$argon2id$v=19$m=64$bad", "$argon2id$v=18$m=64,t=1,p=1$c2FsdA$a2V5"} {
+			if err := s.store.Users().Update(context.Background(), erin.ID, repository.UserUpdate{PasswordHash: &hash}); err != nil {
+				t.Fatal(err)
+			}
+			expectError(t, s.do("POST", "/login", "", map[string]string{"identifier": "erin", "password": testPassword}), http.StatusUnauthorized, "INVALID_CREDENTIALS")
+		}
+	})
+}
+
+// mockProvider คือ OpenID Connect provider จำลองที่ออก ID token ตาม claims ที่กำหนดต่อ login
+type mockProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]mockGrant // authorization code -> grant
+}
+
+type mockGrant struct {
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+const (
+	mockClientID     = "backend"
+	mockClientSecret = "client-secret"
+	mockRedirectURL  = "http://api.example.com/auth/oidc/callback"
+)
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &mockProvider{t: t, key: key, grants: map[string]mockGrant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		b64 := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "mock", "use": "sig", "alg": "RS256",
+			"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", p.token)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// configure ตั้งค่า oidc ของ test server ให้ใช้ provider นี้
+func (p *mockProvider) configure(cfg *config.Config) {
+	cfg.OIDC.Issuer = p.server.URL
+	cfg.OIDC.ClientID = mockClientID
+	cfg.OIDC.ClientSecret = mockClientSecret
+	cfg.OIDC.RedirectURL = mockRedirectURL
+}
+
+// idToken เซ็น claims ด้วย key ของ provider (หรือ key ที่กำหนด)
+func (p *mockProvider) idToken(claims jwt.MapClaims, key *rsa.PrivateKey) string {
+	p.t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "mock"
+	raw, err := token.SignedString(key)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return raw
+}
+
+// token คือ token endpoint ที่ตรวจ client secret, redirect_uri และ PKCE verifier
+func (p *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	fail := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+	id, secret, _ := r.BasicAuth()
+	if id != mockClientID || secret != mockClientSecret {
+		fail("invalid_client")
+		return
+	}
+	p.mu.Lock()
+	grant, ok := p.grants[r.PostFormValue("code")]
+	delete(p.grants, r.PostFormValue("code"))
+	p.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("redirect_uri") != mockRedirectURL ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		fail("invalid_grant")
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   p.server.URL,
+		"aud":   mockClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": grant.nonce,
+	}
+	for k, v := range grant.claims {
+		claims[k] = v
+	}
+	key := p.key
+	if forged, ok := claims["forged_by"].(*rsa.PrivateKey); ok {
+		delete(claims, "forged_by")
+		key = forged
+	}
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": p.idToken(claims, key)})
+}
+
+// ssoLogin ทำขั้นตอนของ browser: เริ่ม login ที่ server, "login" ที่ provider ด้วย claims แล้วกลับมาที่ callback
+// edit แก้ query ของ callback ก่อนส่งได้
+func (s *testServer) ssoLogin(p *mockProvider, claims jwt.MapClaims, edit ...func(q url.Values)) *httptest.ResponseRecorder {
+	s.t.Helper()
+	rec := s.do("GET", "/auth/oidc/login", "", nil)
+	if rec.Code != http.StatusFound {
+		s.t.Fatalf("oidc login: status %d: %s", rec.Code, rec.Body)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	auth := location.Query()
+	if location.Path != "/authorize" || auth.Get("client_id") != mockClientID || auth.Get("redirect_uri") != mockRedirectURL ||
+		auth.Get("code_challenge_method") != "S256" || auth.Get("response_type") != "code" || !strings.Contains(auth.Get("scope"), "openid") {
+		s.t.Fatalf("authorization request = %s", location)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || cookies[0].Path != "/auth/oidc" {
+		s.t.Fatalf("cookies = %+v", cookies)
+	}
+
+	code := "code-" + auth.Get("state")
+	p.mu.Lock()
+	p.grants[code] = mockGrant{challenge: auth.Get("code_challenge"), nonce: auth.Get("nonce"), claims: claims}
+	p.mu.Unlock()
+
+	q := url.Values{"code": {code}, "state": {auth.Get("state")}}
+	for _, f := range edit {
+		f(q)
+	}
+	req := httptest.NewRequest("GET", "/auth/oidc/callback?"+q.Encode(), nil)
+	req.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOIDCLogin(t *testing.T) {
+	p := newMockProvider(t)
+	s := newTestServer(t, p.configure, func(cfg *config.Config) {
+		cfg.OIDC.Groups = []config.OIDCGroup{
+			{Group: "backend-admins", Role: "admin"},
+			{Group: "platform", Role: "team_lead", TeamID: 1},
+		}
+	})
+	platform := s.seedTeam("Platform")
+	if platform.ID != 1 {
+		t.Fatalf("team id = %d", platform.ID)
+	}
+	identity := func(email string, groups ...string) jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub":                "sub-" + email,
+			"email":              email,
+			"email_verified":     true,
+			"preferred_username": strings.Split(email, "@")[0],
+			"given_name":         "Test",
+			"family_name":        "User",
+			"groups":             groups,
+		}
+	}
+	signedIn := func(s *testServer, rec *httptest.ResponseRecorder) session {
+		t.Helper()
+		expectStatus(t, rec, http.StatusOK)
+		var sess session
+		decode(t, rec, &sess)
+		if sess.Token == "" || sess.RefreshToken == "" {
+			t.Fatalf("session = %s", rec.Body)
+		}
+		expectStatus(t, s.do("GET", "/api/me", sess.Token, nil), http.StatusOK)
+		return sess
+	}
+
+	t.Run("provisions a new user from group claims", func(t *testing.T) {
+		sess := signedIn(s, s.ssoLogin(p, identity("dana@example.com", "platform", "everyone")))
+		u := sess.User
+		if u.Username != "dana" || u.Role != "team_lead" || u.TeamId == nil || *u.TeamId != platform.ID || !u.EmailVerified || u.FirstName != "Test" {
+			t.Fatalf("user = %+v", u)
+		}
+		entries, _, err := s.store.Audit().List(context.Background(), repository.AuditFilter{EntityID: &u.ID})
+		if err != nil || len(entries) != 1 || entries[0].Action != "user.create" {
+			t.Fatalf("audit = %+v, err = %v", entries, err)
+		}
+		// ผู้ใช้ที่สร้างจาก SSO ไม่มีรหัสผ่าน
+		expectError(t, s.do("POST", "/login", "", map[string]string{"identifier": "dana", "password": testPassword}), http.StatusUnauthorized, "INVALID_CREDENTIALS")
+	})
+
+	t.Run("username is made unique", func(t *testing.T) {
+		s.seedUser("erin", "member", nil)
+		sess := signedIn(s, s.ssoLogin(p, identity("erin@corp.example.com")))
+		if sess.User.Username != "erin2" || sess.User.Role != "member" {
+			t.Fatalf("user = %+v", sess.User)
+		}
+	})
+
+	t.Run("username fits the username rule", func(t *testing.T) {
+		sess := signedIn(s, s.ssoLogin(p, identity("jo@corp.example.com")))
+		if sess.User.Username != "user-jo" {
+			t.Fatalf("user = %+v", sess.User)
+		}
+		long := strings.Repeat("a", 40)
+		sess = signedIn(s, s.ssoLogin(p, identity(long+"@example.com")))
+		if sess.User.Username != long[:32] {
+			t.Fatalf("user = %+v", sess.User)
+		}
+		sess = signedIn(s, s.ssoLogin(p, identity(long+"@corp.example.com")))
+		if sess.User.Username != long[:31]+"2" {
+			t.Fatalf("user = %+v", sess.User)
+		}
+		// ชื่อที่ได้ต้องผ่านกฎเดียวกับที่ admin ใช้สร้างผู้ใช้
+		_, admin := s.tokenFor("root", "admin", nil)
+		expectStatus(t, s.do("PATCH", "/api/users/"+strconv.Itoa(sess.User.ID), admin, map[string]string{"username": sess.User.Username}), http.StatusOK)
+	})
+
+	t.Run("links an existing user by email and syncs the role", func(t *testing.T) {
+		alice := s.seedUser("alice", "member", nil)
+		old := s.login("alice")
+		sess := signedIn(s, s.ssoLogin(p, identity("ALICE@example.com", "backend-admins", "platform")))
+		if sess.User.ID != alice.ID || sess.User.Role != "admin" || sess.User.TeamId == nil || *sess.User.TeamId != platform.ID {
+			t.Fatalf("user = %+v", sess.User)
+		}
+		// session เดิมมี role เก่าจึงถูก revoke
+		expectError(t, s.do("GET", "/api/me", old.Token, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+		// รหัสผ่านเดิมยังใช้ได้
+		s.login("alice")
+
+		// เมื่อออกจากกลุ่มที่ provider role กลับเป็น default_role แต่ทีมหลักไม่เปลี่ยน
+		sess = signedIn(s, s.ssoLogin(p, identity("alice@example.com")))
+		if sess.User.Role != "member" || sess.User.TeamId == nil {
+			t.Fatalf("user = %+v", sess.User)
+		}
+		entries, _, err := s.store.Audit().List(context.Background(), repository.AuditFilter{EntityID: &alice.ID, Action: "user.update"})
+		if err != nil || len(entries) != 2 || entries[1].Changes["role"].To != "admin" || entries[0].Changes["role"].To != "member" {
+			t.Fatalf("audit = %+v, err = %v", entries, err)
+		}
+		// ไม่มีอะไรเปลี่ยนก็ไม่บันทึก
+		signedIn(s, s.ssoLogin(p, identity("alice@example.com")))
+		if _, total, _ := s.store.Audit().List(context.Background(), repository.AuditFilter{EntityID: &alice.ID, Action: "user.update"}); total != 2 {
+			t.Fatalf("audit entries = %d", total)
+		}
+	})
+
+	t.Run("two-factor users get a challenge", func(t *testing.T) {
+		bob := s.seedUser("bob", "member", nil)
+		if err := s.store.TwoFactor().SetSecret(context.Background(), bob.ID, "JBSWY3DPEHPK3PXP"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.store.TwoFactor().Enable(context.Background(), bob.ID, nil); err != nil {
+			t.Fatal(err)
+		}
+		rec := s.ssoLogin(p, identity("bob@example.com"))
+		expectStatus(t, rec, http.StatusOK)
+		var body struct {
+			TwoFactorRequired bool   `json:"two_factor_required"`
+			ChallengeToken    string `json:"challenge_token"`
+			Token             string `json:"token"`
+		}
+		decode(t, rec, &body)
+		if !body.TwoFactorRequired || body.ChallengeToken == "" || body.Token != "" {
+			t.Fatalf("callback = %s", rec.Body)
+		}
+	})
+
+	t.Run("rejections", func(t *testing.T) {
+		unverified := identity("frank@example.com")
+		unverified["email_verified"] = false
+		noEmail := identity("")
+		delete(noEmail, "email")
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		forged := identity("mallory@example.com", "backend-admins")
+		forged["forged_by"] = otherKey
+		wrongAudience := identity("mallory@example.com")
+		wrongAudience["aud"] = "another-client"
+		expired := identity("mallory@example.com")
+		expired["exp"] = time.Now().Add(-time.Minute).Unix()
+		wrongNonce := identity("mallory@example.com")
+		wrongNonce["nonce"] = "replayed"
+
+		cases := []struct {
+			name   string
+			rec    *httptest.ResponseRecorder
+			status int
+			code   string
+		}{
+			{"unverified email", s.ssoLogin(p, unverified), http.StatusForbidden, "OIDC_EMAIL_NOT_VERIFIED"},
+			{"no email", s.ssoLogin(p, noEmail), http.StatusUnauthorized, "OIDC_LOGIN_FAILED"},
+			{"forged signature", s.ssoLogin(p, forged), http.StatusUnauthorized, "OIDC_LOGIN_FAILED"},
+			{"wrong audience", s.ssoLogin(p, wrongAudience), http.StatusUnauthorized, "OIDC_LOGIN_FAILED"},
+			{"expired", s.ssoLogin(p, expired), http.StatusUnauthorized, "OIDC_LOGIN_FAILED"},
+			{"wrong nonce", s.ssoLogin(p, wrongNonce), http.StatusUnauthorized, "OIDC_LOGIN_FAILED"},
+			{"state mismatch", s.ssoLogin(p, identity("mallory@example.com"), func(q url.Values) { q.Set("state", "attacker") }), http.StatusBadRequest, "INVALID_OIDC_STATE"},
+			{"unknown code", s.ssoLogin(p, identity("mallory@example.com"), func(q url.Values) { q.Set("code", "guessed") }), http.StatusUnauthorized, "OIDC_LOGIN_FAILED"},
+			{"provider error", s.ssoLogin(p, identity("mallory@example.com"), func(q url.Values) { q.Del("code"); q.Set("error", "access_denied") }), http.StatusUnauthorized, "OIDC_LOGIN_FAILED"},
+			{"missing cookie", s.do("GET", "/auth/oidc/callback?code=x&state=y", "", nil), http.StatusBadRequest, "INVALID_OIDC_STATE"},
+		}
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				expectError(t, c.rec, c.status, c.code)
+			})
+		}
+		if _, err := s.store.Users().GetByIdentifier(context.Background(), "mallory@example.com"); err == nil {
+			t.Fatal("rejected login created a user")
+		}
+	})
+
+	t.Run("provisioning disabled", func(t *testing.T) {
+		s := newTestServer(t, p.configure, func(cfg *config.Config) { cfg.OIDC.Provision = false })
+		expectError(t, s.ssoLogin(p, identity("grace@example.com")), http.StatusForbidden, "OIDC_ACCOUNT_NOT_FOUND")
+		s.seedUser("grace", "member", nil)
+		if sess := signedIn(s, s.ssoLogin(p, identity("grace@example.com"))); sess.User.Username != "grace" {
+			t.Fatalf("user = %+v", sess.User)
+		}
+	})
+
+	t.Run("disabled without issuer", func(t *testing.T) {
+		expectError(t, newTestServer(t).do("GET", "/auth/oidc/login", "", nil), http.StatusNotFound, "NOT_FOUND")
+	})
+}
+
+func TestAPIKeys(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.seedUser("alice", "team_lead", nil)
+	sess := s.login("alice")
+
+	type created struct {
+		APIKey models.APIKey `json:"api_key"`
+		Key    string        `json:"key"`
+	}
+	create := func(t *testing.T, token, path string, body interface{}) created {
+		t.Helper()
+		rec := s.do("POST", path, token, body)
+		expectStatus(t, rec, http.StatusCreated)
+		var c created
+		decode(t, rec, &c)
+		return c
+	}
+
+	t.Run("create and use", func(t *testing.T) {
+		c := create(t, sess.Token, "/api/me/api-keys", map[string]interface{}{"name": "ci", "scopes": []string{"users:read", "users:read"}})
+		if !strings.HasPrefix(c.Key, middleware.APIKeyPrefix) || !strings.HasPrefix(c.Key, c.APIKey.Prefix) {
+			t.Fatalf("key = %q, prefix = %q", c.Key, c.APIKey.Prefix)
+		}
+		if c.APIKey.UserID != alice.ID || !slices.Equal(c.APIKey.Scopes, []string{"users:read"}) || c.APIKey.LastUsedAt != nil {
+			t.Fatalf("api_key = %+v", c.APIKey)
+		}
+		expires, err := time.Parse("2006-01-02 15:04:05", c.APIKey.ExpiresAt)
+		if err != nil || expires.Sub(time.Now()).Round(time.Hour) != 90*24*time.Hour {
+			t.Fatalf("expires_at = %q, %v", c.APIKey.ExpiresAt, err)
+		}
+
+		// ใช้ได้เฉพาะ scope ที่ระบุ แม้ role ของเจ้าของจะมีสิทธิ์มากกว่า
+		expectStatus(t, s.do("GET", "/api/users", c.Key, nil), http.StatusOK)
+		expectStatus(t, s.do("GET", "/api/me", c.Key, nil), http.StatusOK)
+		expectError(t, s.do("GET", "/api/teams", c.Key, nil), http.StatusForbidden, "FORBIDDEN")
+		expectError(t, s.do("POST", "/api/users", c.Key, map[string]string{"username": "bob", "email": "bob@example.com", "password": testPassword}), http.StatusForbidden, "FORBIDDEN")
+		// API key แก้ไขบัญชีหรือสร้าง key เพิ่มไม่ได้
+		expectError(t, s.do("PATCH", "/api/me", c.Key, map[string]string{"firstname": "Eve"}), http.StatusForbidden, "FORBIDDEN")
+		expectError(t, s.do("PATCH", fmt.Sprintf("/api/users/%d", alice.ID), c.Key, map[string]string{"firstname": "Eve"}), http.StatusForbidden, "FORBIDDEN")
+		expectError(t, s.do("POST", "/api/me/2fa/enroll", c.Key, nil), http.StatusForbidden, "FORBIDDEN")
+		expectError(t, s.do("POST", "/api/me/api-keys", c.Key, map[string]interface{}{"name": "more", "scopes": []string{"users:read"}}), http.StatusForbidden, "FORBIDDEN")
+
+		// รายการไม่มีตัว key และบันทึกเวลาที่ใช้ล่าสุด
+		rec := s.do("GET", "/api/me/api-keys", sess.Token, nil)
+		expectStatus(t, rec, http.StatusOK)
+		if strings.Contains(rec.Body.String(), c.Key) {
+			t.Fatalf("list leaks the key: %s", rec.Body)
+		}
+		var list struct {
+			APIKeys []models.APIKey `json:"api_keys"`
+		}
+		decode(t, rec, &list)
+		if len(list.APIKeys) != 1 || list.APIKeys[0].ID != c.APIKey.ID || list.APIKeys[0].LastUsedAt == nil {
+			t.Fatalf("api_keys = %+v", list.APIKeys)
+		}
+
+		expectError(t, s.do("GET", "/api/users", "gbk_bogus", nil), http.StatusUnauthorized, "UNAUTHORIZED")
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		for name, body := range map[string]interface{}{
+			"no name":         map[string]interface{}{"scopes": []string{"users:read"}},
+			"too long":        map[string]interface{}{"name": "ci", "scopes": []string{"users:read"}, "expires_in_days": 366},
+			"not json":        "{",
+			"zero expiration": map[string]interface{}{"name": "ci", "scopes": []string{"users:read"}, "expires_in_days": 0},
+		} {
+			t.Run(name, func(t *testing.T) {
+				expectError(t, s.do("POST", "/api/me/api-keys", sess.Token, body), http.StatusBadRequest, "INVALID_REQUEST")
+			})
+		}
+		// scope ต้องเป็นสิทธิ์ที่ role ของเจ้าของมี
+		for _, scopes := range [][]string{nil, {"users:delete"}, {"no:such"}} {
+			expectError(t, s.do("POST", "/api/me/api-keys", sess.Token, map[string]interface{}{"name": "ci", "scopes": scopes}), http.StatusBadRequest, "INVALID_SCOPE")
+		}
+	})
+
+	t.Run("revoke and expire", func(t *testing.T) {
+		c := create(t, sess.Token, "/api/me/api-keys", map[string]interface{}{"name": "short", "scopes": []string{"teams:read"}, "expires_in_days": 1})
+		expectStatus(t, s.do("GET", "/api/teams", c.Key, nil), http.StatusOK)
+
+		s.store.Now = func() time.Time { return time.Now().Add(25 * time.Hour) }
+		expectError(t, s.do("GET", "/api/teams", c.Key, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+		s.store.Now = time.Now
+
+		path := fmt.Sprintf("/api/me/api-keys/%d", c.APIKey.ID)
+		expectStatus(t, s.do("DELETE", path, sess.Token, nil), http.StatusOK)
+		expectError(t, s.do("GET", "/api/teams", c.Key, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+		expectError(t, s.do("DELETE", path, sess.Token, nil), http.StatusNotFound, "API_KEY_NOT_FOUND")
+	})
+
+	t.Run("admin manages keys of other users", func(t *testing.T) {
+		_, admin := s.tokenFor("root", "admin", nil)
+		path := fmt.Sprintf("/api/users/%d/api-keys", alice.ID)
+		expectError(t, s.do("GET", path, sess.Token, nil), http.StatusForbidden, "FORBIDDEN")
+		// key ที่ admin สร้างให้ก็ไม่เกินสิทธิ์ของเจ้าของ
+		expectError(t, s.do("POST", path, admin, map[string]interface{}{"name": "deploy", "scopes": []string{"audit:read"}}), http.StatusBadRequest, "INVALID_SCOPE")
+		c := create(t, admin, path, map[string]interface{}{"name": "deploy", "scopes": []string{"users:create"}})
+		if c.APIKey.UserID != alice.ID {
+			t.Fatalf("user_id = %d, want %d", c.APIKey.UserID, alice.ID)
+		}
+
+		// key ทำงานในนามเจ้าของ และถูกจำกัดตาม role ปัจจุบันของเจ้าของ
+		var me struct{ User models.User }
+		decode(t, s.do("GET", "/api/me", c.Key, nil), &me)
+		if me.User.ID != alice.ID {
+			t.Fatalf("me = %+v", me.User)
+		}
+		expectStatus(t, s.do("PATCH", fmt.Sprintf("/api/users/%d", alice.ID), admin, map[string]string{"role": "member"}), http.StatusOK)
+		expectError(t, s.do("POST", "/api/users", c.Key, map[string]string{"username": "bob", "email": "bob@example.com", "password": testPassword}), http.StatusForbidden, "FORBIDDEN")
+
+		expectError(t, s.do("DELETE", path+"/999", admin, nil), http.StatusNotFound, "API_KEY_NOT_FOUND")
+		expectError(t, s.do("GET", "/api/users/999/api-keys", admin, nil), http.StatusNotFound, "USER_NOT_FOUND")
+		expectStatus(t, s.do("DELETE", fmt.Sprintf("%s/%d", path, c.APIKey.ID), admin, nil), http.StatusOK)
+		expectError(t, s.do("GET", "/api/me", c.Key, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+
+		entries, _, err := s.store.Audit().List(context.Background(), repository.AuditFilter{Action: "user.api_key_revoke"})
+		if err != nil || len(entries) != 2 || entries[0].EntityID != alice.ID {
+			t.Fatalf("audit = %+v, %v", entries, err)
+		}
+	})
+
+	t.Run("password reset revokes keys", func(t *testing.T) {
+		bob := s.seedUser("bob", "member", nil)
+		c := create(t, s.login("bob").Token, "/api/me/api-keys", map[string]interface{}{"name": "ci", "scopes": []string{"users:read"}})
+		expectStatus(t, s.do("POST", "/auth/forgot-password", "", map[string]string{"email": bob.Email}), http.StatusAccepted)
+		token := s.mailedToken(bob.Email, "/reset-password")
+		expectStatus(t, s.do("POST", "/auth/reset-password", "", map[string]string{"token": token, "password": "a brand new passphrase"}), http.StatusOK)
+		expectError(t, s.do("GET", "/api/users", c.Key, nil), http.StatusUnauthorized, "UNAUTHORIZED")
+	})
+}
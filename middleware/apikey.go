@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"golang-backend/api/response"
+	"golang-backend/repository"
+	"log"
+	"net/http"
+)
+
+// APIKeyPrefix นำหน้าทุก API key เพื่อให้ระบบ secret scanning จดจำได้
+const APIKeyPrefix = "gbk_"
+
+// HashAPIKey คือค่าที่เก็บในฐานข้อมูลแทนตัว key
+func HashAPIKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyPrincipal คืน Principal ของเจ้าของ API key โดยใช้ role และทีมปัจจุบันของเจ้าของ
+// (ลด role แล้ว key ก็ถูกลดสิทธิ์ตาม) คืน nil ถ้า key ใช้ไม่ได้หรือเจ้าของถูกลบ
+func apiKeyPrincipal(r *http.Request, raw string, apiKeys repository.APIKeyRepository, users repository.UserRepository) (*Principal, error) {
+	ctx := r.Context()
+	key, err := apiKeys.GetByHash(ctx, HashAPIKey(raw))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	owner, err := users.GetByID(ctx, key.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// last_used_at เป็นข้อมูลประกอบ จึงไม่ทำให้ request ล้มเหลว
+	if err := apiKeys.Touch(ctx, key.ID); err != nil {
+		log.Printf("request_id=%s touch api key %d: %v", response.RequestID(ctx), key.ID, err)
+	}
+
+	scopes := make([]Permission, len(key.Scopes))
+	for i, scope := range key.Scopes {
+		scopes[i] = Permission(scope)
+	}
+	return &Principal{
+		UserID:   owner.ID,
+		Username: owner.Username,
+		Role:     Role(owner.Role),
+		TeamID:   owner.TeamId,
+		APIKeyID: key.ID,
+		Scopes:   scopes,
+	}, nil
+}
@@ -0,0 +1,324 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"golang-backend/api/login"
+	"golang-backend/config"
+	"golang-backend/models"
+	"golang-backend/repository/memory"
+	"golang-backend/signing"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var testJWT = config.JWTConfig{
+	Algorithm:   config.JWTEdDSA,
+	RotateEvery: config.Duration(24 * time.Hour),
+	Issuer:      "golang-backend",
+	Audience:    "golang-backend",
+	TTL:         config.Duration(15 * time.Minute),
+	RefreshTTL:  config.Duration(time.Hour),
+}
+
+const testFamily = "0123456789abcdef0123456789abcdef"
+
+func signed(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims *login.Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	raw, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func validClaims() *login.Claims {
+	now := time.Now()
+	return &login.Claims{
+		UserID:    1,
+		Username:  "alice",
+		Role:      string(RoleMember),
+		SessionID: testFamily,
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    testJWT.Issuer,
+			Audience:  testJWT.Audience,
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(time.Minute).Unix(),
+		},
+	}
+}
+
+// jwks ดึง public key จาก /.well-known/jwks.json ของ keys
+func jwks(t *testing.T, keys *signing.KeySet) []map[string]string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	keys.JWKS(rec, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	var body struct{ Keys []map[string]string }
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body.Keys
+}
+
+// publicKey แปลง JWK กลับเป็น public key ตามที่บริการอื่นจะทำ
+func publicKey(t *testing.T, jwk map[string]string) interface{} {
+	t.Helper()
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	switch jwk["kty"] {
+	case "RSA":
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(decode(jwk["n"])), E: int(new(big.Int).SetBytes(decode(jwk["e"])).Int64())}
+	case "OKP":
+		return ed25519.PublicKey(decode(jwk["x"]))
+	}
+	t.Fatalf("unexpected key type %q", jwk["kty"])
+	return nil
+}
+
+func TestJWTMiddleware(t *testing.T) {
+	store := memory.NewStore()
+	alice := models.User{Username: "alice", Email: "alice@example.com", Role: string(RoleMember)}
+	if err := store.Users().Create(context.Background(), &alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RefreshTokens().Create(context.Background(), alice.ID, testFamily, strings.Repeat("a", 64), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := signing.NewKeySet(testJWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got *Principal
+	handler := JWTMiddleware(keys, store.RefreshTokens(), store.APIKeys(), store.Users())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = CurrentPrincipal(r)
+	}))
+
+	serve := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/me", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	sign := func(claims *login.Claims) string {
+		t.Helper()
+		raw, err := keys.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+
+	t.Run("valid token", func(t *testing.T) {
+		got = nil
+		rec := serve("Bearer " + sign(validClaims()))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+		}
+		if got == nil || got.UserID != 1 || got.Role != RoleMember {
+			t.Fatalf("principal = %+v", got)
+		}
+	})
+
+	published := jwks(t, keys)
+	if len(published) != 1 {
+		t.Fatalf("jwks = %v", published)
+	}
+	kid := published[0]["kid"]
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+
+	expired := validClaims()
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	noExpiry := validClaims()
+	noExpiry.ExpiresAt = 0
+	notYet := validClaims()
+	notYet.NotBefore = time.Now().Add(time.Minute).Unix()
+	wrongIssuer := validClaims()
+	wrongIssuer.Issuer = "someone-else"
+	wrongAudience := validClaims()
+	wrongAudience.Audience = "other-service"
+	noSession := validClaims()
+	noSession.SessionID = ""
+	unknownSession := validClaims()
+	unknownSession.SessionID = strings.Repeat("f", 32)
+
+	rejections := map[string]string{
+		"missing header": "",
+		"empty bearer":   "Bearer ",
+		"malformed":      "Bearer abc.def",
+		"wrong key":      "Bearer " + signed(t, jwt.SigningMethodEdDSA, otherKey, kid, validClaims()),
+		"unknown kid":    "Bearer " + signed(t, jwt.SigningMethodEdDSA, otherKey, "unknown", validClaims()),
+		"missing kid":    "Bearer " + signed(t, jwt.SigningMethodEdDSA, otherKey, "", validClaims()),
+		"alg none":       "Bearer " + signed(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, kid, validClaims()),
+		// ใช้ public key ที่เผยแพร่อยู่เป็น secret ของ HMAC
+		"hmac with public key": "Bearer " + signed(t, jwt.SigningMethodHS256, []byte(published[0]["x"]), kid, validClaims()),
+		"expired":              "Bearer " + sign(expired),
+		"missing exp":          "Bearer " + sign(noExpiry),
+		"not valid yet":        "Bearer " + sign(notYet),
+		"wrong issuer":         "Bearer " + sign(wrongIssuer),
+		"wrong audience":       "Bearer " + sign(wrongAudience),
+		"missing sid":          "Bearer " + sign(noSession),
+		"unknown session":      "Bearer " + sign(unknownSession),
+	}
+	for name, header := range rejections {
+		t.Run(name, func(t *testing.T) {
+			got = nil
+			rec := serve(header)
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want 401", rec.Code)
+			}
+			var body struct {
+				Error struct{ Code string } `json:"error"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error.Code != "UNAUTHORIZED" {
+				t.Fatalf("body = %s", rec.Body)
+			}
+			if got != nil {
+				t.Fatal("next handler was called")
+			}
+		})
+	}
+
+	t.Run("revoked session", func(t *testing.T) {
+		if err := store.RefreshTokens().RevokeFamily(context.Background(), testFamily); err != nil {
+			t.Fatal(err)
+		}
+		rec := serve("Bearer " + sign(validClaims()))
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want 401", rec.Code)
+		}
+	})
+}
+
+// TestKeyRotation เลื่อนเวลาของ KeySet ผ่านรอบการหมุนเวียน key ที่เก็บไว้ใน directory
+func TestKeyRotation(t *testing.T) {
+	cfg := testJWT
+	cfg.Algorithm = config.JWTRS256
+	cfg.KeyDir = t.TempDir()
+	now := time.Now().Truncate(time.Second)
+	clock := func() time.Time { return now }
+
+	keys, err := signing.NewKeySet(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys.Now = clock
+	kidOf := func(raw string) string {
+		t.Helper()
+		token, _, err := new(jwt.Parser).ParseUnverified(raw, &login.Claims{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		kid, _ := token.Header["kid"].(string)
+		return kid
+	}
+	kids := func() []string {
+		var out []string
+		for _, jwk := range jwks(t, keys) {
+			out = append(out, jwk["kid"])
+		}
+		return out
+	}
+	sign := func() string {
+		t.Helper()
+		claims := validClaims()
+		claims.StandardClaims = keys.Registered(keys.Audience(), time.Duration(cfg.TTL))
+		raw, err := keys.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+	verify := func(raw string) error {
+		return keys.Parse(raw, keys.Audience(), &login.Claims{})
+	}
+
+	// token ที่เซ็นไว้ตรวจได้ด้วย public key จาก JWKS
+	first := sign()
+	firstKid := kidOf(first)
+	jwk := jwks(t, keys)[0]
+	if jwk["kty"] != "RSA" || jwk["alg"] != "RS256" || jwk["use"] != "sig" || jwk["kid"] != firstKid {
+		t.Fatalf("jwk = %v", jwk)
+	}
+	if _, err := jwt.Parse(first, func(*jwt.Token) (interface{}, error) { return publicKey(t, jwk), nil }); err != nil {
+		t.Fatalf("verify with published key: %v", err)
+	}
+
+	// key ที่อ่านกลับจาก directory (เช่นหลัง restart) ตรวจ token เดิมได้
+	reloaded, err := signing.NewKeySet(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded.Now = clock
+	if err := reloaded.Parse(first, reloaded.Audience(), &login.Claims{}); err != nil {
+		t.Fatalf("reloaded key set: %v", err)
+	}
+
+	// ก่อนครบรอบ key ใหม่ถูกเผยแพร่แต่ยังไม่ใช้เซ็น
+	now = now.Add(time.Duration(cfg.RotateEvery) - 5*time.Minute)
+	if err := keys.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := kids(); len(got) != 2 {
+		t.Fatalf("kids = %v, want the new key published", got)
+	}
+	if kid := kidOf(sign()); kid != firstKid {
+		t.Fatalf("signed with %s before the new key was published long enough", kid)
+	}
+	second := sign()
+
+	// เมื่อถึงเวลา key ใหม่ใช้เซ็น และ token ที่เซ็นด้วย key เก่ายังตรวจได้
+	now = now.Add(10 * time.Minute)
+	if err := keys.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	third := sign()
+	if kidOf(third) == firstKid {
+		t.Fatal("still signing with the old key")
+	}
+	for _, raw := range []string{second, third} {
+		if err := verify(raw); err != nil {
+			t.Fatalf("verify: %v", err)
+		}
+	}
+
+	// เมื่อ token ทั้งหมดของ key เก่าหมดอายุ key เก่าถูกลบทั้งจาก JWKS และจาก directory
+	now = now.Add(time.Duration(cfg.TTL) + 10*time.Minute)
+	if err := keys.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := kids(); len(got) != 1 || got[0] != kidOf(third) {
+		t.Fatalf("kids = %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.KeyDir, firstKid+".pem")); !os.IsNotExist(err) {
+		t.Fatalf("retired key file still exists: %v", err)
+	}
+	reloaded.Now = func() time.Time { return now.Add(time.Minute) }
+	if err := reloaded.Parse(sign(), reloaded.Audience(), &login.Claims{}); err != nil {
+		t.Fatalf("other instance did not pick up the new key: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"context"
+	"golang-backend/api/login"
+	"golang-backend/api/response"
+	"net/http"
+	"slices"
+)
+
+// Principal คือตัวตนของผู้เรียกที่ยืนยันแล้วจาก token
+type Principal struct {
+	UserID   int
+	Username string
+	Role     Role
+	TeamID   *int
+	// SessionID คือ family ของ refresh token ที่ออก access token (ว่างเมื่อใช้ API key)
+	SessionID string
+
+	// APIKeyID คือ ID ของ API key ที่ใช้ยืนยันตัวตน (0 เมื่อใช้ JWT ของ session)
+	APIKeyID int
+	// Scopes จำกัดสิทธิ์ของ API key ให้เหลือเฉพาะที่ระบุ (nil คือทุกสิทธิ์ของ role)
+	Scopes []Permission
+}
+
+type principalKey struct{}
+
+// principalFromClaims แปลง JWT claims เป็น Principal
+func principalFromClaims(claims *login.Claims) *Principal {
+	return &Principal{
+		UserID:    claims.UserID,
+		Username:  claims.Username,
+		Role:      Role(claims.Role),
+		TeamID:    claims.TeamID,
+		SessionID: claims.SessionID,
+	}
+}
+
+// Can บอกว่าผู้เรียกมีสิทธิ์ perm หรือไม่ API key ต้องมี scope นั้นและ role ปัจจุบันของเจ้าของต้องมีสิทธิ์นั้นด้วย
+func (p *Principal) Can(perm Permission) bool {
+	return p.Role.Can(perm) && (p.Scopes == nil || slices.Contains(p.Scopes, perm))
+}
+
+// WithPrincipal คืน context ใหม่ที่มี principal อยู่
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext ดึง principal ที่ JWTMiddleware ใส่ไว้ใน context
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// CurrentPrincipal คือ PrincipalFromContext ของ request
+func CurrentPrincipal(r *http.Request) (*Principal, bool) {
+	return PrincipalFromContext(r.Context())
+}
+
+// Authenticated อนุญาตผู้เรียกทุกคนที่ยืนยันตัวตนแล้ว ใช้กับ route ที่ไม่ต้องการ permission เฉพาะ
+func Authenticated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := CurrentPrincipal(r); !ok {
+			response.WriteError(w, r, response.Unauthorized())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SessionOnly อนุญาตเฉพาะผู้เรียกที่ login ด้วย session ใช้กับ route ที่จัดการบัญชีและ credential
+// ซึ่ง API key ไม่ควรทำได้ (เช่นเปลี่ยนรหัสผ่าน เปิดปิด 2FA หรือสร้าง API key เพิ่ม)
+func SessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := CurrentPrincipal(r)
+		if !ok {
+			response.WriteError(w, r, response.Unauthorized())
+			return
+		}
+		if p.APIKeyID != 0 {
+			response.WriteError(w, r, response.Forbidden())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"golang-backend/api/response"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Role คือบทบาทของผู้ใช้ที่เก็บในคอลัมน์ users.role และใน JWT claims
+type Role string
+
+const (
+	RoleAdmin    Role = "admin"
+	RoleTeamLead Role = "team_lead"
+	RoleMember   Role = "member"
+)
+
+// Permission คือสิทธิ์ที่ route ต้องการ
+type Permission string
+
+const (
+	PermUsersRead       Permission = "users:read"
+	PermUsersCreate     Permission = "users:create"
+	PermUsersUpdate     Permission = "users:update" // แก้ไขผู้ใช้คนอื่น รวมถึงการย้ายทีม
+	PermUsersDelete     Permission = "users:delete"
+	PermUsersAssignRole Permission = "users:assign_role"
+	PermTeamsRead       Permission = "teams:read"
+	PermTeamsCreate     Permission = "teams:create"
+	PermTeamsUpdate     Permission = "teams:update"
+	PermTeamsDelete     Permission = "teams:delete"
+	PermAuditRead       Permission = "audit:read"
+	PermAPIKeysManage   Permission = "api_keys:manage" // ดู สร้าง และ revoke API key ของผู้ใช้คนอื่น
+)
+
+// rolePermissions กำหนดว่าแต่ละ role มีสิทธิ์อะไรบ้าง
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin: {
+		PermUsersRead, PermUsersCreate, PermUsersUpdate, PermUsersDelete, PermUsersAssignRole,
+		PermTeamsRead, PermTeamsCreate, PermTeamsUpdate, PermTeamsDelete,
+		PermAuditRead, PermAPIKeysManage,
+	},
+	RoleTeamLead: {
+		PermUsersRead, PermUsersCreate,
+		PermTeamsRead, PermTeamsUpdate,
+	},
+	RoleMember: {
+		PermUsersRead,
+		PermTeamsRead,
+	},
+}
+
+// Valid บอกว่า role นี้เป็น role ที่ระบบรู้จักหรือไม่
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can บอกว่า role นี้มีสิทธิ์ perm หรือไม่
+func (r Role) Can(perm Permission) bool {
+	for _, p := range rolePermissions[r] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Can ตรวจสอบสิทธิ์ของผู้เรียกจาก principal ที่ JWTMiddleware ใส่ไว้ใน context
+func Can(r *http.Request, perm Permission) bool {
+	p, ok := CurrentPrincipal(r)
+	return ok && p.Can(perm)
+}
+
+// Require อนุญาตเฉพาะผู้เรียกที่มีสิทธิ์ครบทุกตัวใน perms ไม่เช่นนั้นตอบ 403
+func Require(perms ...Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, perm := range perms {
+				if !Can(r, perm) {
+					response.WriteError(w, r, response.Forbidden())
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSelfOr อนุญาตถ้า route variable param ตรงกับ user ID ของผู้เรียก
+// หรือถ้าผู้เรียกมีสิทธิ์ perm (เช่น admin แก้ไขผู้ใช้คนอื่น)
+// API key ไม่ได้รับข้อยกเว้นของเจ้าของ จึงต้องมี scope perm เสมอ
+func RequireSelfOr(param string, perm Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := CurrentPrincipal(r)
+			if !ok {
+				response.WriteError(w, r, response.Unauthorized())
+				return
+			}
+			id, err := strconv.Atoi(mux.Vars(r)[param])
+			self := err == nil && id == p.UserID && p.APIKeyID == 0
+			if !self && !p.Can(perm) {
+				response.WriteError(w, r, response.Forbidden())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
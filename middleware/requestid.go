@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"golang-backend/api/response"
+	"net/http"
+	"regexp"
+)
+
+// RequestIDHeader คือ header ที่ใช้รับและส่ง request ID
+const RequestIDHeader = "X-Request-ID"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID ใส่ request ID ให้ทุก request (ใช้ค่าจาก client ถ้ารูปแบบถูกต้อง)
+// และส่งกลับใน response header เพื่อใช้อ้างอิงกับ log ฝั่ง server
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			b := make([]byte, 8)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(response.WithRequestID(r.Context(), id)))
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"golang-backend/config"
+	"golang-backend/database"
+	"os"
+	"strconv"
+)
+
+const migrateUsage = `usage: golang-backend migrate <command>
+
+commands:
+  up           apply all pending migrations
+  down [N]     roll back the last N applied migrations (default 1)
+  status       list migrations and whether they have been applied`
+
+// runMigrate จัดการ subcommand "migrate" และคืนค่า exit code
+func runMigrate(cfg config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "up":
+		database.Connect(cfg.Database)
+		applied, err := database.MigrateUp(database.DB)
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate up:", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, "migrate down: N must be a positive integer")
+				return 2
+			}
+			steps = n
+		}
+		database.Connect(cfg.Database)
+		reverted, err := database.MigrateDown(database.DB, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate down:", err)
+			return 1
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no applied migrations")
+		}
+
+	case "status":
+		database.Connect(cfg.Database)
+		statuses, err := database.Status(database.DB)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate status:", err)
+			return 1
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.AppliedAt != nil {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, state)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
@@ -1,12 +1,106 @@
 package models
 
-// User struct to represent a user in the users table
+// User struct to represent a user in the users table (พร้อม team_name จากตาราง teams)
 type User struct {
-    ID        int    `json:"id"`
-    Username  string `json:"username"`
-    FirstName string `json:"first_name"`
-    LastName  string `json:"last_name"`
-    Email     string `json:"email"`
-    Phone     string `json:"phone"`
-    Password  string `json:"password"`
-}
\ No newline at end of file
+	ID        int     `json:"id"`
+	Username  string  `json:"username"`
+	FirstName string  `json:"firstname"`
+	LastName  string  `json:"lastname"`
+	Email     string  `json:"email"`
+	Phone     string  `json:"phone"`
+	Role      string  `json:"role"`
+	Password  string  `json:"password,omitempty"` // รับเข้าตอนสร้างผู้ใช้เท่านั้น ห้ามส่งกลับใน response
+	CreatedAt string  `json:"created_at"`
+	TeamId    *int    `json:"team_id"` // ทีมหลักของผู้ใช้ (ใช้ใน JWT claims)
+	TeamName  *string `json:"team_name"`
+	DeletedAt *string `json:"deleted_at,omitempty"` // มีค่าเมื่อผู้ใช้ถูก soft delete
+	// EmailVerified เป็น true หลังผู้ใช้เปิดลิงก์ยืนยันอีเมล และกลับเป็น false เมื่อเปลี่ยนอีเมล
+	EmailVerified bool `json:"email_verified"`
+	// TwoFactorEnabled เปลี่ยนได้ผ่าน /api/me/2fa เท่านั้น
+	TwoFactorEnabled bool `json:"two_factor_enabled"`
+	// Memberships คือทุกทีมที่ผู้ใช้เป็นสมาชิกจากตาราง team_members
+	Memberships []Membership `json:"memberships"`
+}
+
+// Team struct to represent a team in the teams table
+type Team struct {
+	ID           int     `json:"team_id"`
+	TeamName     string  `json:"team_name"`
+	ParentTeamID *int    `json:"parent_team_id"` // ทีมแม่ใน org tree (nil คือทีมระดับบนสุด)
+	CreatedAt    string  `json:"created_at"`
+	DeletedAt    *string `json:"deleted_at,omitempty"` // มีค่าเมื่อทีมถูก soft delete
+}
+
+// TeamNode คือทีมพร้อมทีมย่อยทั้งหมด ใช้แสดง org tree
+type TeamNode struct {
+	Team
+	Children []*TeamNode `json:"children"`
+}
+
+// role ของผู้ใช้ภายในทีม (team_members.role) แยกจาก role ของระบบใน users.role
+const (
+	MemberRoleLead     = "lead"
+	MemberRoleMember   = "member"
+	MemberRoleObserver = "observer"
+)
+
+// ValidMemberRole บอกว่า role เป็น role ภายในทีมที่รู้จักหรือไม่
+func ValidMemberRole(role string) bool {
+	switch role {
+	case MemberRoleLead, MemberRoleMember, MemberRoleObserver:
+		return true
+	}
+	return false
+}
+
+// Membership คือการเป็นสมาชิกทีมหนึ่งของผู้ใช้ ใช้แสดงใน payload ของผู้ใช้
+type Membership struct {
+	TeamID   int    `json:"team_id"`
+	TeamName string `json:"team_name"`
+	Role     string `json:"role"`
+	JoinedAt string `json:"joined_at"`
+}
+
+// TeamMember คือสมาชิกหนึ่งคนของทีม ใช้แสดงใน GET /api/teams/{team_id}/members
+type TeamMember struct {
+	TeamID    int    `json:"team_id"`
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	FirstName string `json:"firstname"`
+	LastName  string `json:"lastname"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	JoinedAt  string `json:"joined_at"`
+}
+
+// FieldChange คือค่าก่อนและหลังของฟิลด์หนึ่งใน audit log
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// AuditEntry คือการเปลี่ยนแปลงหนึ่งครั้งในตาราง audit_log
+type AuditEntry struct {
+	ID            int64                  `json:"id"`
+	ActorID       *int                   `json:"actor_id"` // nil เมื่อไม่มีผู้ใช้ที่ยืนยันตัวตน
+	ActorUsername string                 `json:"actor_username"`
+	Action        string                 `json:"action"`
+	EntityType    string                 `json:"entity_type"`
+	EntityID      int                    `json:"entity_id"`
+	Changes       map[string]FieldChange `json:"changes"`
+	IP            string                 `json:"ip"`
+	CreatedAt     string                 `json:"created_at"`
+}
+
+// APIKey คือ API key ของผู้ใช้ (ไม่มีตัว key ซึ่งแสดงเพียงครั้งเดียวตอนสร้าง)
+type APIKey struct {
+	ID     int    `json:"id"`
+	UserID int    `json:"user_id"`
+	Name   string `json:"name"`
+	// Prefix คือส่วนต้นของ key ใช้ระบุว่าเป็น key ไหนโดยไม่ต้องเปิดเผยทั้งหมด
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	ExpiresAt  string   `json:"expires_at"`
+	LastUsedAt *string  `json:"last_used_at"`
+	CreatedAt  string   `json:"created_at"`
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"golang-backend/config"
+	"log"
+	"time"
+)
+
+// runPurge ลบผู้ใช้และทีมที่ถูก soft delete นานกว่า retention ทุก interval จนกว่า ctx จะถูกยกเลิก
+func runPurge(ctx context.Context, cfg config.PurgeConfig, repos repositories) {
+	if cfg.Retention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(cfg.Interval))
+	defer ticker.Stop()
+
+	for {
+		purgeDeleted(ctx, time.Duration(cfg.Retention), repos)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func purgeDeleted(ctx context.Context, retention time.Duration, repos repositories) {
+	if n, err := repos.users.Purge(ctx, retention); err != nil {
+		log.Println("purge deleted users:", err)
+	} else if n > 0 {
+		log.Printf("purged %d deleted users", n)
+	}
+	if n, err := repos.teams.Purge(ctx, retention); err != nil {
+		log.Println("purge deleted teams:", err)
+	} else if n > 0 {
+		log.Printf("purged %d deleted teams", n)
+	}
+}
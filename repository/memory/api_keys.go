@@ -0,0 +1,128 @@
+package memory
+
+import (
+	"context"
+	"golang-backend/models"
+	"golang-backend/repository"
+	"slices"
+	"time"
+)
+
+type apiKeyRow struct {
+	key       models.APIKey
+	hash      string
+	expiresAt time.Time
+	lastUsed  *time.Time
+	revoked   bool
+}
+
+// APIKeyRepository คือ repository.APIKeyRepository ในหน่วยความจำ
+type APIKeyRepository struct {
+	s *Store
+}
+
+// publicAPIKey คืนสำเนาของ key พร้อมเวลาในรูปแบบเดียวกับ DATETIME ของ MySQL
+func publicAPIKey(row apiKeyRow) models.APIKey {
+	key := row.key
+	key.Scopes = slices.Clone(key.Scopes)
+	key.ExpiresAt = row.expiresAt.Format(dateTimeLayout)
+	if row.lastUsed != nil {
+		used := row.lastUsed.Format(dateTimeLayout)
+		key.LastUsedAt = &used
+	}
+	return key
+}
+
+func (r *APIKeyRepository) Create(ctx context.Context, key *models.APIKey, tokenHash string, ttl time.Duration) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findUser(key.UserID) < 0 {
+		return repository.ErrNotFound
+	}
+	now := s.now()
+	row := apiKeyRow{key: *key, hash: tokenHash, expiresAt: now.Add(ttl)}
+	row.key.ID = s.nextAPIKeyID
+	row.key.Scopes = slices.Clone(key.Scopes)
+	row.key.LastUsedAt = nil
+	row.key.CreatedAt = now.Format(dateTimeLayout)
+	s.nextAPIKeyID++
+	s.apiKeys = append(s.apiKeys, row)
+	*key = publicAPIKey(row)
+	return nil
+}
+
+func (r *APIKeyRepository) ListByUser(ctx context.Context, userID int) ([]models.APIKey, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := []models.APIKey{}
+	for i := len(s.apiKeys) - 1; i >= 0; i-- {
+		if row := s.apiKeys[i]; row.key.UserID == userID && !row.revoked {
+			keys = append(keys, publicAPIKey(row))
+		}
+	}
+	return keys, nil
+}
+
+func (r *APIKeyRepository) GetByHash(ctx context.Context, tokenHash string) (models.APIKey, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for _, row := range s.apiKeys {
+		if row.hash == tokenHash && !row.revoked && now.Before(row.expiresAt) {
+			return publicAPIKey(row), nil
+		}
+	}
+	return models.APIKey{}, repository.ErrNotFound
+}
+
+func (r *APIKeyRepository) Revoke(ctx context.Context, userID, id int) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.apiKeys {
+		if row := &s.apiKeys[i]; row.key.ID == id && row.key.UserID == userID && !row.revoked {
+			row.revoked = true
+			return nil
+		}
+	}
+	return repository.ErrNotFound
+}
+
+func (r *APIKeyRepository) RevokeUser(ctx context.Context, userID int) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.apiKeys {
+		if s.apiKeys[i].key.UserID == userID {
+			s.apiKeys[i].revoked = true
+		}
+	}
+	return nil
+}
+
+func (r *APIKeyRepository) Touch(ctx context.Context, id int) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for i := range s.apiKeys {
+		row := &s.apiKeys[i]
+		if row.key.ID != id {
+			continue
+		}
+		if row.lastUsed == nil || !now.Before(row.lastUsed.Add(time.Minute)) {
+			row.lastUsed = &now
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"context"
+	"golang-backend/models"
+	"golang-backend/repository"
+	"maps"
+	"time"
+)
+
+type auditRow struct {
+	entry     models.AuditEntry
+	createdAt time.Time
+}
+
+// AuditRepository คือ repository.AuditRepository ในหน่วยความจำ
+type AuditRepository struct {
+	s *Store
+}
+
+func (r *AuditRepository) Record(ctx context.Context, entry *models.AuditEntry) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	entry.ID = s.nextAuditID
+	entry.CreatedAt = now.Format(dateTimeLayout)
+	s.nextAuditID++
+
+	row := auditRow{entry: *entry, createdAt: now}
+	row.entry.ActorID = copyInt(entry.ActorID)
+	row.entry.Changes = maps.Clone(entry.Changes)
+	s.audit = append(s.audit, row)
+	return nil
+}
+
+func (r *AuditRepository) List(ctx context.Context, filter repository.AuditFilter) ([]models.AuditEntry, int, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []models.AuditEntry
+	// ใหม่สุดก่อน เหมือน ORDER BY id DESC
+	for i := len(s.audit) - 1; i >= 0; i-- {
+		row := s.audit[i]
+		e := row.entry
+		switch {
+		case filter.ActorID != nil && (e.ActorID == nil || *e.ActorID != *filter.ActorID),
+			filter.Action != "" && e.Action != filter.Action,
+			filter.EntityType != "" && e.EntityType != filter.EntityType,
+			filter.EntityID != nil && e.EntityID != *filter.EntityID,
+			filter.CreatedFrom != nil && row.createdAt.Before(*filter.CreatedFrom),
+			filter.CreatedBefore != nil && !row.createdAt.Before(*filter.CreatedBefore):
+			continue
+		}
+		e.ActorID = copyInt(e.ActorID)
+		e.Changes = maps.Clone(e.Changes)
+		matched = append(matched, e)
+	}
+
+	total := len(matched)
+	start := min(filter.Offset, total)
+	end := total
+	if filter.Limit > 0 {
+		end = min(start+filter.Limit, total)
+	}
+	return append([]models.AuditEntry{}, matched[start:end]...), total, nil
+}
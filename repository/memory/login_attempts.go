@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"context"
+	"golang-backend/repository"
+	"time"
+)
+
+type attemptRow struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// LoginAttemptRepository คือ repository.LoginAttemptRepository ในหน่วยความจำ
+type LoginAttemptRepository struct {
+	s *Store
+}
+
+func (r *LoginAttemptRepository) Get(ctx context.Context, key string) (repository.LoginAttempt, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	row, ok := s.attempts[key]
+	if !ok {
+		return repository.LoginAttempt{}, repository.ErrNotFound
+	}
+	now := s.now()
+	return repository.LoginAttempt{
+		Failures:         row.failures,
+		SinceLastFailure: now.Sub(row.lastFailure),
+		LockedFor:        max(row.lockedUntil.Sub(now), 0),
+	}, nil
+}
+
+func (r *LoginAttemptRepository) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	row := s.attempts[key]
+	if !row.lastFailure.After(now.Add(-window)) {
+		row.failures = 0
+	}
+	row.failures++
+	row.lastFailure = now
+	s.attempts[key] = row
+	return row.failures, nil
+}
+
+func (r *LoginAttemptRepository) Lock(ctx context.Context, key string, d time.Duration) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if row, ok := s.attempts[key]; ok {
+		row.lockedUntil = s.now().Add(d)
+		s.attempts[key] = row
+	}
+	return nil
+}
+
+func (r *LoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
@@ -0,0 +1,90 @@
+// Package memory คือ implementation ของ repository ที่เก็บข้อมูลในหน่วยความจำ
+// ใช้สำหรับทดสอบ handler โดยไม่ต้องมี MySQL
+package memory
+
+import (
+	"golang-backend/repository"
+	"sync"
+	"time"
+)
+
+const dateTimeLayout = "2006-01-02 15:04:05"
+
+// Store เก็บข้อมูลทุกตารางไว้ด้วยกัน เพื่อให้ join ระหว่าง users และ teams ทำงานเหมือน MySQL
+type Store struct {
+	mu   sync.Mutex
+	txMu sync.Mutex // ให้ Transactor ทำงานทีละ transaction
+
+	users   []userRow
+	teams   []teamRow
+	members []memberRow
+	tokens  []tokenRow
+	audit   []auditRow
+
+	recoveryCodes []recoveryRow
+	userTokens    []userTokenRow
+	apiKeys       []apiKeyRow
+	attempts      map[string]attemptRow
+
+	nextUserID  int
+	nextTeamID  int
+	nextTokenID int64
+	nextAuditID int64
+
+	nextAPIKeyID int
+
+	// Now คือเวลาปัจจุบัน เปลี่ยนได้ในการทดสอบ
+	Now func() time.Time
+}
+
+func NewStore() *Store {
+	return &Store{nextUserID: 1, nextTeamID: 1, nextTokenID: 1, nextAuditID: 1, nextAPIKeyID: 1, attempts: map[string]attemptRow{}, Now: time.Now}
+}
+
+// Users คืน repository.UserRepository ของ store นี้
+func (s *Store) Users() *UserRepository { return &UserRepository{s: s} }
+
+// Teams คืน repository.TeamRepository ของ store นี้
+func (s *Store) Teams() *TeamRepository { return &TeamRepository{s: s} }
+
+// TeamMembers คืน repository.TeamMemberRepository ของ store นี้
+func (s *Store) TeamMembers() *TeamMemberRepository { return &TeamMemberRepository{s: s} }
+
+// RefreshTokens คืน repository.RefreshTokenRepository ของ store นี้
+func (s *Store) RefreshTokens() *RefreshTokenRepository { return &RefreshTokenRepository{s: s} }
+
+// Audit คืน repository.AuditRepository ของ store นี้
+func (s *Store) Audit() *AuditRepository { return &AuditRepository{s: s} }
+
+// LoginAttempts คืน repository.LoginAttemptRepository ของ store นี้
+func (s *Store) LoginAttempts() *LoginAttemptRepository { return &LoginAttemptRepository{s: s} }
+
+// TwoFactor คืน repository.TwoFactorRepository ของ store นี้
+func (s *Store) TwoFactor() *TwoFactorRepository { return &TwoFactorRepository{s: s} }
+
+// UserTokens คืน repository.UserTokenRepository ของ store นี้
+func (s *Store) UserTokens() *UserTokenRepository { return &UserTokenRepository{s: s} }
+
+// APIKeys คืน repository.APIKeyRepository ของ store นี้
+func (s *Store) APIKeys() *APIKeyRepository { return &APIKeyRepository{s: s} }
+
+// Transactor คืน repository.Transactor ของ store นี้
+func (s *Store) Transactor() *Transactor { return &Transactor{s: s} }
+
+func (s *Store) now() time.Time {
+	return s.Now().Truncate(time.Second)
+}
+
+// ตรวจสอบตอน compile ว่า implement interface ครบ
+var (
+	_ repository.UserRepository         = (*UserRepository)(nil)
+	_ repository.TeamRepository         = (*TeamRepository)(nil)
+	_ repository.TeamMemberRepository   = (*TeamMemberRepository)(nil)
+	_ repository.RefreshTokenRepository = (*RefreshTokenRepository)(nil)
+	_ repository.AuditRepository        = (*AuditRepository)(nil)
+	_ repository.LoginAttemptRepository = (*LoginAttemptRepository)(nil)
+	_ repository.TwoFactorRepository    = (*TwoFactorRepository)(nil)
+	_ repository.UserTokenRepository    = (*UserTokenRepository)(nil)
+	_ repository.APIKeyRepository       = (*APIKeyRepository)(nil)
+	_ repository.Transactor             = (*Transactor)(nil)
+)
@@ -0,0 +1,127 @@
+package memory
+
+import (
+	"context"
+	"golang-backend/repository"
+	"time"
+)
+
+type tokenRow struct {
+	id        int64
+	userID    int
+	familyID  string
+	hash      string
+	expiresAt time.Time
+	revoked   bool
+	rotated   bool
+}
+
+// RefreshTokenRepository คือ repository.RefreshTokenRepository ในหน่วยความจำ
+type RefreshTokenRepository struct {
+	s *Store
+}
+
+func (s *Store) insertToken(userID int, familyID, hash string, ttl time.Duration) {
+	s.tokens = append(s.tokens, tokenRow{
+		id:        s.nextTokenID,
+		userID:    userID,
+		familyID:  familyID,
+		hash:      hash,
+		expiresAt: s.now().Add(ttl),
+	})
+	s.nextTokenID++
+}
+
+func (r *RefreshTokenRepository) Create(ctx context.Context, userID int, familyID, tokenHash string, ttl time.Duration) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findUser(userID) < 0 {
+		return repository.ErrNotFound
+	}
+	s.insertToken(userID, familyID, tokenHash, ttl)
+	return nil
+}
+
+func (r *RefreshTokenRepository) GetByHash(ctx context.Context, tokenHash string) (repository.RefreshToken, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.tokens {
+		if t.hash == tokenHash {
+			return repository.RefreshToken{
+				ID:       t.id,
+				UserID:   t.userID,
+				FamilyID: t.familyID,
+				Revoked:  t.revoked,
+				Rotated:  t.rotated,
+				Expired:  !s.now().Before(t.expiresAt),
+			}, nil
+		}
+	}
+	return repository.RefreshToken{}, repository.ErrNotFound
+}
+
+func (r *RefreshTokenRepository) Rotate(ctx context.Context, old repository.RefreshToken, newHash string, ttl time.Duration) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.tokens {
+		if s.tokens[i].id == old.ID {
+			if s.tokens[i].rotated {
+				return repository.ErrTokenReused
+			}
+			if s.tokens[i].revoked {
+				return repository.ErrNotFound
+			}
+			s.tokens[i].revoked, s.tokens[i].rotated = true, true
+			s.insertToken(old.UserID, old.FamilyID, newHash, ttl)
+			return nil
+		}
+	}
+	return repository.ErrNotFound
+}
+
+func (r *RefreshTokenRepository) revokeWhere(match func(tokenRow) bool) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.tokens {
+		if match(s.tokens[i]) {
+			s.tokens[i].revoked = true
+		}
+	}
+}
+
+func (r *RefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	r.revokeWhere(func(t tokenRow) bool { return t.familyID == familyID })
+	return nil
+}
+
+func (r *RefreshTokenRepository) RevokeUser(ctx context.Context, userID int) error {
+	r.revokeWhere(func(t tokenRow) bool { return t.userID == userID })
+	return nil
+}
+
+func (r *RefreshTokenRepository) RevokeOthers(ctx context.Context, userID int, keepFamilyID string) error {
+	r.revokeWhere(func(t tokenRow) bool { return t.userID == userID && t.familyID != keepFamilyID })
+	return nil
+}
+
+func (r *RefreshTokenRepository) FamilyActive(ctx context.Context, familyID string) (bool, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for _, t := range s.tokens {
+		if t.familyID == familyID && !t.revoked && now.Before(t.expiresAt) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
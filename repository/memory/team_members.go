@@ -0,0 +1,140 @@
+package memory
+
+import (
+	"context"
+	"golang-backend/models"
+	"golang-backend/repository"
+	"time"
+)
+
+type memberRow struct {
+	teamID   int
+	userID   int
+	role     string
+	joinedAt time.Time
+}
+
+// TeamMemberRepository คือ repository.TeamMemberRepository ในหน่วยความจำ
+type TeamMemberRepository struct {
+	s *Store
+}
+
+func (s *Store) findMember(teamID, userID int) int {
+	for i, m := range s.members {
+		if m.teamID == teamID && m.userID == userID {
+			return i
+		}
+	}
+	return -1
+}
+
+// addMember เพิ่ม membership (ถ้ายังไม่มี) และตั้งทีมหลักให้ผู้ใช้ที่ยังไม่มีทีมหลัก
+// ต้องถือ s.mu อยู่แล้ว
+func (s *Store) addMember(teamID, userID int, role string) (created bool) {
+	if i := s.findMember(teamID, userID); i >= 0 {
+		s.members[i].role = role
+		return false
+	}
+	s.members = append(s.members, memberRow{teamID: teamID, userID: userID, role: role, joinedAt: s.now()})
+	if i := s.findUser(userID); i >= 0 && s.users[i].user.TeamId == nil {
+		s.users[i].user.TeamId = copyInt(&teamID)
+	}
+	return true
+}
+
+// memberships คืนทุกทีมของผู้ใช้พร้อมชื่อทีม
+func (s *Store) memberships(userID int) []models.Membership {
+	memberships := []models.Membership{}
+	for _, m := range s.members {
+		if m.userID != userID {
+			continue
+		}
+		i := s.findActiveTeam(m.teamID)
+		if i < 0 {
+			continue
+		}
+		name := s.teams[i].team.TeamName
+		memberships = append(memberships, models.Membership{
+			TeamID:   m.teamID,
+			TeamName: name,
+			Role:     m.role,
+			JoinedAt: m.joinedAt.Format(dateTimeLayout),
+		})
+	}
+	return memberships
+}
+
+func (s *Store) isMember(teamID, userID int) bool {
+	return s.findMember(teamID, userID) >= 0
+}
+
+func (s *Store) teamMember(m memberRow) models.TeamMember {
+	u := s.users[s.findUser(m.userID)].user
+	return models.TeamMember{
+		TeamID:    m.teamID,
+		UserID:    m.userID,
+		Username:  u.Username,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		Email:     u.Email,
+		Role:      m.role,
+		JoinedAt:  m.joinedAt.Format(dateTimeLayout),
+	}
+}
+
+func (r *TeamMemberRepository) ListByTeam(ctx context.Context, teamID int) ([]models.TeamMember, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members := []models.TeamMember{}
+	for _, m := range s.members {
+		if m.teamID == teamID && s.findActiveUser(m.userID) >= 0 {
+			members = append(members, s.teamMember(m))
+		}
+	}
+	return members, nil
+}
+
+func (r *TeamMemberRepository) Get(ctx context.Context, teamID, userID int) (models.TeamMember, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findMember(teamID, userID)
+	if i < 0 || s.findActiveUser(userID) < 0 {
+		return models.TeamMember{}, repository.ErrNotFound
+	}
+	return s.teamMember(s.members[i]), nil
+}
+
+func (r *TeamMemberRepository) Add(ctx context.Context, teamID, userID int, role string) (bool, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// เหมือน foreign key ของ team_members (และไม่รับแถวที่ถูก soft delete)
+	if s.findActiveTeam(teamID) < 0 || s.findActiveUser(userID) < 0 {
+		return false, repository.ErrNotFound
+	}
+	return s.addMember(teamID, userID, role), nil
+}
+
+func (r *TeamMemberRepository) Remove(ctx context.Context, teamID, userID int) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findMember(teamID, userID)
+	if i < 0 {
+		return repository.ErrNotFound
+	}
+	s.members = append(s.members[:i], s.members[i+1:]...)
+
+	if j := s.findUser(userID); j >= 0 {
+		if t := s.users[j].user.TeamId; t != nil && *t == teamID {
+			s.users[j].user.TeamId = nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package memory
+
+import (
+	"context"
+	"golang-backend/models"
+	"golang-backend/repository"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+type teamRow struct {
+	team      models.Team
+	deletedAt *time.Time
+}
+
+// TeamRepository คือ repository.TeamRepository ในหน่วยความจำ
+type TeamRepository struct {
+	s *Store
+}
+
+func (s *Store) findTeam(id int) int {
+	for i := range s.teams {
+		if s.teams[i].team.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// findActiveTeam เหมือน findTeam แต่ไม่นับทีมที่ถูก soft delete
+func (s *Store) findActiveTeam(id int) int {
+	if i := s.findTeam(id); i >= 0 && s.teams[i].deletedAt == nil {
+		return i
+	}
+	return -1
+}
+
+// publicTeam คืนสำเนาของทีมพร้อม deleted_at
+func (s *Store) publicTeam(row teamRow) models.Team {
+	team := row.team
+	team.ParentTeamID = copyInt(team.ParentTeamID)
+	team.DeletedAt = formatTime(row.deletedAt)
+	return team
+}
+
+func (r *TeamRepository) List(ctx context.Context, filter repository.TeamFilter) ([]models.Team, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	teams := make([]models.Team, 0, len(s.teams))
+	for _, row := range s.teams {
+		if row.deletedAt == nil || filter.IncludeDeleted {
+			teams = append(teams, s.publicTeam(row))
+		}
+	}
+	return teams, nil
+}
+
+func (r *TeamRepository) GetByID(ctx context.Context, id int) (models.Team, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findActiveTeam(id)
+	if i < 0 {
+		return models.Team{}, repository.ErrNotFound
+	}
+	return s.publicTeam(s.teams[i]), nil
+}
+
+// GetForUpdate คือ GetByID เพราะ transaction ของ store ทำงานทีละตัวอยู่แล้ว
+func (r *TeamRepository) GetForUpdate(ctx context.Context, id int) (models.Team, error) {
+	return r.GetByID(ctx, id)
+}
+
+// teamConflict คืน *repository.ConflictError ถ้าทีมอื่นที่ยังไม่ถูกลบใช้ชื่อนี้อยู่ (ไม่สนตัวพิมพ์)
+func (s *Store) teamConflict(id int, name string) error {
+	for _, row := range s.teams {
+		if row.team.ID != id && row.deletedAt == nil && strings.EqualFold(row.team.TeamName, name) {
+			return &repository.ConflictError{Field: repository.FieldTeamName}
+		}
+	}
+	return nil
+}
+
+func (r *TeamRepository) Create(ctx context.Context, team *models.Team) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.teamConflict(0, team.TeamName); err != nil {
+		return err
+	}
+	team.ID = s.nextTeamID
+	team.CreatedAt = s.now().Format(dateTimeLayout)
+	s.nextTeamID++
+	row := teamRow{team: *team}
+	row.team.ParentTeamID = copyInt(team.ParentTeamID)
+	row.team.DeletedAt = nil
+	s.teams = append(s.teams, row)
+	return nil
+}
+
+func (r *TeamRepository) Update(ctx context.Context, id int, update repository.TeamUpdate) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findActiveTeam(id)
+	if i < 0 {
+		return repository.ErrNotFound
+	}
+	if update.TeamName != nil {
+		if err := s.teamConflict(id, *update.TeamName); err != nil {
+			return err
+		}
+		s.teams[i].team.TeamName = *update.TeamName
+	}
+	if update.SetParent {
+		s.teams[i].team.ParentTeamID = copyInt(update.ParentTeamID)
+	}
+	return nil
+}
+
+func (r *TeamRepository) Delete(ctx context.Context, id int) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findActiveTeam(id)
+	if i < 0 {
+		return repository.ErrNotFound
+	}
+	now := s.now()
+	s.teams[i].deletedAt = &now
+	return nil
+}
+
+func (r *TeamRepository) Restore(ctx context.Context, id int) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findTeam(id)
+	if i < 0 || s.teams[i].deletedAt == nil {
+		return repository.ErrNotFound
+	}
+	if err := s.teamConflict(id, s.teams[i].team.TeamName); err != nil {
+		return err
+	}
+	s.teams[i].deletedAt = nil
+	return nil
+}
+
+func (r *TeamRepository) Purge(ctx context.Context, retention time.Duration) (int64, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := s.now().Add(-retention)
+	var purged []int
+	kept := s.teams[:0]
+	for _, row := range s.teams {
+		if row.deletedAt != nil && row.deletedAt.Before(cutoff) {
+			purged = append(purged, row.team.ID)
+			continue
+		}
+		kept = append(kept, row)
+	}
+	s.teams = kept
+
+	// เหมือน ON DELETE SET NULL ของ users.team_id
+	for j := range s.users {
+		if t := s.users[j].user.TeamId; t != nil && slices.Contains(purged, *t) {
+			s.users[j].user.TeamId = nil
+		}
+	}
+	// เหมือน ON DELETE SET NULL ของ teams.parent_team_id
+	for j := range s.teams {
+		if p := s.teams[j].team.ParentTeamID; p != nil && slices.Contains(purged, *p) {
+			s.teams[j].team.ParentTeamID = nil
+		}
+	}
+	// และ ON DELETE CASCADE ของ team_members
+	members := s.members[:0]
+	for _, m := range s.members {
+		if !slices.Contains(purged, m.teamID) {
+			members = append(members, m)
+		}
+	}
+	s.members = members
+	return int64(len(purged)), nil
+}
+
+// maxTeamDepth จำกัดความลึกของการไล่ org tree เหมือนใน repository/mysql
+const maxTeamDepth = 100
+
+func (r *TeamRepository) Ancestors(ctx context.Context, id int) ([]models.Team, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findActiveTeam(id)
+	if i < 0 {
+		return nil, repository.ErrNotFound
+	}
+	var ancestors []models.Team
+	for depth, parent := 0, s.teams[i].team.ParentTeamID; parent != nil && depth < maxTeamDepth; depth++ {
+		j := s.findTeam(*parent)
+		if j < 0 {
+			break
+		}
+		if s.teams[j].deletedAt == nil {
+			ancestors = append(ancestors, s.publicTeam(s.teams[j]))
+		}
+		parent = s.teams[j].team.ParentTeamID
+	}
+
+	// เรียงจากทีมระดับบนสุดลงมา
+	slices.Reverse(ancestors)
+	if ancestors == nil {
+		ancestors = []models.Team{}
+	}
+	return ancestors, nil
+}
+
+func (r *TeamRepository) LockAncestors(ctx context.Context, id int) ([]int, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// transaction ของ store ทำงานทีละตัวอยู่แล้ว จึงไม่ต้อง lock แถวเพิ่ม
+	if s.findTeam(id) < 0 {
+		return nil, repository.ErrNotFound
+	}
+	var ids []int
+	for next := &id; next != nil && len(ids) <= maxTeamDepth && !slices.Contains(ids, *next); {
+		i := s.findTeam(*next)
+		if i < 0 {
+			break
+		}
+		ids = append(ids, *next)
+		next = s.teams[i].team.ParentTeamID
+	}
+	return ids, nil
+}
+
+func (r *TeamRepository) Descendants(ctx context.Context, id int) ([]models.Team, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findActiveTeam(id) < 0 {
+		return nil, repository.ErrNotFound
+	}
+	result := []models.Team{}
+	for _, team := range s.subtree(id)[1:] {
+		result = append(result, s.publicTeam(s.teams[s.findTeam(team)]))
+	}
+	return result, nil
+}
+
+// subtree คืน team ID ของทีม id และทีมย่อยทุกระดับ เรียงตามความลึกแล้วตาม team_id
+// ทีมที่ถูกลบและทีมย่อยของมันไม่ถูกรวม เหมือน recursive query บน MySQL
+func (s *Store) subtree(id int) []int {
+	ids := []int{id}
+	level := []int{id}
+	for depth := 0; len(level) > 0 && depth < maxTeamDepth; depth++ {
+		var next []int
+		for _, row := range s.teams {
+			if p := row.team.ParentTeamID; p != nil && row.deletedAt == nil && slices.Contains(level, *p) && !slices.Contains(ids, row.team.ID) {
+				next = append(next, row.team.ID)
+			}
+		}
+		sort.Ints(next)
+		ids = append(ids, next...)
+		level = next
+	}
+	return ids
+}
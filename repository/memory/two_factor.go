@@ -0,0 +1,124 @@
+package memory
+
+import (
+	"context"
+	"golang-backend/repository"
+)
+
+type recoveryRow struct {
+	userID int
+	hash   string
+	used   bool
+}
+
+// TwoFactorRepository คือ repository.TwoFactorRepository ในหน่วยความจำ
+type TwoFactorRepository struct {
+	s *Store
+}
+
+func (r *TwoFactorRepository) Get(ctx context.Context, userID int) (repository.TwoFactor, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findActiveUser(userID)
+	if i < 0 {
+		return repository.TwoFactor{}, repository.ErrNotFound
+	}
+	return repository.TwoFactor{Secret: s.users[i].totpSecret, Enabled: s.users[i].totpEnabled}, nil
+}
+
+func (r *TwoFactorRepository) SetSecret(ctx context.Context, userID int, secret string) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findActiveUser(userID)
+	if i < 0 {
+		return repository.ErrNotFound
+	}
+	s.users[i].totpSecret, s.users[i].totpEnabled, s.users[i].totpLastStep = secret, false, 0
+	return nil
+}
+
+func (r *TwoFactorRepository) Enable(ctx context.Context, userID int, recoveryHashes []string) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findActiveUser(userID)
+	if i < 0 || s.users[i].totpSecret == "" {
+		return repository.ErrNotFound
+	}
+	s.users[i].totpEnabled = true
+	s.removeRecoveryCodes(userID)
+	for _, hash := range recoveryHashes {
+		s.recoveryCodes = append(s.recoveryCodes, recoveryRow{userID: userID, hash: hash})
+	}
+	return nil
+}
+
+func (r *TwoFactorRepository) Disable(ctx context.Context, userID int) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findActiveUser(userID)
+	if i < 0 {
+		return repository.ErrNotFound
+	}
+	s.users[i].totpSecret, s.users[i].totpEnabled, s.users[i].totpLastStep = "", false, 0
+	s.removeRecoveryCodes(userID)
+	return nil
+}
+
+func (s *Store) removeRecoveryCodes(userID int) {
+	kept := s.recoveryCodes[:0]
+	for _, c := range s.recoveryCodes {
+		if c.userID != userID {
+			kept = append(kept, c)
+		}
+	}
+	s.recoveryCodes = kept
+}
+
+func (r *TwoFactorRepository) UseStep(ctx context.Context, userID int, step int64) (bool, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findUser(userID)
+	if i < 0 || s.users[i].totpLastStep >= step {
+		return false, nil
+	}
+	s.users[i].totpLastStep = step
+	return true, nil
+}
+
+func (r *TwoFactorRepository) UseRecoveryCode(ctx context.Context, userID int, hash string) (bool, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, c := range s.recoveryCodes {
+		if c.userID == userID && c.hash == hash && !c.used {
+			s.recoveryCodes[i].used = true
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *TwoFactorRepository) RecoveryCodesLeft(ctx context.Context, userID int) (int, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, c := range s.recoveryCodes {
+		if c.userID == userID && !c.used {
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,84 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+)
+
+type txKey struct{}
+
+// Transactor คือ repository.Transactor ในหน่วยความจำ transaction ทำงานทีละอัน
+// และถ้า fn คืน error ข้อมูลทุกตารางจะถูกคืนกลับเป็นสำเนาที่เก็บไว้ก่อนเริ่ม
+type Transactor struct {
+	s *Store
+}
+
+// snapshot คือสำเนาของทุกตารางใน Store
+type snapshot struct {
+	users   []userRow
+	teams   []teamRow
+	members []memberRow
+	tokens  []tokenRow
+	audit   []auditRow
+
+	attempts map[string]attemptRow
+	recovery []recoveryRow
+	mailed   []userTokenRow
+	apiKeys  []apiKeyRow
+
+	nextUserID  int
+	nextTeamID  int
+	nextTokenID int64
+	nextAuditID int64
+
+	nextAPIKeyID int
+}
+
+func (s *Store) snapshot() snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return snapshot{
+		users:       slices.Clone(s.users),
+		teams:       slices.Clone(s.teams),
+		members:     slices.Clone(s.members),
+		tokens:      slices.Clone(s.tokens),
+		audit:       slices.Clone(s.audit),
+		attempts:    maps.Clone(s.attempts),
+		recovery:    slices.Clone(s.recoveryCodes),
+		mailed:      slices.Clone(s.userTokens),
+		apiKeys:     slices.Clone(s.apiKeys),
+		nextUserID:  s.nextUserID,
+		nextTeamID:  s.nextTeamID,
+		nextTokenID: s.nextTokenID,
+		nextAuditID: s.nextAuditID,
+
+		nextAPIKeyID: s.nextAPIKeyID,
+	}
+}
+
+func (s *Store) restore(snap snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users, s.teams, s.members, s.tokens, s.audit = snap.users, snap.teams, snap.members, snap.tokens, snap.audit
+	s.attempts, s.recoveryCodes, s.userTokens, s.apiKeys = snap.attempts, snap.recovery, snap.mailed, snap.apiKeys
+	s.nextUserID, s.nextTeamID, s.nextTokenID, s.nextAuditID = snap.nextUserID, snap.nextTeamID, snap.nextTokenID, snap.nextAuditID
+	s.nextAPIKeyID = snap.nextAPIKeyID
+}
+
+func (t *Transactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(txKey{}) != nil {
+		return fn(ctx)
+	}
+
+	s := t.s
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	snap := s.snapshot()
+	if err := fn(context.WithValue(ctx, txKey{}, true)); err != nil {
+		s.restore(snap)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"context"
+	"golang-backend/repository"
+	"time"
+)
+
+type userTokenRow struct {
+	userID    int
+	purpose   string
+	hash      string
+	expiresAt time.Time
+	used      bool
+}
+
+// UserTokenRepository คือ repository.UserTokenRepository ในหน่วยความจำ
+type UserTokenRepository struct {
+	s *Store
+}
+
+func (r *UserTokenRepository) Create(ctx context.Context, userID int, purpose, tokenHash string, ttl time.Duration) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findUser(userID) < 0 {
+		return repository.ErrNotFound
+	}
+	s.userTokens = append(s.userTokens, userTokenRow{
+		userID:    userID,
+		purpose:   purpose,
+		hash:      tokenHash,
+		expiresAt: s.now().Add(ttl),
+	})
+	return nil
+}
+
+func (r *UserTokenRepository) Consume(ctx context.Context, purpose, tokenHash string) (int, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for _, t := range s.userTokens {
+		if t.hash != tokenHash || t.purpose != purpose || t.used || !now.Before(t.expiresAt) || s.findActiveUser(t.userID) < 0 {
+			continue
+		}
+		s.useUserTokens(t.userID, purpose)
+		return t.userID, nil
+	}
+	return 0, repository.ErrNotFound
+}
+
+// useUserTokens ทำให้ token ที่ยังไม่ถูกใช้ของผู้ใช้สำหรับ purpose นี้ใช้ไม่ได้อีก
+func (s *Store) useUserTokens(userID int, purpose string) {
+	for i := range s.userTokens {
+		if s.userTokens[i].userID == userID && s.userTokens[i].purpose == purpose {
+			s.userTokens[i].used = true
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"golang-backend/models"
+	"golang-backend/repository"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+type userRow struct {
+	user      models.User // TeamName ไม่ถูกเก็บ แต่ join จาก teams ตอนอ่าน
+	createdAt time.Time
+	deletedAt *time.Time
+
+	emailVerifiedAt *time.Time
+
+	totpSecret   string
+	totpEnabled  bool
+	totpLastStep int64 // 0 คือยังไม่เคยใช้รหัส
+}
+
+// UserRepository คือ repository.UserRepository ในหน่วยความจำ
+type UserRepository struct {
+	s *Store
+}
+
+func (s *Store) findUser(id int) int {
+	for i := range s.users {
+		if s.users[i].user.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// findActiveUser เหมือน findUser แต่ไม่นับผู้ใช้ที่ถูก soft delete
+func (s *Store) findActiveUser(id int) int {
+	if i := s.findUser(id); i >= 0 && s.users[i].deletedAt == nil {
+		return i
+	}
+	return -1
+}
+
+// publicUser คืนสำเนาของผู้ใช้พร้อม team_name และไม่มี password hash
+// ทีมหลักที่ถูก soft delete จะไม่แสดงเหมือนกับ memberships
+func (s *Store) publicUser(row userRow) models.User {
+	user := row.user
+	user.Password = ""
+	user.TeamName = nil
+	if user.TeamId != nil {
+		if i := s.findActiveTeam(*user.TeamId); i >= 0 {
+			name := s.teams[i].team.TeamName
+			user.TeamName = &name
+		} else {
+			user.TeamId = nil
+		}
+	}
+	user.Memberships = s.memberships(user.ID)
+	user.DeletedAt = formatTime(row.deletedAt)
+	user.EmailVerified = row.emailVerifiedAt != nil
+	user.TwoFactorEnabled = row.totpEnabled
+	return user
+}
+
+func (r *UserRepository) List(ctx context.Context, filter repository.UserFilter) ([]models.User, int, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []userRow
+	for _, row := range s.users {
+		u := row.user
+		if row.deletedAt != nil && !filter.IncludeDeleted {
+			continue
+		}
+		if filter.Role != "" && u.Role != filter.Role {
+			continue
+		}
+		if filter.TeamID != nil && !s.isMember(*filter.TeamID, u.ID) {
+			continue
+		}
+		if filter.EmailDomain != "" && !strings.HasSuffix(strings.ToLower(u.Email), "@"+strings.ToLower(filter.EmailDomain)) {
+			continue
+		}
+		if filter.CreatedFrom != nil && row.createdAt.Before(*filter.CreatedFrom) {
+			continue
+		}
+		if filter.CreatedBefore != nil && !row.createdAt.Before(*filter.CreatedBefore) {
+			continue
+		}
+		matched = append(matched, row)
+	}
+
+	less := func(a, b userRow) int {
+		switch filter.Sort {
+		case repository.SortUserUsername:
+			return strings.Compare(a.user.Username, b.user.Username)
+		case repository.SortUserLastName:
+			return strings.Compare(a.user.LastName, b.user.LastName)
+		case repository.SortUserCreatedAt:
+			return a.createdAt.Compare(b.createdAt)
+		}
+		return 0
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		c := less(matched[i], matched[j])
+		if c == 0 {
+			c = matched[i].user.ID - matched[j].user.ID
+		}
+		if filter.Desc {
+			return c > 0
+		}
+		return c < 0
+	})
+
+	total := len(matched)
+	if filter.Limit > 0 {
+		start := min(filter.Offset, total)
+		end := min(start+filter.Limit, total)
+		matched = matched[start:end]
+	}
+
+	users := make([]models.User, 0, len(matched))
+	for _, row := range matched {
+		users = append(users, s.publicUser(row))
+	}
+	return users, total, nil
+}
+
+func (r *UserRepository) ListByTeam(ctx context.Context, teamID int, recursive bool) ([]models.User, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	teams := []int{teamID}
+	if recursive {
+		teams = s.subtree(teamID)
+	}
+	users := []models.User{}
+	for _, row := range s.users {
+		if row.deletedAt != nil {
+			continue
+		}
+		for _, team := range teams {
+			if s.isMember(team, row.user.ID) {
+				users = append(users, s.publicUser(row))
+				break
+			}
+		}
+	}
+	return users, nil
+}
+
+func (r *UserRepository) GetByID(ctx context.Context, id int) (models.User, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findActiveUser(id)
+	if i < 0 {
+		return models.User{}, repository.ErrNotFound
+	}
+	return s.publicUser(s.users[i]), nil
+}
+
+// GetForUpdate คือ GetByID เพราะ transaction ของ store ทำงานทีละตัวอยู่แล้ว
+func (r *UserRepository) GetForUpdate(ctx context.Context, id int) (models.User, error) {
+	return r.GetByID(ctx, id)
+}
+
+func (r *UserRepository) GetByIdentifier(ctx context.Context, identifier string) (models.User, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// เทียบแบบไม่สนตัวพิมพ์เหมือน collation ของ MySQL
+	for _, row := range s.users {
+		if row.deletedAt == nil && (strings.EqualFold(row.user.Username, identifier) || strings.EqualFold(row.user.Email, identifier)) {
+			user := s.publicUser(row)
+			user.Password = row.user.Password
+			user.TeamName = nil
+			return user, nil
+		}
+	}
+	return models.User{}, repository.ErrNotFound
+}
+
+// userConflict คืน *repository.ConflictError ถ้าผู้ใช้อื่นที่ยังไม่ถูกลบใช้ username หรือ email นี้อยู่
+// (เหมือน unique index ของ MySQL ที่ไม่สนตัวพิมพ์)
+func (s *Store) userConflict(id int, username, email string) error {
+	for _, row := range s.users {
+		if row.user.ID == id || row.deletedAt != nil {
+			continue
+		}
+		if strings.EqualFold(row.user.Username, username) {
+			return &repository.ConflictError{Field: repository.FieldUsername}
+		}
+		if strings.EqualFold(row.user.Email, email) {
+			return &repository.ConflictError{Field: repository.FieldEmail}
+		}
+	}
+	return nil
+}
+
+func (r *UserRepository) Taken(ctx context.Context, field, value string) (bool, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, row := range s.users {
+		if row.deletedAt != nil {
+			continue
+		}
+		switch field {
+		case repository.FieldUsername:
+			if strings.EqualFold(row.user.Username, value) {
+				return true, nil
+			}
+		case repository.FieldEmail:
+			if strings.EqualFold(row.user.Email, value) {
+				return true, nil
+			}
+		default:
+			return false, fmt.Errorf("memory: %q is not a unique user field", field)
+		}
+	}
+	return false, nil
+}
+
+func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.userConflict(0, user.Username, user.Email); err != nil {
+		return err
+	}
+	now := s.now()
+	user.ID = s.nextUserID
+	user.CreatedAt = now.Format(dateTimeLayout)
+	s.nextUserID++
+
+	row := userRow{user: *user, createdAt: now}
+	row.user.TeamName = nil
+	row.user.Memberships = nil
+	row.user.EmailVerified = false
+	row.user.TwoFactorEnabled = false
+	s.users = append(s.users, row)
+	if user.TeamId != nil {
+		s.addMember(*user.TeamId, user.ID, models.MemberRoleMember)
+	}
+	return nil
+}
+
+func (r *UserRepository) Update(ctx context.Context, id int, update repository.UserUpdate) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findActiveUser(id)
+	if i < 0 {
+		return repository.ErrNotFound
+	}
+	u := &s.users[i].user
+	assign := func(dst *string, src *string) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	username, email := u.Username, u.Email
+	assign(&username, update.Username)
+	assign(&email, update.Email)
+	if err := s.userConflict(id, username, email); err != nil {
+		return err
+	}
+	// เหมือน repository/mysql: อีเมลใหม่ต้องยืนยันใหม่ และ token ที่ส่งไปยังอีเมลเดิมใช้ไม่ได้อีก
+	if update.Email != nil && *update.Email != u.Email {
+		s.users[i].emailVerifiedAt = nil
+		s.useUserTokens(id, repository.TokenEmailVerification)
+	}
+	assign(&u.Username, update.Username)
+	assign(&u.FirstName, update.FirstName)
+	assign(&u.LastName, update.LastName)
+	assign(&u.Email, update.Email)
+	assign(&u.Phone, update.Phone)
+	assign(&u.Role, update.Role)
+	assign(&u.Password, update.PasswordHash)
+	if update.SetTeam {
+		u.TeamId = copyInt(update.TeamID)
+		if update.TeamID != nil && !s.isMember(*update.TeamID, id) {
+			s.addMember(*update.TeamID, id, models.MemberRoleMember)
+		}
+	}
+	return nil
+}
+
+func (r *UserRepository) VerifyEmail(ctx context.Context, id int) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findActiveUser(id)
+	if i < 0 {
+		return repository.ErrNotFound
+	}
+	if s.users[i].emailVerifiedAt == nil {
+		now := s.now()
+		s.users[i].emailVerifiedAt = &now
+	}
+	return nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id int) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findActiveUser(id)
+	if i < 0 {
+		return repository.ErrNotFound
+	}
+	now := s.now()
+	s.users[i].deletedAt = &now
+	return nil
+}
+
+func (r *UserRepository) Restore(ctx context.Context, id int) error {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.findUser(id)
+	if i < 0 || s.users[i].deletedAt == nil {
+		return repository.ErrNotFound
+	}
+	if err := s.userConflict(id, s.users[i].user.Username, s.users[i].user.Email); err != nil {
+		return err
+	}
+	s.users[i].deletedAt = nil
+	return nil
+}
+
+func (r *UserRepository) Purge(ctx context.Context, retention time.Duration) (int64, error) {
+	s := r.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := s.now().Add(-retention)
+	var purged []int
+	kept := s.users[:0]
+	for _, row := range s.users {
+		if row.deletedAt != nil && row.deletedAt.Before(cutoff) {
+			purged = append(purged, row.user.ID)
+			continue
+		}
+		kept = append(kept, row)
+	}
+	s.users = kept
+
+	// เหมือน ON DELETE CASCADE ของ refresh_tokens, team_members, recovery_codes และ user_tokens
+	tokens := s.tokens[:0]
+	for _, t := range s.tokens {
+		if !slices.Contains(purged, t.userID) {
+			tokens = append(tokens, t)
+		}
+	}
+	s.tokens = tokens
+	members := s.members[:0]
+	for _, m := range s.members {
+		if !slices.Contains(purged, m.userID) {
+			members = append(members, m)
+		}
+	}
+	s.members = members
+	codes := s.recoveryCodes[:0]
+	for _, c := range s.recoveryCodes {
+		if !slices.Contains(purged, c.userID) {
+			codes = append(codes, c)
+		}
+	}
+	s.recoveryCodes = codes
+	mailed := s.userTokens[:0]
+	for _, t := range s.userTokens {
+		if !slices.Contains(purged, t.userID) {
+			mailed = append(mailed, t)
+		}
+	}
+	s.userTokens = mailed
+	apiKeys := s.apiKeys[:0]
+	for _, k := range s.apiKeys {
+		if !slices.Contains(purged, k.key.UserID) {
+			apiKeys = append(apiKeys, k)
+		}
+	}
+	s.apiKeys = apiKeys
+	return int64(len(purged)), nil
+}
+
+func copyInt(v *int) *int {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	return &c
+}
+
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	v := t.Format(dateTimeLayout)
+	return &v
+}
@@ -0,0 +1,107 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"golang-backend/models"
+	"golang-backend/repository"
+	"strings"
+	"time"
+)
+
+// APIKeyRepository คือ repository.APIKeyRepository บน MySQL
+type APIKeyRepository struct {
+	db *sql.DB
+}
+
+func NewAPIKeyRepository(db *sql.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+const selectAPIKey = `
+	SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, created_at
+	FROM api_keys`
+
+func scanAPIKey(row interface{ Scan(...any) error }) (models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &scopes, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt)
+	key.Scopes = strings.Fields(scopes)
+	return key, err
+}
+
+func (r *APIKeyRepository) Create(ctx context.Context, key *models.APIKey, tokenHash string, ttl time.Duration) error {
+	return withinTx(ctx, r.db, func(ctx context.Context) error {
+		result, err := conn(ctx, r.db).ExecContext(ctx, `
+			INSERT INTO api_keys (user_id, name, prefix, token_hash, scopes, expires_at, created_at)
+			VALUES (?, ?, ?, ?, ?, DATE_ADD(NOW(), INTERVAL ? SECOND), NOW())
+		`, key.UserID, key.Name, key.Prefix, tokenHash, strings.Join(key.Scopes, " "), int64(ttl/time.Second))
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		created, err := scanAPIKey(conn(ctx, r.db).QueryRowContext(ctx, selectAPIKey+" WHERE id = ?", id))
+		if err != nil {
+			return err
+		}
+		*key = created
+		return nil
+	})
+}
+
+func (r *APIKeyRepository) ListByUser(ctx context.Context, userID int) ([]models.APIKey, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, selectAPIKey+" WHERE user_id = ? AND revoked_at IS NULL ORDER BY id DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *APIKeyRepository) GetByHash(ctx context.Context, tokenHash string) (models.APIKey, error) {
+	key, err := scanAPIKey(conn(ctx, r.db).QueryRowContext(ctx, selectAPIKey+`
+		WHERE token_hash = ? AND revoked_at IS NULL AND expires_at > NOW()
+	`, tokenHash))
+	if err == sql.ErrNoRows {
+		return key, repository.ErrNotFound
+	}
+	return key, err
+}
+
+func (r *APIKeyRepository) Revoke(ctx context.Context, userID, id int) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE api_keys SET revoked_at = NOW() WHERE id = ? AND user_id = ? AND revoked_at IS NULL", id, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *APIKeyRepository) RevokeUser(ctx context.Context, userID int) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE api_keys SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL", userID)
+	return err
+}
+
+func (r *APIKeyRepository) Touch(ctx context.Context, id int) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE id = ? AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL 1 MINUTE)
+	`, id)
+	return err
+}
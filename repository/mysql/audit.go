@@ -0,0 +1,103 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"golang-backend/models"
+	"golang-backend/repository"
+	"strings"
+)
+
+// AuditRepository คือ repository.AuditRepository บน MySQL
+// Record ใช้ transaction จาก ctx ถ้ามี เพื่อให้ audit log ถูก commit พร้อมการเปลี่ยนแปลง
+type AuditRepository struct {
+	db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+func (r *AuditRepository) Record(ctx context.Context, entry *models.AuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+	result, err := conn(ctx, r.db).ExecContext(ctx, `
+		INSERT INTO audit_log (actor_id, actor_username, action, entity_type, entity_id, changes, ip)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, entry.ActorID, entry.ActorUsername, entry.Action, entry.EntityType, entry.EntityID, changes, entry.IP)
+	if err != nil {
+		return err
+	}
+	if entry.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+	return conn(ctx, r.db).QueryRowContext(ctx, "SELECT created_at FROM audit_log WHERE id = ?", entry.ID).Scan(&entry.CreatedAt)
+}
+
+func (r *AuditRepository) List(ctx context.Context, filter repository.AuditFilter) ([]models.AuditEntry, int, error) {
+	var clauses []string
+	var args []any
+
+	if filter.ActorID != nil {
+		clauses = append(clauses, "actor_id = ?")
+		args = append(args, *filter.ActorID)
+	}
+	if filter.Action != "" {
+		clauses = append(clauses, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.EntityType != "" {
+		clauses = append(clauses, "entity_type = ?")
+		args = append(args, filter.EntityType)
+	}
+	if filter.EntityID != nil {
+		clauses = append(clauses, "entity_id = ?")
+		args = append(args, *filter.EntityID)
+	}
+	if filter.CreatedFrom != nil {
+		clauses = append(clauses, "created_at >= ?")
+		args = append(args, filter.CreatedFrom.Format(dateTimeLayout))
+	}
+	if filter.CreatedBefore != nil {
+		clauses = append(clauses, "created_at < ?")
+		args = append(args, filter.CreatedBefore.Format(dateTimeLayout))
+	}
+
+	where := ""
+	if len(clauses) > 0 {
+		where = " WHERE " + strings.Join(clauses, " AND ")
+	}
+
+	var total int
+	if err := conn(ctx, r.db).QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_log"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT id, actor_id, actor_username, action, entity_type, entity_id, changes, ip, created_at FROM audit_log` + where + " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		var changes []byte
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.ActorUsername, &e.Action, &e.EntityType, &e.EntityID, &changes, &e.IP, &e.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		if err := json.Unmarshal(changes, &e.Changes); err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
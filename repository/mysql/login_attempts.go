@@ -0,0 +1,63 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"golang-backend/repository"
+	"time"
+)
+
+// LoginAttemptRepository คือ repository.LoginAttemptRepository บน MySQL
+type LoginAttemptRepository struct {
+	db *sql.DB
+}
+
+func NewLoginAttemptRepository(db *sql.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+func (r *LoginAttemptRepository) Get(ctx context.Context, key string) (repository.LoginAttempt, error) {
+	var a repository.LoginAttempt
+	var since, locked int64
+	err := conn(ctx, r.db).QueryRowContext(ctx, `
+		SELECT failures,
+			TIMESTAMPDIFF(SECOND, last_failure_at, NOW()),
+			COALESCE(GREATEST(TIMESTAMPDIFF(SECOND, NOW(), locked_until), 0), 0)
+		FROM login_attempts
+		WHERE attempt_key = ?
+	`, key).Scan(&a.Failures, &since, &locked)
+	if err == sql.ErrNoRows {
+		return a, repository.ErrNotFound
+	}
+	a.SinceLastFailure = time.Duration(since) * time.Second
+	a.LockedFor = time.Duration(locked) * time.Second
+	return a, err
+}
+
+func (r *LoginAttemptRepository) RecordFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	var failures int
+	err := withinTx(ctx, r.db, func(ctx context.Context) error {
+		// failures ถูกคำนวณก่อน last_failure_at จึงยังเทียบกับเวลาของครั้งก่อน
+		_, err := conn(ctx, r.db).ExecContext(ctx, `
+			INSERT INTO login_attempts (attempt_key, failures, last_failure_at) VALUES (?, 1, NOW())
+			ON DUPLICATE KEY UPDATE
+				failures = IF(last_failure_at <= DATE_SUB(NOW(), INTERVAL ? SECOND), 1, failures + 1),
+				last_failure_at = NOW()
+		`, key, int64(window/time.Second))
+		if err != nil {
+			return err
+		}
+		return conn(ctx, r.db).QueryRowContext(ctx, "SELECT failures FROM login_attempts WHERE attempt_key = ?", key).Scan(&failures)
+	})
+	return failures, err
+}
+
+func (r *LoginAttemptRepository) Lock(ctx context.Context, key string, d time.Duration) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE login_attempts SET locked_until = DATE_ADD(NOW(), INTERVAL ? SECOND) WHERE attempt_key = ?", int64(d/time.Second), key)
+	return err
+}
+
+func (r *LoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, "DELETE FROM login_attempts WHERE attempt_key = ?", key)
+	return err
+}
@@ -0,0 +1,76 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"golang-backend/repository"
+	"strings"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+)
+
+// dateTimeLayout คือรูปแบบของคอลัมน์ DATETIME เมื่ออ่านโดยไม่เปิด parseTime
+const dateTimeLayout = "2006-01-02 15:04:05"
+
+func affectedOrNotFound(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// isForeignKeyError บอกว่า error มาจากการอ้างถึงแถวที่ไม่มีอยู่ (ER_NO_REFERENCED_ROW_2)
+func isForeignKeyError(err error) bool {
+	var mysqlErr *mysqldriver.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1452
+}
+
+// uniqueKeys คือ unique index ของแต่ละฟิลด์ที่ต้องไม่ซ้ำ (migration 0013)
+var uniqueKeys = map[string]string{
+	"uq_users_username":  repository.FieldUsername,
+	"uq_users_email":     repository.FieldEmail,
+	"uq_teams_team_name": repository.FieldTeamName,
+}
+
+// conflictError แปลง error จากค่าซ้ำ (ER_DUP_ENTRY) เป็น *repository.ConflictError ของฟิลด์นั้น
+// ข้อความของ MySQL อยู่ในรูป "Duplicate entry 'x' for key 'users.uq_users_email'" (8.0) หรือ "... for key 'uq_users_email'"
+func conflictError(err error) error {
+	var mysqlErr *mysqldriver.MySQLError
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != 1062 {
+		return err
+	}
+	i := strings.LastIndex(mysqlErr.Message, "for key '")
+	if i < 0 {
+		return err
+	}
+	key := strings.TrimSuffix(mysqlErr.Message[i+len("for key '"):], "'")
+	if _, name, ok := strings.Cut(key, "."); ok {
+		key = name
+	}
+	if field, ok := uniqueKeys[key]; ok {
+		return &repository.ConflictError{Field: field}
+	}
+	return err
+}
+
+func escapeLike(v string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(v)
+}
+
+// ตรวจสอบตอน compile ว่า implement interface ครบ
+var (
+	_ repository.UserRepository         = (*UserRepository)(nil)
+	_ repository.TeamRepository         = (*TeamRepository)(nil)
+	_ repository.TeamMemberRepository   = (*TeamMemberRepository)(nil)
+	_ repository.RefreshTokenRepository = (*RefreshTokenRepository)(nil)
+	_ repository.AuditRepository        = (*AuditRepository)(nil)
+	_ repository.LoginAttemptRepository = (*LoginAttemptRepository)(nil)
+	_ repository.TwoFactorRepository    = (*TwoFactorRepository)(nil)
+	_ repository.UserTokenRepository    = (*UserTokenRepository)(nil)
+	_ repository.APIKeyRepository       = (*APIKeyRepository)(nil)
+	_ repository.Transactor             = (*Transactor)(nil)
+)
@@ -0,0 +1,94 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"golang-backend/repository"
+	"time"
+)
+
+// RefreshTokenRepository คือ repository.RefreshTokenRepository บน MySQL
+// เวลาหมดอายุคำนวณด้วย NOW() ของ MySQL เพื่อไม่ให้ขึ้นกับ timezone ของแอป
+type RefreshTokenRepository struct {
+	db *sql.DB
+}
+
+func NewRefreshTokenRepository(db *sql.DB) *RefreshTokenRepository {
+	return &RefreshTokenRepository{db: db}
+}
+
+const insertRefreshToken = `
+	INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at, created_at)
+	VALUES (?, ?, ?, DATE_ADD(NOW(), INTERVAL ? SECOND), NOW())`
+
+func (r *RefreshTokenRepository) Create(ctx context.Context, userID int, familyID, tokenHash string, ttl time.Duration) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, insertRefreshToken, userID, familyID, tokenHash, int64(ttl/time.Second))
+	return err
+}
+
+func (r *RefreshTokenRepository) GetByHash(ctx context.Context, tokenHash string) (repository.RefreshToken, error) {
+	var t repository.RefreshToken
+	err := conn(ctx, r.db).QueryRowContext(ctx, `
+		SELECT id, user_id, family_id, revoked_at IS NOT NULL, rotated_at IS NOT NULL, expires_at <= NOW()
+		FROM refresh_tokens
+		WHERE token_hash = ?
+	`, tokenHash).Scan(&t.ID, &t.UserID, &t.FamilyID, &t.Revoked, &t.Rotated, &t.Expired)
+	if err == sql.ErrNoRows {
+		return t, repository.ErrNotFound
+	}
+	return t, err
+}
+
+func (r *RefreshTokenRepository) Rotate(ctx context.Context, old repository.RefreshToken, newHash string, ttl time.Duration) error {
+	return withinTx(ctx, r.db, func(ctx context.Context) error {
+		// revoke token เดิมแบบมีเงื่อนไข ถ้ามี request อื่นใช้ token นี้ไปก่อนถือว่าเป็นการใช้ซ้ำ
+		result, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = NOW(), rotated_at = NOW() WHERE id = ? AND revoked_at IS NULL", old.ID)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			var rotated bool
+			err := conn(ctx, r.db).QueryRowContext(ctx, "SELECT rotated_at IS NOT NULL FROM refresh_tokens WHERE id = ?", old.ID).Scan(&rotated)
+			if err == sql.ErrNoRows || (err == nil && !rotated) {
+				return repository.ErrNotFound
+			}
+			if err != nil {
+				return err
+			}
+			return repository.ErrTokenReused
+		}
+
+		_, err = conn(ctx, r.db).ExecContext(ctx, insertRefreshToken, old.UserID, old.FamilyID, newHash, int64(ttl/time.Second))
+		return err
+	})
+}
+
+func (r *RefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = ? AND revoked_at IS NULL", familyID)
+	return err
+}
+
+func (r *RefreshTokenRepository) RevokeUser(ctx context.Context, userID int) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL", userID)
+	return err
+}
+
+func (r *RefreshTokenRepository) RevokeOthers(ctx context.Context, userID int, keepFamilyID string) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = ? AND family_id <> ? AND revoked_at IS NULL", userID, keepFamilyID)
+	return err
+}
+
+func (r *RefreshTokenRepository) FamilyActive(ctx context.Context, familyID string) (bool, error) {
+	var one int
+	err := conn(ctx, r.db).QueryRowContext(ctx, `
+		SELECT 1 FROM refresh_tokens
+		WHERE family_id = ? AND revoked_at IS NULL AND expires_at > NOW()
+		LIMIT 1
+	`, familyID).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
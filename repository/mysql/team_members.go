@@ -0,0 +1,139 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"golang-backend/models"
+	"golang-backend/repository"
+	"strings"
+)
+
+// TeamMemberRepository คือ repository.TeamMemberRepository บน MySQL
+type TeamMemberRepository struct {
+	db *sql.DB
+}
+
+func NewTeamMemberRepository(db *sql.DB) *TeamMemberRepository {
+	return &TeamMemberRepository{db: db}
+}
+
+const selectTeamMember = `
+	SELECT tm.team_id, tm.user_id, u.username, u.firstname, u.lastname, u.email, tm.role, tm.joined_at
+	FROM team_members tm
+	JOIN users u ON u.id = tm.user_id`
+
+func scanTeamMember(row interface{ Scan(...any) error }) (models.TeamMember, error) {
+	var m models.TeamMember
+	err := row.Scan(&m.TeamID, &m.UserID, &m.Username, &m.FirstName, &m.LastName, &m.Email, &m.Role, &m.JoinedAt)
+	return m, err
+}
+
+func (r *TeamMemberRepository) ListByTeam(ctx context.Context, teamID int) ([]models.TeamMember, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, selectTeamMember+" WHERE tm.team_id = ? AND u.deleted_at IS NULL ORDER BY tm.joined_at, tm.user_id", teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.TeamMember{}
+	for rows.Next() {
+		m, err := scanTeamMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func (r *TeamMemberRepository) Get(ctx context.Context, teamID, userID int) (models.TeamMember, error) {
+	m, err := scanTeamMember(conn(ctx, r.db).QueryRowContext(ctx, selectTeamMember+" WHERE tm.team_id = ? AND tm.user_id = ? AND u.deleted_at IS NULL", teamID, userID))
+	if err == sql.ErrNoRows {
+		return m, repository.ErrNotFound
+	}
+	return m, err
+}
+
+func (r *TeamMemberRepository) Add(ctx context.Context, teamID, userID int, role string) (bool, error) {
+	// foreign key ไม่รู้จัก soft delete จึงต้องตรวจสอบเอง
+	var one int
+	err := conn(ctx, r.db).QueryRowContext(ctx, `
+		SELECT 1 FROM users u JOIN teams t ON t.team_id = ?
+		WHERE u.id = ? AND u.deleted_at IS NULL AND t.deleted_at IS NULL
+	`, teamID, userID).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, repository.ErrNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// affected rows: 1 คือเพิ่มใหม่ 2 คือเปลี่ยน role 0 คือ role เดิม
+	result, err := conn(ctx, r.db).ExecContext(ctx, `
+		INSERT INTO team_members (team_id, user_id, role, joined_at) VALUES (?, ?, ?, NOW())
+		ON DUPLICATE KEY UPDATE role = VALUES(role)
+	`, teamID, userID, role)
+	if isForeignKeyError(err) {
+		return false, repository.ErrNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil || n != 1 {
+		return false, err
+	}
+
+	_, err = conn(ctx, r.db).ExecContext(ctx, "UPDATE users SET team_id = ? WHERE id = ? AND team_id IS NULL", teamID, userID)
+	return true, err
+}
+
+func (r *TeamMemberRepository) Remove(ctx context.Context, teamID, userID int) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, "DELETE FROM team_members WHERE team_id = ? AND user_id = ?", teamID, userID)
+	if err != nil {
+		return err
+	}
+	if err := affectedOrNotFound(result); err != nil {
+		return err
+	}
+	_, err = conn(ctx, r.db).ExecContext(ctx, "UPDATE users SET team_id = NULL WHERE id = ? AND team_id = ?", userID, teamID)
+	return err
+}
+
+// loadMemberships เติม Memberships ให้ผู้ใช้ทุกคนด้วย query เดียว
+func loadMemberships(ctx context.Context, db querier, users []models.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+	index := make(map[int]int, len(users))
+	placeholders := make([]string, len(users))
+	args := make([]any, len(users))
+	for i := range users {
+		users[i].Memberships = []models.Membership{}
+		index[users[i].ID] = i
+		placeholders[i] = "?"
+		args[i] = users[i].ID
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT tm.user_id, tm.team_id, t.team_name, tm.role, tm.joined_at
+		FROM team_members tm
+		JOIN teams t ON t.team_id = tm.team_id AND t.deleted_at IS NULL
+		WHERE tm.user_id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY tm.joined_at, tm.team_id`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int
+		var m models.Membership
+		if err := rows.Scan(&userID, &m.TeamID, &m.TeamName, &m.Role, &m.JoinedAt); err != nil {
+			return err
+		}
+		u := &users[index[userID]]
+		u.Memberships = append(u.Memberships, m)
+	}
+	return rows.Err()
+}
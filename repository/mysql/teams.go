@@ -0,0 +1,195 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"golang-backend/models"
+	"golang-backend/repository"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TeamRepository คือ repository.TeamRepository บน MySQL
+type TeamRepository struct {
+	db *sql.DB
+}
+
+func NewTeamRepository(db *sql.DB) *TeamRepository {
+	return &TeamRepository{db: db}
+}
+
+// maxTeamDepth จำกัดความลึกของ recursive query เผื่อข้อมูลเก่ามี cycle อยู่
+const maxTeamDepth = 100
+
+const selectTeam = "SELECT t.team_id, t.team_name, t.parent_team_id, t.created_at, t.deleted_at FROM teams t"
+
+func scanTeam(row interface{ Scan(...any) error }) (models.Team, error) {
+	var team models.Team
+	err := row.Scan(&team.ID, &team.TeamName, &team.ParentTeamID, &team.CreatedAt, &team.DeletedAt)
+	return team, err
+}
+
+func (r *TeamRepository) queryTeams(ctx context.Context, query string, args ...any) ([]models.Team, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []models.Team{}
+	for rows.Next() {
+		team, err := scanTeam(rows)
+		if err != nil {
+			return nil, err
+		}
+		teams = append(teams, team)
+	}
+	return teams, rows.Err()
+}
+
+func (r *TeamRepository) List(ctx context.Context, filter repository.TeamFilter) ([]models.Team, error) {
+	if filter.IncludeDeleted {
+		return r.queryTeams(ctx, selectTeam+" ORDER BY t.team_id")
+	}
+	return r.queryTeams(ctx, selectTeam+" WHERE t.deleted_at IS NULL ORDER BY t.team_id")
+}
+
+func (r *TeamRepository) GetByID(ctx context.Context, id int) (models.Team, error) {
+	team, err := scanTeam(conn(ctx, r.db).QueryRowContext(ctx, selectTeam+" WHERE t.team_id = ? AND t.deleted_at IS NULL", id))
+	if err == sql.ErrNoRows {
+		return team, repository.ErrNotFound
+	}
+	return team, err
+}
+
+func (r *TeamRepository) GetForUpdate(ctx context.Context, id int) (models.Team, error) {
+	team, err := scanTeam(conn(ctx, r.db).QueryRowContext(ctx, selectTeam+" WHERE t.team_id = ? AND t.deleted_at IS NULL FOR UPDATE", id))
+	if err == sql.ErrNoRows {
+		return team, repository.ErrNotFound
+	}
+	return team, err
+}
+
+func (r *TeamRepository) Create(ctx context.Context, team *models.Team) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, "INSERT INTO teams (team_name, parent_team_id, created_at) VALUES (?, ?, NOW())", team.TeamName, team.ParentTeamID)
+	if err != nil {
+		return conflictError(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	team.ID = int(id)
+	return conn(ctx, r.db).QueryRowContext(ctx, "SELECT created_at FROM teams WHERE team_id = ?", id).Scan(&team.CreatedAt)
+}
+
+func (r *TeamRepository) Update(ctx context.Context, id int, update repository.TeamUpdate) error {
+	var setClauses []string
+	var params []any
+	if update.TeamName != nil {
+		setClauses = append(setClauses, "team_name = ?")
+		params = append(params, *update.TeamName)
+	}
+	if update.SetParent {
+		setClauses = append(setClauses, "parent_team_id = ?")
+		params = append(params, update.ParentTeamID)
+	}
+	if len(setClauses) == 0 {
+		return nil
+	}
+
+	params = append(params, id)
+	result, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE teams SET "+strings.Join(setClauses, ", ")+" WHERE team_id = ? AND deleted_at IS NULL", params...)
+	if err != nil {
+		return conflictError(err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	_, err = r.GetByID(ctx, id)
+	return err
+}
+
+func (r *TeamRepository) Delete(ctx context.Context, id int) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE teams SET deleted_at = NOW() WHERE team_id = ? AND deleted_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	return affectedOrNotFound(result)
+}
+
+func (r *TeamRepository) Restore(ctx context.Context, id int) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE teams SET deleted_at = NULL WHERE team_id = ? AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return conflictError(err)
+	}
+	return affectedOrNotFound(result)
+}
+
+func (r *TeamRepository) Purge(ctx context.Context, retention time.Duration) (int64, error) {
+	// users.team_id และ teams.parent_team_id เป็น NULL ตาม ON DELETE SET NULL, team_members ถูกลบตาม CASCADE
+	result, err := conn(ctx, r.db).ExecContext(ctx, "DELETE FROM teams WHERE deleted_at < DATE_SUB(NOW(), INTERVAL ? SECOND)", int64(retention/time.Second))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *TeamRepository) Ancestors(ctx context.Context, id int) ([]models.Team, error) {
+	if _, err := r.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return r.queryTeams(ctx, `
+		WITH RECURSIVE ancestors (team_id, parent_team_id, depth) AS (
+			SELECT team_id, parent_team_id, 0 FROM teams WHERE team_id = ?
+			UNION ALL
+			SELECT p.team_id, p.parent_team_id, a.depth + 1
+			FROM teams p
+			JOIN ancestors a ON p.team_id = a.parent_team_id
+			WHERE a.depth < ?
+		)
+		`+selectTeam+`
+		JOIN ancestors a ON a.team_id = t.team_id
+		WHERE a.depth > 0 AND t.deleted_at IS NULL
+		ORDER BY a.depth DESC`, id, maxTeamDepth)
+}
+
+func (r *TeamRepository) LockAncestors(ctx context.Context, id int) ([]int, error) {
+	q := conn(ctx, r.db)
+	var ids []int
+	for next := &id; next != nil && len(ids) <= maxTeamDepth && !slices.Contains(ids, *next); {
+		var parent *int
+		err := q.QueryRowContext(ctx, "SELECT parent_team_id FROM teams WHERE team_id = ? FOR UPDATE", *next).Scan(&parent)
+		if err == sql.ErrNoRows {
+			if len(ids) == 0 {
+				return nil, repository.ErrNotFound
+			}
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, *next)
+		next = parent
+	}
+	return ids, nil
+}
+
+func (r *TeamRepository) Descendants(ctx context.Context, id int) ([]models.Team, error) {
+	if _, err := r.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return r.queryTeams(ctx, `
+		WITH RECURSIVE descendants (team_id, depth) AS (
+			SELECT team_id, 1 FROM teams WHERE parent_team_id = ? AND deleted_at IS NULL
+			UNION ALL
+			SELECT c.team_id, d.depth + 1
+			FROM teams c
+			JOIN descendants d ON c.parent_team_id = d.team_id
+			WHERE d.depth < ? AND c.deleted_at IS NULL
+		)
+		`+selectTeam+`
+		JOIN descendants d ON d.team_id = t.team_id
+		ORDER BY d.depth, t.team_id`, id, maxTeamDepth)
+}
@@ -0,0 +1,95 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"golang-backend/repository"
+)
+
+// TwoFactorRepository คือ repository.TwoFactorRepository บน MySQL
+type TwoFactorRepository struct {
+	db *sql.DB
+}
+
+func NewTwoFactorRepository(db *sql.DB) *TwoFactorRepository {
+	return &TwoFactorRepository{db: db}
+}
+
+func (r *TwoFactorRepository) Get(ctx context.Context, userID int) (repository.TwoFactor, error) {
+	var tf repository.TwoFactor
+	var secret sql.NullString
+	err := conn(ctx, r.db).QueryRowContext(ctx, "SELECT totp_secret, totp_enabled FROM users WHERE id = ? AND deleted_at IS NULL", userID).Scan(&secret, &tf.Enabled)
+	if err == sql.ErrNoRows {
+		return tf, repository.ErrNotFound
+	}
+	tf.Secret = secret.String
+	return tf, err
+}
+
+func (r *TwoFactorRepository) SetSecret(ctx context.Context, userID int, secret string) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE users SET totp_secret = ?, totp_enabled = FALSE, totp_last_step = NULL WHERE id = ? AND deleted_at IS NULL", secret, userID)
+	if err != nil {
+		return err
+	}
+	return affectedOrNotFound(result)
+}
+
+func (r *TwoFactorRepository) Enable(ctx context.Context, userID int, recoveryHashes []string) error {
+	return withinTx(ctx, r.db, func(ctx context.Context) error {
+		result, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE users SET totp_enabled = TRUE WHERE id = ? AND totp_secret IS NOT NULL AND deleted_at IS NULL", userID)
+		if err != nil {
+			return err
+		}
+		if err := affectedOrNotFound(result); err != nil {
+			return err
+		}
+		if _, err := conn(ctx, r.db).ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+			return err
+		}
+		for _, hash := range recoveryHashes {
+			if _, err := conn(ctx, r.db).ExecContext(ctx, "INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hash); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *TwoFactorRepository) Disable(ctx context.Context, userID int) error {
+	return withinTx(ctx, r.db, func(ctx context.Context) error {
+		result, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE users SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = NULL WHERE id = ? AND deleted_at IS NULL", userID)
+		if err != nil {
+			return err
+		}
+		if err := affectedOrNotFound(result); err != nil {
+			return err
+		}
+		_, err = conn(ctx, r.db).ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = ?", userID)
+		return err
+	})
+}
+
+func (r *TwoFactorRepository) UseStep(ctx context.Context, userID int, step int64) (bool, error) {
+	// เงื่อนไขใน WHERE ทำให้ request ที่ใช้รหัสเดียวกันพร้อมกันสำเร็จได้เพียงอันเดียว
+	result, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE users SET totp_last_step = ? WHERE id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)", step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (r *TwoFactorRepository) UseRecoveryCode(ctx context.Context, userID int, hash string) (bool, error) {
+	result, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE recovery_codes SET used_at = NOW() WHERE user_id = ? AND code_hash = ? AND used_at IS NULL LIMIT 1", userID, hash)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (r *TwoFactorRepository) RecoveryCodesLeft(ctx context.Context, userID int) (int, error) {
+	var n int
+	err := conn(ctx, r.db).QueryRowContext(ctx, "SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&n)
+	return n, err
+}
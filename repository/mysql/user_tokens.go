@@ -0,0 +1,48 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"golang-backend/repository"
+	"time"
+)
+
+// UserTokenRepository คือ repository.UserTokenRepository บน MySQL
+type UserTokenRepository struct {
+	db *sql.DB
+}
+
+func NewUserTokenRepository(db *sql.DB) *UserTokenRepository {
+	return &UserTokenRepository{db: db}
+}
+
+func (r *UserTokenRepository) Create(ctx context.Context, userID int, purpose, tokenHash string, ttl time.Duration) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `
+		INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at, created_at)
+		VALUES (?, ?, ?, DATE_ADD(NOW(), INTERVAL ? SECOND), NOW())
+	`, userID, purpose, tokenHash, int64(ttl/time.Second))
+	return err
+}
+
+func (r *UserTokenRepository) Consume(ctx context.Context, purpose, tokenHash string) (int, error) {
+	var userID int
+	err := withinTx(ctx, r.db, func(ctx context.Context) error {
+		err := conn(ctx, r.db).QueryRowContext(ctx, `
+			SELECT t.user_id
+			FROM user_tokens t
+			JOIN users u ON u.id = t.user_id
+			WHERE t.token_hash = ? AND t.purpose = ? AND t.used_at IS NULL AND t.expires_at > NOW() AND u.deleted_at IS NULL
+			FOR UPDATE
+		`, tokenHash, purpose).Scan(&userID)
+		if err == sql.ErrNoRows {
+			return repository.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		// token อื่นของจุดประสงค์เดียวกันที่ส่งไปก่อนหน้าก็ใช้ไม่ได้อีก
+		_, err = conn(ctx, r.db).ExecContext(ctx, "UPDATE user_tokens SET used_at = NOW() WHERE user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose)
+		return err
+	})
+	return userID, err
+}
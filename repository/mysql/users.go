@@ -0,0 +1,308 @@
+// Package mysql คือ implementation ของ repository บน MySQL
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"golang-backend/models"
+	"golang-backend/repository"
+	"strings"
+	"time"
+)
+
+// UserRepository คือ repository.UserRepository บน MySQL
+type UserRepository struct {
+	db *sql.DB
+}
+
+func NewUserRepository(db *sql.DB) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+var userSortColumns = map[string]string{
+	repository.SortUserID:        "u.id",
+	repository.SortUserUsername:  "u.username",
+	repository.SortUserCreatedAt: "u.created_at",
+	repository.SortUserLastName:  "u.lastname",
+}
+
+const selectUser = `
+	SELECT u.id, u.username, u.firstname, u.lastname, u.email, u.phone, u.role, u.created_at, t.team_id, t.team_name, u.deleted_at, u.email_verified_at IS NOT NULL, u.totp_enabled
+	FROM users u
+	LEFT JOIN teams t ON u.team_id = t.team_id AND t.deleted_at IS NULL`
+
+func scanUser(row interface{ Scan(...any) error }) (models.User, error) {
+	var user models.User
+	err := row.Scan(&user.ID, &user.Username, &user.FirstName, &user.LastName, &user.Email, &user.Phone, &user.Role, &user.CreatedAt, &user.TeamId, &user.TeamName, &user.DeletedAt, &user.EmailVerified, &user.TwoFactorEnabled)
+	return user, err
+}
+
+func (r *UserRepository) queryUsers(ctx context.Context, query string, args ...any) ([]models.User, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	return users, loadMemberships(ctx, conn(ctx, r.db), users)
+}
+
+// withMemberships เติม Memberships ให้ผู้ใช้คนเดียว
+func (r *UserRepository) withMemberships(ctx context.Context, user models.User, err error) (models.User, error) {
+	if err == sql.ErrNoRows {
+		return user, repository.ErrNotFound
+	}
+	if err != nil {
+		return user, err
+	}
+	users := []models.User{user}
+	err = loadMemberships(ctx, conn(ctx, r.db), users)
+	return users[0], err
+}
+
+func (r *UserRepository) List(ctx context.Context, filter repository.UserFilter) ([]models.User, int, error) {
+	var clauses []string
+	var args []any
+
+	if !filter.IncludeDeleted {
+		clauses = append(clauses, "u.deleted_at IS NULL")
+	}
+	if filter.Role != "" {
+		clauses = append(clauses, "u.role = ?")
+		args = append(args, filter.Role)
+	}
+	if filter.TeamID != nil {
+		clauses = append(clauses, "u.id IN (SELECT user_id FROM team_members WHERE team_id = ?)")
+		args = append(args, *filter.TeamID)
+	}
+	if filter.EmailDomain != "" {
+		clauses = append(clauses, "u.email LIKE ?")
+		args = append(args, "%@"+escapeLike(filter.EmailDomain))
+	}
+	if filter.CreatedFrom != nil {
+		clauses = append(clauses, "u.created_at >= ?")
+		args = append(args, filter.CreatedFrom.Format(dateTimeLayout))
+	}
+	if filter.CreatedBefore != nil {
+		clauses = append(clauses, "u.created_at < ?")
+		args = append(args, filter.CreatedBefore.Format(dateTimeLayout))
+	}
+
+	where := ""
+	if len(clauses) > 0 {
+		where = " WHERE " + strings.Join(clauses, " AND ")
+	}
+
+	// นับจำนวนทั้งหมดด้วยเงื่อนไขเดียวกันเพื่อใช้สร้าง meta และลิงก์หน้าถัดไป
+	var total int
+	if err := conn(ctx, r.db).QueryRowContext(ctx, "SELECT COUNT(*) FROM users u"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	column, ok := userSortColumns[filter.Sort]
+	if !ok {
+		column = "u.id"
+	}
+	direction := " ASC"
+	if filter.Desc {
+		direction = " DESC"
+	}
+	query := selectUser + where + " ORDER BY " + column + direction + ", u.id" + direction
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	users, err := r.queryUsers(ctx, query, args...)
+	return users, total, err
+}
+
+func (r *UserRepository) ListByTeam(ctx context.Context, teamID int, recursive bool) ([]models.User, error) {
+	if !recursive {
+		return r.queryUsers(ctx, selectUser+" WHERE u.deleted_at IS NULL AND u.id IN (SELECT user_id FROM team_members WHERE team_id = ?) ORDER BY u.id", teamID)
+	}
+	return r.queryUsers(ctx, `
+		WITH RECURSIVE subtree (team_id, depth) AS (
+			SELECT ?, 0
+			UNION ALL
+			SELECT c.team_id, s.depth + 1
+			FROM teams c
+			JOIN subtree s ON c.parent_team_id = s.team_id
+			WHERE s.depth < ? AND c.deleted_at IS NULL
+		)`+selectUser+`
+		WHERE u.deleted_at IS NULL AND u.id IN (SELECT user_id FROM team_members WHERE team_id IN (SELECT team_id FROM subtree))
+		ORDER BY u.id`, teamID, maxTeamDepth)
+}
+
+func (r *UserRepository) GetByID(ctx context.Context, id int) (models.User, error) {
+	user, err := scanUser(conn(ctx, r.db).QueryRowContext(ctx, selectUser+" WHERE u.id = ? AND u.deleted_at IS NULL", id))
+	return r.withMemberships(ctx, user, err)
+}
+
+func (r *UserRepository) GetForUpdate(ctx context.Context, id int) (models.User, error) {
+	user, err := scanUser(conn(ctx, r.db).QueryRowContext(ctx, selectUser+" WHERE u.id = ? AND u.deleted_at IS NULL FOR UPDATE OF u", id))
+	return r.withMemberships(ctx, user, err)
+}
+
+func (r *UserRepository) GetByIdentifier(ctx context.Context, identifier string) (models.User, error) {
+	var user models.User
+	err := conn(ctx, r.db).QueryRowContext(ctx, `
+		SELECT u.id, u.username, u.firstname, u.lastname, u.email, u.phone, u.role, u.password, u.created_at, t.team_id, u.email_verified_at IS NOT NULL, u.totp_enabled
+		FROM users u
+		LEFT JOIN teams t ON u.team_id = t.team_id AND t.deleted_at IS NULL
+		WHERE (u.username = ? OR u.email = ?) AND u.deleted_at IS NULL
+	`, identifier, identifier).Scan(&user.ID, &user.Username, &user.FirstName, &user.LastName, &user.Email, &user.Phone, &user.Role, &user.Password, &user.CreatedAt, &user.TeamId, &user.EmailVerified, &user.TwoFactorEnabled)
+	return r.withMemberships(ctx, user, err)
+}
+
+func (r *UserRepository) Taken(ctx context.Context, field, value string) (bool, error) {
+	columns := map[string]string{repository.FieldUsername: "active_username", repository.FieldEmail: "active_email"}
+	column, ok := columns[field]
+	if !ok {
+		return false, fmt.Errorf("mysql: %q is not a unique user field", field)
+	}
+	var taken bool
+	err := conn(ctx, r.db).QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE "+column+" = ?)", value).Scan(&taken)
+	return taken, err
+}
+
+func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, `
+		INSERT INTO users (username, password, firstname, lastname, email, phone, role, team_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW())
+	`, user.Username, user.Password, user.FirstName, user.LastName, user.Email, user.Phone, user.Role, user.TeamId)
+	if err != nil {
+		return conflictError(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	user.ID = int(id)
+	if user.TeamId != nil {
+		if _, err := conn(ctx, r.db).ExecContext(ctx, "INSERT INTO team_members (team_id, user_id, role, joined_at) VALUES (?, ?, ?, NOW())", *user.TeamId, id, models.MemberRoleMember); err != nil {
+			return err
+		}
+	}
+	return conn(ctx, r.db).QueryRowContext(ctx, "SELECT created_at FROM users WHERE id = ?", id).Scan(&user.CreatedAt)
+}
+
+func (r *UserRepository) Update(ctx context.Context, id int, update repository.UserUpdate) error {
+	var setClauses []string
+	var params []any
+	set := func(column string, value any) {
+		setClauses = append(setClauses, column+" = ?")
+		params = append(params, value)
+	}
+
+	if update.Username != nil {
+		set("username", *update.Username)
+	}
+	if update.FirstName != nil {
+		set("firstname", *update.FirstName)
+	}
+	if update.LastName != nil {
+		set("lastname", *update.LastName)
+	}
+	if update.Email != nil {
+		// ต้องมาก่อน email = ? เพราะ MySQL ประเมิน SET จากซ้ายไปขวา
+		setClauses = append(setClauses, "email_verified_at = IF(email = ?, email_verified_at, NULL)")
+		params = append(params, *update.Email)
+		set("email", *update.Email)
+	}
+	if update.Phone != nil {
+		set("phone", *update.Phone)
+	}
+	if update.Role != nil {
+		set("role", *update.Role)
+	}
+	if update.PasswordHash != nil {
+		set("password", *update.PasswordHash)
+	}
+	if update.SetTeam {
+		set("team_id", update.TeamID)
+	}
+	if len(setClauses) == 0 {
+		return nil
+	}
+
+	params = append(params, id)
+	if update.Email != nil {
+		// token ยืนยันอีเมลที่ส่งไปยังอีเมลเดิมต้องใช้ไม่ได้อีก
+		if _, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE user_tokens SET used_at = NOW() WHERE user_id = ? AND purpose = ? AND used_at IS NULL AND ? <> (SELECT email FROM users WHERE id = ?)", id, repository.TokenEmailVerification, *update.Email, id); err != nil {
+			return err
+		}
+	}
+	result, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE users SET "+strings.Join(setClauses, ", ")+" WHERE id = ? AND deleted_at IS NULL", params...)
+	if err != nil {
+		return conflictError(err)
+	}
+	if err := r.requireRow(ctx, result, id); err != nil {
+		return err
+	}
+	// ทีมหลักต้องเป็นหนึ่งในทีมที่ผู้ใช้เป็นสมาชิกเสมอ
+	if update.SetTeam && update.TeamID != nil {
+		_, err = conn(ctx, r.db).ExecContext(ctx, "INSERT IGNORE INTO team_members (team_id, user_id, role, joined_at) VALUES (?, ?, ?, NOW())", *update.TeamID, id, models.MemberRoleMember)
+	}
+	return err
+}
+
+// requireRow คืน ErrNotFound ถ้า UPDATE ไม่กระทบแถวใดและไม่มีผู้ใช้ id นี้ที่ยังไม่ถูกลบ
+// (MySQL นับเฉพาะแถวที่ค่าเปลี่ยนจริง จึงต้องตรวจสอบซ้ำ)
+func (r *UserRepository) requireRow(ctx context.Context, result sql.Result, id int) error {
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	var one int
+	err := conn(ctx, r.db).QueryRowContext(ctx, "SELECT 1 FROM users WHERE id = ? AND deleted_at IS NULL", id).Scan(&one)
+	if err == sql.ErrNoRows {
+		return repository.ErrNotFound
+	}
+	return err
+}
+
+func (r *UserRepository) VerifyEmail(ctx context.Context, id int) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = ? AND deleted_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	return r.requireRow(ctx, result, id)
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id int) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE users SET deleted_at = NOW() WHERE id = ? AND deleted_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	return affectedOrNotFound(result)
+}
+
+func (r *UserRepository) Restore(ctx context.Context, id int) error {
+	result, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE users SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return conflictError(err)
+	}
+	return affectedOrNotFound(result)
+}
+
+func (r *UserRepository) Purge(ctx context.Context, retention time.Duration) (int64, error) {
+	// refresh_tokens, team_members และ user_tokens ถูกลบตาม ON DELETE CASCADE
+	result, err := conn(ctx, r.db).ExecContext(ctx, "DELETE FROM users WHERE deleted_at < DATE_SUB(NOW(), INTERVAL ? SECOND)", int64(retention/time.Second))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,292 @@
+// Package repository กำหนด interface สำหรับเข้าถึงข้อมูล เพื่อให้ handler ไม่ผูกกับ MySQL
+// โดยตรง มี implementation สองแบบคือ repository/mysql และ repository/memory (สำหรับทดสอบ)
+package repository
+
+import (
+	"context"
+	"errors"
+	"golang-backend/models"
+	"time"
+)
+
+var (
+	// ErrNotFound คือไม่พบข้อมูลที่ต้องการ
+	ErrNotFound = errors.New("repository: not found")
+	// ErrTokenReused คือ refresh token ถูก rotate ไปแล้วก่อนที่จะ rotate ได้
+	ErrTokenReused = errors.New("repository: refresh token already rotated")
+)
+
+// ฟิลด์ที่ต้องไม่ซ้ำกับแถวอื่นที่ยังไม่ถูกลบ (ไม่สนตัวพิมพ์)
+const (
+	FieldUsername = "username"
+	FieldEmail    = "email"
+	FieldTeamName = "team_name"
+)
+
+// ConflictError คือการบันทึกที่ทำให้ Field ซ้ำกับแถวอื่น
+type ConflictError struct {
+	Field string
+}
+
+func (e *ConflictError) Error() string {
+	return "repository: duplicate " + e.Field
+}
+
+// Transactor รันหลายคำสั่งใน transaction เดียว repository ที่ได้รับ ctx ที่ส่งให้ fn
+// จะทำงานใน transaction นั้น ถ้า fn คืน error ทุกการเปลี่ยนแปลงจะถูกยกเลิก
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// ฟิลด์ที่ใช้เรียงลำดับผู้ใช้ได้
+const (
+	SortUserID        = "id"
+	SortUserUsername  = "username"
+	SortUserCreatedAt = "created_at"
+	SortUserLastName  = "lastname"
+)
+
+// UserFilter คือเงื่อนไขการค้นหา การเรียงลำดับ และการแบ่งหน้าของผู้ใช้
+type UserFilter struct {
+	Role          string
+	TeamID        *int // ผู้ใช้ที่เป็นสมาชิกของทีมนี้ (team_members)
+	EmailDomain   string
+	CreatedFrom   *time.Time // รวมเวลานี้
+	CreatedBefore *time.Time // ไม่รวมเวลานี้
+	Sort          string     // หนึ่งใน SortUser* ค่าว่างคือ id
+	Desc          bool
+	Limit         int // 0 คือไม่จำกัด
+	Offset        int
+	// IncludeDeleted รวมผู้ใช้ที่ถูก soft delete ด้วย
+	IncludeDeleted bool
+}
+
+// UserUpdate คือการแก้ไขผู้ใช้บางฟิลด์ ฟิลด์ที่เป็น nil จะไม่ถูกเปลี่ยน
+type UserUpdate struct {
+	Username     *string
+	FirstName    *string
+	LastName     *string
+	Email        *string
+	Phone        *string
+	Role         *string
+	PasswordHash *string
+	SetTeam      bool // true เมื่อต้องการเปลี่ยนทีมหลัก โดย TeamID nil คือไม่มีทีมหลัก (membership เดิมยังอยู่)
+	TeamID       *int
+}
+
+// Empty บอกว่าไม่มีฟิลด์ใดถูกแก้ไข
+func (u UserUpdate) Empty() bool {
+	return u.Username == nil && u.FirstName == nil && u.LastName == nil && u.Email == nil &&
+		u.Phone == nil && u.Role == nil && u.PasswordHash == nil && !u.SetTeam
+}
+
+// UserRepository จัดการตาราง users
+// ผู้ใช้ที่ถูก soft delete (deleted_at ไม่เป็น NULL) จะไม่ถูกคืนจากทุก method ยกเว้น List ที่ระบุ IncludeDeleted
+type UserRepository interface {
+	// List คืนผู้ใช้ตาม filter พร้อมจำนวนทั้งหมดที่ตรงเงื่อนไข (ไม่สนใจ Limit/Offset)
+	List(ctx context.Context, filter UserFilter) ([]models.User, int, error)
+	// ListByTeam คืนผู้ใช้ทุกคนที่เป็นสมาชิกของทีม ไม่ว่าจะเป็นทีมหลักหรือไม่
+	// ถ้า recursive เป็น true จะรวมสมาชิกของทีมย่อยทุกระดับที่ยังไม่ถูกลบด้วย (ผู้ใช้แต่ละคนปรากฏครั้งเดียว)
+	ListByTeam(ctx context.Context, teamID int, recursive bool) ([]models.User, error)
+	GetByID(ctx context.Context, id int) (models.User, error)
+	// GetForUpdate เหมือน GetByID แต่ lock แถวของผู้ใช้ไว้จนจบ transaction (ต้องเรียกภายใน transaction)
+	GetForUpdate(ctx context.Context, id int) (models.User, error)
+	// GetByIdentifier ค้นหาด้วย username หรือ email และคืน password hash ใน User.Password
+	GetByIdentifier(ctx context.Context, identifier string) (models.User, error)
+	// Taken บอกว่ามีผู้ใช้ที่ยังไม่ถูกลบใช้ value เป็น field (FieldUsername หรือ FieldEmail) อยู่แล้วหรือไม่
+	Taken(ctx context.Context, field, value string) (bool, error)
+	// Create บันทึกผู้ใช้ใหม่ โดย user.Password ต้องเป็น hash แล้ว และกำหนด ID กับ CreatedAt ให้
+	// ถ้ามี TeamId ผู้ใช้จะถูกเพิ่มเป็น member ของทีมนั้นด้วย
+	// คืน *ConflictError ถ้า username หรือ email ซ้ำกับผู้ใช้อื่น (เช่นเดียวกับ Update และ Restore)
+	Create(ctx context.Context, user *models.User) error
+	// Update แก้ไขผู้ใช้ การตั้งทีมหลักจะเพิ่มผู้ใช้เป็น member ของทีมนั้นถ้ายังไม่เป็น
+	// การเปลี่ยนอีเมลจะยกเลิกสถานะยืนยันอีเมลและ token ยืนยันอีเมลที่ยังไม่ถูกใช้
+	Update(ctx context.Context, id int, update UserUpdate) error
+	// VerifyEmail บันทึกว่าอีเมลปัจจุบันของผู้ใช้ได้รับการยืนยันแล้ว
+	VerifyEmail(ctx context.Context, id int) error
+	// Delete soft delete ผู้ใช้ โดยข้อมูลและ membership ยังอยู่จนกว่าจะถูก Purge
+	Delete(ctx context.Context, id int) error
+	// Restore ยกเลิกการลบ คืน ErrNotFound ถ้าไม่มีผู้ใช้ที่ถูกลบอยู่ id นี้
+	Restore(ctx context.Context, id int) error
+	// Purge ลบถาวรผู้ใช้ที่ถูก soft delete นานกว่า retention และคืนจำนวนที่ลบ
+	Purge(ctx context.Context, retention time.Duration) (int64, error)
+}
+
+// TeamUpdate คือการแก้ไขทีมบางฟิลด์
+type TeamUpdate struct {
+	TeamName     *string
+	SetParent    bool // true เมื่อต้องการเปลี่ยนทีมแม่ โดย ParentTeamID nil คือย้ายไประดับบนสุด
+	ParentTeamID *int
+}
+
+// Empty บอกว่าไม่มีฟิลด์ใดถูกแก้ไข
+func (u TeamUpdate) Empty() bool {
+	return u.TeamName == nil && !u.SetParent
+}
+
+// TeamFilter คือเงื่อนไขการดึงรายการทีม
+type TeamFilter struct {
+	// IncludeDeleted รวมทีมที่ถูก soft delete ด้วย
+	IncludeDeleted bool
+}
+
+// TeamRepository จัดการตาราง teams
+// ทีมที่ถูก soft delete จะไม่ถูกคืนจากทุก method ยกเว้น List ที่ระบุ IncludeDeleted
+type TeamRepository interface {
+	List(ctx context.Context, filter TeamFilter) ([]models.Team, error)
+	GetByID(ctx context.Context, id int) (models.Team, error)
+	// GetForUpdate เหมือน GetByID แต่ lock แถวของทีมไว้จนจบ transaction (ต้องเรียกภายใน transaction)
+	GetForUpdate(ctx context.Context, id int) (models.Team, error)
+	// Create บันทึกทีมใหม่และกำหนด ID กับ CreatedAt ให้
+	// คืน *ConflictError ถ้า team_name ซ้ำกับทีมอื่น (เช่นเดียวกับ Update และ Restore)
+	Create(ctx context.Context, team *models.Team) error
+	Update(ctx context.Context, id int, update TeamUpdate) error
+	// Delete soft delete ทีม สมาชิกและทีมย่อยยังอ้างถึงทีมนี้อยู่จนกว่าจะถูก Purge
+	Delete(ctx context.Context, id int) error
+	// Restore ยกเลิกการลบ คืน ErrNotFound ถ้าไม่มีทีมที่ถูกลบอยู่ id นี้
+	Restore(ctx context.Context, id int) error
+	// Purge ลบถาวรทีมที่ถูก soft delete นานกว่า retention ผู้ใช้ในทีมจะกลายเป็นไม่มีทีม
+	// และทีมย่อยจะกลายเป็นทีมระดับบนสุด
+	Purge(ctx context.Context, retention time.Duration) (int64, error)
+	// Ancestors คืนทีมแม่ทุกระดับ (ที่ยังไม่ถูกลบ) เรียงจากทีมระดับบนสุดลงมาถึงทีมแม่โดยตรง
+	Ancestors(ctx context.Context, id int) ([]models.Team, error)
+	// Descendants คืนทีมย่อยทุกระดับ (ที่ยังไม่ถูกลบ ไม่รวมทีมย่อยของทีมที่ถูกลบ) เรียงตามความลึกแล้วตาม team_id
+	Descendants(ctx context.Context, id int) ([]models.Team, error)
+	// LockAncestors คืน id ของทีม id และทีมแม่ทุกระดับ (รวมทีมที่ถูกลบ) โดย lock แถวเหล่านั้นไว้จนจบ transaction
+	// ต้องเรียกภายใน transaction คืน ErrNotFound ถ้าไม่มีทีม id นี้
+	LockAncestors(ctx context.Context, id int) ([]int, error)
+}
+
+// TeamMemberRepository จัดการตาราง team_members
+// ผู้ใช้ที่ยังไม่มีทีมหลัก (users.team_id) จะได้ทีมแรกที่เข้าร่วมเป็นทีมหลัก
+type TeamMemberRepository interface {
+	// ListByTeam คืนสมาชิกของทีมเรียงตามเวลาที่เข้าร่วม
+	ListByTeam(ctx context.Context, teamID int) ([]models.TeamMember, error)
+	Get(ctx context.Context, teamID, userID int) (models.TeamMember, error)
+	// Add เพิ่มผู้ใช้เข้าทีม ถ้าเป็นสมาชิกอยู่แล้วจะเปลี่ยน role แทนและคืน created เป็น false
+	// คืน ErrNotFound ถ้าไม่มีทีมหรือผู้ใช้นี้
+	Add(ctx context.Context, teamID, userID int, role string) (created bool, err error)
+	// Remove นำผู้ใช้ออกจากทีม ถ้าเป็นทีมหลักของผู้ใช้ users.team_id จะกลายเป็น NULL
+	Remove(ctx context.Context, teamID, userID int) error
+}
+
+// RefreshToken คือ refresh token ที่เก็บไว้ (เก็บเฉพาะ hash)
+type RefreshToken struct {
+	ID       int64
+	UserID   int
+	FamilyID string
+	Revoked  bool
+	// Rotated บอกว่า token ถูก revoke เพราะถูกแทนด้วย token ใหม่ (ไม่ใช่ logout หรือการ revoke อื่น)
+	Rotated bool
+	Expired bool
+}
+
+// RefreshTokenRepository จัดการตาราง refresh_tokens
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, userID int, familyID, tokenHash string, ttl time.Duration) error
+	GetByHash(ctx context.Context, tokenHash string) (RefreshToken, error)
+	// Rotate revoke token เดิมและสร้าง token ใหม่ใน family เดียวกันแบบ atomic
+	// คืน ErrTokenReused ถ้า token เดิมถูก rotate ไปแล้ว และ ErrNotFound ถ้าถูก revoke ด้วยเหตุอื่น
+	Rotate(ctx context.Context, old RefreshToken, newHash string, ttl time.Duration) error
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeUser(ctx context.Context, userID int) error
+	// RevokeOthers revoke ทุก session ของ userID ยกเว้น family keepFamilyID (ค่าว่างคือ revoke ทั้งหมด)
+	RevokeOthers(ctx context.Context, userID int, keepFamilyID string) error
+	// FamilyActive บอกว่า family ยังมี token ที่ไม่ถูก revoke และยังไม่หมดอายุ
+	FamilyActive(ctx context.Context, familyID string) (bool, error)
+}
+
+// AuditFilter คือเงื่อนไขการค้นหาและการแบ่งหน้าของ audit log
+type AuditFilter struct {
+	ActorID       *int
+	Action        string
+	EntityType    string
+	EntityID      *int
+	CreatedFrom   *time.Time // รวมเวลานี้
+	CreatedBefore *time.Time // ไม่รวมเวลานี้
+	Limit         int        // 0 คือไม่จำกัด
+	Offset        int
+}
+
+// AuditRepository จัดการตาราง audit_log ซึ่งเพิ่มได้อย่างเดียว
+type AuditRepository interface {
+	// Record บันทึก entry และกำหนด ID กับ CreatedAt ให้
+	Record(ctx context.Context, entry *models.AuditEntry) error
+	// List คืน entry ใหม่สุดก่อน พร้อมจำนวนทั้งหมดที่ตรงเงื่อนไข
+	List(ctx context.Context, filter AuditFilter) ([]models.AuditEntry, int, error)
+}
+
+// LoginAttempt คือสถานะการ login ที่ล้มเหลวของ key หนึ่ง (บัญชีหรือ IP)
+// ระยะเวลาคำนวณจากนาฬิกาของฐานข้อมูลเหมือน refresh token
+type LoginAttempt struct {
+	Failures         int
+	SinceLastFailure time.Duration
+	LockedFor        time.Duration // เวลาที่เหลือของการล็อก (0 คือไม่ถูกล็อก)
+}
+
+// LoginAttemptRepository จัดการตัวนับการ login ที่ล้มเหลวในตาราง login_attempts
+type LoginAttemptRepository interface {
+	// Get คืน ErrNotFound ถ้า key ไม่มีการล้มเหลวที่บันทึกไว้
+	Get(ctx context.Context, key string) (LoginAttempt, error)
+	// RecordFailure เพิ่มจำนวนครั้งที่ล้มเหลวและคืนค่าใหม่ ถ้าครั้งล่าสุดเก่ากว่า window จะเริ่มนับจาก 1
+	RecordFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	// Lock ห้าม key นี้ login เป็นเวลา d
+	Lock(ctx context.Context, key string, d time.Duration) error
+	// Reset ล้างตัวนับและการล็อกของ key
+	Reset(ctx context.Context, key string) error
+}
+
+// TwoFactor คือการตั้งค่า TOTP ของผู้ใช้
+type TwoFactor struct {
+	Secret  string // ว่างถ้ายังไม่เคย enroll
+	Enabled bool   // false ระหว่างรอยืนยันรหัสแรกหลัง enroll
+}
+
+// TwoFactorRepository จัดการ TOTP secret ในตาราง users และ recovery code ในตาราง recovery_codes
+type TwoFactorRepository interface {
+	// Get คืน ErrNotFound ถ้าไม่มีผู้ใช้
+	Get(ctx context.Context, userID int) (TwoFactor, error)
+	// SetSecret เก็บ secret ใหม่ที่ยังไม่เปิดใช้
+	SetSecret(ctx context.Context, userID int, secret string) error
+	// Enable เปิดใช้ secret ที่เก็บไว้ และแทนที่ recovery code เดิมทั้งหมดด้วย recoveryHashes
+	Enable(ctx context.Context, userID int, recoveryHashes []string) error
+	// Disable ลบ secret และ recovery code ทั้งหมด
+	Disable(ctx context.Context, userID int) error
+	// UseStep บันทึกว่า time step ถูกใช้แล้ว คืน false ถ้า step นี้หรือที่ใหม่กว่าเคยถูกใช้ (กันการใช้รหัสซ้ำ)
+	UseStep(ctx context.Context, userID int, step int64) (bool, error)
+	// UseRecoveryCode ทำเครื่องหมายว่า recovery code ถูกใช้แล้ว คืน false ถ้าไม่มีหรือถูกใช้ไปแล้ว
+	UseRecoveryCode(ctx context.Context, userID int, hash string) (bool, error)
+	// RecoveryCodesLeft คืนจำนวน recovery code ที่ยังไม่ถูกใช้
+	RecoveryCodesLeft(ctx context.Context, userID int) (int, error)
+}
+
+// จุดประสงค์ของ token ที่ส่งทางอีเมล (user_tokens.purpose)
+const (
+	TokenPasswordReset     = "password_reset"
+	TokenEmailVerification = "email_verification"
+)
+
+// UserTokenRepository จัดการ token แบบใช้ครั้งเดียวที่ส่งให้ผู้ใช้ทางอีเมล โดยเก็บเฉพาะ SHA-256 ของ token
+type UserTokenRepository interface {
+	// Create บันทึก token ใหม่ที่หมดอายุหลัง ttl
+	Create(ctx context.Context, userID int, purpose, tokenHash string, ttl time.Duration) error
+	// Consume ใช้ token และคืนเจ้าของ token ทุก token ที่ยังไม่ถูกใช้ของผู้ใช้คนนั้นสำหรับ purpose เดียวกันจะใช้ไม่ได้อีก
+	// คืน ErrNotFound ถ้า token ไม่มีอยู่ หมดอายุ ถูกใช้ไปแล้ว หรือเจ้าของถูกลบ
+	Consume(ctx context.Context, purpose, tokenHash string) (int, error)
+}
+
+// APIKeyRepository จัดการตาราง api_keys โดยเก็บเฉพาะ SHA-256 ของ key
+type APIKeyRepository interface {
+	// Create บันทึก key ใหม่ที่หมดอายุหลัง ttl และกำหนด ID, ExpiresAt กับ CreatedAt ให้
+	Create(ctx context.Context, key *models.APIKey, tokenHash string, ttl time.Duration) error
+	// ListByUser คืน key ที่ยังไม่ถูก revoke ของผู้ใช้ (รวม key ที่หมดอายุแล้ว) เรียงจากใหม่ไปเก่า
+	ListByUser(ctx context.Context, userID int) ([]models.APIKey, error)
+	// GetByHash คืน key ที่ใช้ได้อยู่ คืน ErrNotFound ถ้าไม่มี หมดอายุ หรือถูก revoke แล้ว
+	GetByHash(ctx context.Context, tokenHash string) (models.APIKey, error)
+	// Revoke ยกเลิก key ของผู้ใช้ คืน ErrNotFound ถ้าไม่มี key id นี้ของผู้ใช้หรือถูก revoke ไปแล้ว
+	Revoke(ctx context.Context, userID, id int) error
+	// RevokeUser ยกเลิกทุก key ของผู้ใช้
+	RevokeUser(ctx context.Context, userID int) error
+	// Touch บันทึกเวลาที่ใช้ key ล่าสุด (ไม่บ่อยกว่านาทีละครั้ง)
+	Touch(ctx context.Context, id int) error
+}
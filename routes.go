@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"golang-backend/api/account"
+	"golang-backend/api/apikeys"
+	"golang-backend/api/audit"
+	"golang-backend/api/login"
+	"golang-backend/api/oidc"
+	"golang-backend/api/password"
+	"golang-backend/api/response"
+	"golang-backend/api/search"
+	"golang-backend/api/teams"
+	user "golang-backend/api/users"
+	"golang-backend/config"
+	"golang-backend/mail"
+	"golang-backend/middleware"
+	"golang-backend/repository"
+	"golang-backend/signing"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/cors"
+)
+
+// repositories รวมแหล่งข้อมูลที่ handler ใช้ (MySQL ตอนรันจริง และ memory ตอนทดสอบ)
+type repositories struct {
+	users      repository.UserRepository
+	teams      repository.TeamRepository
+	members    repository.TeamMemberRepository
+	tokens     repository.RefreshTokenRepository
+	audit      repository.AuditRepository
+	tx         repository.Transactor
+	attempts   repository.LoginAttemptRepository
+	twoFactor  repository.TwoFactorRepository
+	userTokens repository.UserTokenRepository
+	apiKeys    repository.APIKeyRepository
+}
+
+// newRouter สร้าง handler ของทั้ง API พร้อม request ID และ CORS โดยส่งอีเมลผ่าน mailer และเซ็น JWT ด้วย keys
+func newRouter(cfg config.Config, repos repositories, mailer mail.Mailer, keys *signing.KeySet) http.Handler {
+	passwords := password.NewService(cfg.Password)
+	auditLog := audit.NewLog(repos.tx, repos.audit)
+	loginHandler := login.NewHandler(cfg.JWT, keys, cfg.Login, passwords, repos.users, repos.tokens, repos.attempts, repos.twoFactor, auditLog)
+	throttle := login.NewThrottle(cfg.Login, repos.attempts)
+	accountHandler := account.NewHandler(cfg.Account, passwords, repos.users, repos.userTokens, repos.tokens, repos.apiKeys, throttle, mailer, auditLog)
+	userHandler := user.NewHandler(repos.users, passwords, repos.tokens, repos.apiKeys, repos.attempts, throttle, repos.twoFactor, repos.teams, auditLog, accountHandler)
+	teamHandler := teams.NewHandler(repos.teams, repos.members, auditLog)
+	auditHandler := audit.NewHandler(repos.audit)
+	searchHandler := search.NewHandler(repos.users, repos.teams)
+	apiKeyHandler := apikeys.NewHandler(repos.users, repos.apiKeys, auditLog)
+
+	// ตั้งค่า CORS
+	c := cors.New(cors.Options{
+		AllowedOrigins:   cfg.Server.AllowedOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", middleware.RequestIDHeader},
+		ExposedHeaders:   []string{middleware.RequestIDHeader, "Accept-Patch"},
+		AllowCredentials: true,
+	})
+
+	// สร้าง router
+	router := mux.NewRouter()
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response.WriteError(w, r, response.New(http.StatusNotFound, response.CodeNotFound, "Route not found"))
+	})
+	router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response.WriteError(w, r, response.New(http.StatusMethodNotAllowed, response.CodeMethodNotAllowed, "Method not allowed"))
+	})
+
+	// เส้นทางหลัก
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Welcome to the User Management API!")
+	}).Methods("GET")
+
+	// public key สำหรับให้บริการอื่นตรวจ access token
+	router.HandleFunc("/.well-known/jwks.json", keys.JWKS).Methods("GET")
+
+	// เส้นทางจัดการผู้ใช้ (ไม่มีการตรวจสอบ JWT)
+	router.HandleFunc("/login", loginHandler.Login).Methods("POST")
+	router.HandleFunc("/auth/2fa", loginHandler.VerifyTwoFactor).Methods("POST")
+	router.HandleFunc("/auth/refresh", loginHandler.Refresh).Methods("POST")
+	router.HandleFunc("/auth/logout", loginHandler.Logout).Methods("POST")
+	router.HandleFunc("/auth/logout-all", loginHandler.LogoutAll).Methods("POST")
+	router.HandleFunc("/auth/forgot-password", accountHandler.ForgotPassword).Methods("POST")
+	router.HandleFunc("/auth/reset-password", accountHandler.ResetPassword).Methods("POST")
+	router.HandleFunc("/auth/verify-email", accountHandler.VerifyEmail).Methods("POST")
+
+	// single sign-on เปิดเมื่อกำหนด oidc.issuer
+	if cfg.OIDC.Issuer != "" {
+		oidcHandler := oidc.NewHandler(cfg.OIDC, keys, loginHandler, repos.users, repos.teams, repos.tokens, auditLog)
+		router.HandleFunc("/auth/oidc/login", oidcHandler.Login).Methods("GET")
+		router.HandleFunc("/auth/oidc/callback", oidcHandler.Callback).Methods("GET")
+	}
+
+	// ใช้ middleware JWT สำหรับเส้นทางที่ต้องการ
+	api := router.PathPrefix("/api").Subrouter()                                      // ใช้ subrouter สำหรับ API
+	api.Use(middleware.JWTMiddleware(keys, repos.tokens, repos.apiKeys, repos.users)) // ใช้ middleware
+
+	// ทุก route ภายใต้ /api ต้องประกาศ permission ที่ต้องใช้
+	route := func(path string, h http.HandlerFunc, guard func(http.Handler) http.Handler, method string) {
+		api.Handle(path, guard(h)).Methods(method)
+	}
+	require := middleware.Require
+
+	// API key จัดการบัญชีและ credential ของเจ้าของไม่ได้
+	sessionOnly := middleware.SessionOnly
+
+	route("/me", userHandler.GetMe, middleware.Authenticated, "GET")
+	route("/me", userHandler.PatchMe, sessionOnly, "PATCH")
+	route("/me/verify-email", accountHandler.ResendVerification, sessionOnly, "POST")
+	route("/me/2fa", userHandler.GetTwoFactor, sessionOnly, "GET")
+	route("/me/2fa", userHandler.DisableTwoFactor, sessionOnly, "DELETE")
+	route("/me/2fa/enroll", userHandler.EnrollTwoFactor, sessionOnly, "POST")
+	route("/me/2fa/verify", userHandler.ActivateTwoFactor, sessionOnly, "POST")
+	route("/me/api-keys", apiKeyHandler.GetAPIKeys, sessionOnly, "GET")
+	route("/me/api-keys", apiKeyHandler.CreateAPIKey, sessionOnly, "POST")
+	route("/me/api-keys/{key_id}", apiKeyHandler.RevokeAPIKey, sessionOnly, "DELETE")
+	route("/users", userHandler.GetUsers, require(middleware.PermUsersRead), "GET")
+	route("/users/availability", userHandler.CheckAvailability, require(middleware.PermUsersRead), "GET")
+	route("/users/{id}", userHandler.GetUserByID, require(middleware.PermUsersRead), "GET")
+	route("/users/team/{team_id}", userHandler.GetUsersByTeam, require(middleware.PermUsersRead), "GET")
+	route("/users", userHandler.CreateUser, require(middleware.PermUsersCreate), "POST")
+	route("/users/{id}", userHandler.DeleteUserByID, require(middleware.PermUsersDelete), "DELETE")
+	route("/users/{id}/restore", userHandler.RestoreUser, require(middleware.PermUsersDelete), "POST")
+	route("/users/{id}/unlock", userHandler.UnlockUser, require(middleware.PermUsersUpdate), "POST")
+	route("/users/{id}", userHandler.PatchUser, middleware.RequireSelfOr("id", middleware.PermUsersUpdate), "PATCH")
+	route("/users/{id}/api-keys", apiKeyHandler.GetAPIKeys, require(middleware.PermAPIKeysManage), "GET")
+	route("/users/{id}/api-keys", apiKeyHandler.CreateAPIKey, require(middleware.PermAPIKeysManage), "POST")
+	route("/users/{id}/api-keys/{key_id}", apiKeyHandler.RevokeAPIKey, require(middleware.PermAPIKeysManage), "DELETE")
+	route("/teams", teamHandler.GetTeams, require(middleware.PermTeamsRead), "GET")
+	route("/teams/tree", teamHandler.GetTeamTree, require(middleware.PermTeamsRead), "GET")
+	route("/teams/{id}/ancestors", teamHandler.GetTeamAncestors, require(middleware.PermTeamsRead), "GET")
+	route("/teams/{id}/descendants", teamHandler.GetTeamDescendants, require(middleware.PermTeamsRead), "GET")
+	route("/teams/{id}", teamHandler.GetTeamById, require(middleware.PermTeamsRead), "GET")
+	route("/teams", teamHandler.CreateTeam, require(middleware.PermTeamsCreate), "POST")
+	route("/teams/{team_id}", teamHandler.PatchTeam, require(middleware.PermTeamsUpdate), "PATCH")
+	route("/teams/{team_id}", teamHandler.DeleteTeamById, require(middleware.PermTeamsDelete), "DELETE")
+	route("/teams/{id}/restore", teamHandler.RestoreTeam, require(middleware.PermTeamsDelete), "POST")
+	route("/teams/{team_id}/members", teamHandler.GetTeamMembers, require(middleware.PermTeamsRead), "GET")
+	route("/teams/{team_id}/members/{user_id}", teamHandler.AddTeamMember, require(middleware.PermTeamsUpdate), "POST")
+	route("/teams/{team_id}/members/{user_id}", teamHandler.RemoveTeamMember, require(middleware.PermTeamsUpdate), "DELETE")
+	route("/search", searchHandler.Search, require(middleware.PermUsersRead, middleware.PermTeamsRead), "GET")
+	route("/audit", auditHandler.GetAudit, require(middleware.PermAuditRead), "GET")
+
+	// Wrap the router with the request ID and CORS handlers
+	return c.Handler(middleware.RequestID(router))
+}
@@ -0,0 +1,186 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ErrInvalidToken คือ token ที่ลายเซ็นถูกต้องแต่ claim มาตรฐาน (exp, nbf, iat, iss, aud) ไม่ผ่าน
+var ErrInvalidToken = errors.New("invalid token claims")
+
+// Claims คือ claims ที่มี jwt.StandardClaims ฝังอยู่
+type Claims interface {
+	jwt.Claims
+	VerifyExpiresAt(cmp int64, req bool) bool
+	VerifyNotBefore(cmp int64, req bool) bool
+	VerifyIssuedAt(cmp int64, req bool) bool
+	VerifyIssuer(cmp string, req bool) bool
+	VerifyAudience(cmp string, req bool) bool
+}
+
+// Audience คือ aud ของ access token
+func (ks *KeySet) Audience() string {
+	return ks.cfg.Audience
+}
+
+// Registered คืน claim มาตรฐานของ token ใหม่ที่มีอายุ ttl สำหรับ audience
+func (ks *KeySet) Registered(audience string, ttl time.Duration) jwt.StandardClaims {
+	now := ks.Now()
+	return jwt.StandardClaims{
+		Issuer:    ks.cfg.Issuer,
+		Audience:  audience,
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+}
+
+// Sign เซ็น claims ด้วย key ที่ใช้เซ็นอยู่ และใส่ kid ใน header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	ks.mu.RLock()
+	k, ok := ks.active(ks.Now())
+	ks.mu.RUnlock()
+	if !ok {
+		return "", errors.New("no signing key")
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(k.alg), claims)
+	token.Header["kid"] = k.kid
+	return token.SignedString(k.private)
+}
+
+// Parse ตรวจลายเซ็นด้วย key ตาม kid และตรวจว่า exp ยังไม่ถึง nbf และ iat ผ่านมาแล้ว iss ตรงกับ config
+// และ aud มี audience อยู่ ผลลัพธ์ถูกเขียนลง claims
+func (ks *KeySet) Parse(raw, audience string, claims Claims) error {
+	// ตรวจ claim เองด้วย ks.Now แทน jwt.TimeFunc
+	parser := jwt.Parser{
+		ValidMethods:         []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()},
+		SkipClaimsValidation: true,
+	}
+	if _, err := parser.ParseWithClaims(raw, claims, ks.keyFunc); err != nil {
+		return err
+	}
+
+	now := ks.Now().Unix()
+	switch {
+	case !claims.VerifyExpiresAt(now, true):
+		return fmt.Errorf("%w: expired or missing exp", ErrInvalidToken)
+	case !claims.VerifyNotBefore(now, false):
+		return fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	case !claims.VerifyIssuedAt(now, false):
+		return fmt.Errorf("%w: issued in the future", ErrInvalidToken)
+	case !claims.VerifyIssuer(ks.cfg.Issuer, true):
+		return fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	case !claims.VerifyAudience(audience, true):
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	return nil
+}
+
+// keyFunc คืน public key ตาม kid โดย algorithm ใน header ต้องตรงกับชนิดของ key
+// (กันการใช้ public key เป็น secret ของ HS256)
+func (ks *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	k, ok := ks.lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if token.Method.Alg() != k.alg {
+		return nil, fmt.Errorf("key %q is not a %v key", kid, token.Header["alg"])
+	}
+	return k.private.Public(), nil
+}
+
+// lookup หา key ตาม kid ถ้าไม่พบและใช้ KeyDir จะอ่าน directory ใหม่ (ไม่บ่อยกว่า reloadInterval)
+// เผื่อ instance อื่นเพิ่งสร้าง key ใหม่
+func (ks *KeySet) lookup(kid string) (key, bool) {
+	find := func() (key, bool) {
+		for _, k := range ks.keys {
+			if k.kid == kid {
+				return k, true
+			}
+		}
+		return key{}, false
+	}
+
+	ks.mu.RLock()
+	k, ok := find()
+	stale := ks.cfg.KeyDir != "" && ks.Now().Sub(ks.loadedAt) >= reloadInterval
+	ks.mu.RUnlock()
+	if ok || !stale || kid == "" {
+		return k, ok
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if now := ks.Now(); now.Sub(ks.loadedAt) >= reloadInterval {
+		if err := ks.load(now); err != nil {
+			return key{}, false
+		}
+	}
+	return find()
+}
+
+// JWKS godoc
+// @Summary Public keys for verifying access tokens
+// @Description JSON Web Key Set (RFC 7517) of every key that may have signed a token that has not expired yet.
+// @Tags auth
+// @Produce  json
+// @Success 200 {object} map[string]interface{}
+// @Router /.well-known/jwks.json [get]
+func (ks *KeySet) JWKS(w http.ResponseWriter, r *http.Request) {
+	ks.mu.RLock()
+	keys := make([]map[string]string, 0, len(ks.keys))
+	for _, k := range ks.keys {
+		jwk, err := publicJWK(k.private.Public())
+		if err != nil {
+			continue
+		}
+		jwk["kid"], jwk["alg"], jwk["use"] = k.kid, k.alg, "sig"
+		keys = append(keys, jwk)
+	}
+	ks.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	// key ใหม่ถูกเผยแพร่ล่วงหน้า publishAhead ก่อนใช้เซ็น จึง cache ได้สั้นกว่านั้น
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+}
+
+// publicJWK คืนเฉพาะ member ที่จำเป็นของ public key ในรูปแบบ JWK
+func publicJWK(public crypto.PublicKey) (map[string]string, error) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "n": b64(pub.N.Bytes()), "e": b64(big.NewInt(int64(pub.E)).Bytes())}, nil
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "crv": "Ed25519", "x": b64(pub)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", public)
+}
+
+// thumbprint คือ JWK thumbprint (RFC 7638): SHA-256 ของ member ที่จำเป็นเรียงตามชื่อ
+func thumbprint(public crypto.PublicKey) (string, error) {
+	jwk, err := publicJWK(public)
+	if err != nil {
+		return "", err
+	}
+	// json.Marshal เรียง key ของ map ตามตัวอักษรและไม่มีช่องว่าง ตรงตามที่ RFC กำหนด
+	data, err := json.Marshal(jwk)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,270 @@
+// Package signing เก็บ private key สำหรับเซ็น JWT และหมุนเวียน key ตามรอบ
+// key แต่ละตัวระบุด้วย kid (JWK thumbprint ตาม RFC 7638) ซึ่งใส่ไว้ใน header ของ token
+// public key ของทุก key ที่ยังใช้ตรวจได้ถูกเผยแพร่ที่ /.well-known/jwks.json ให้บริการอื่นตรวจ token ได้โดยไม่ต้องรู้ secret
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"golang-backend/config"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ลำดับเวลาของ key หนึ่งตัว:
+//   - createdAt: ถูกสร้างและเผยแพร่ใน JWKS แต่ยังไม่ใช้เซ็น (บริการอื่นอาจ cache JWKS เก่าไว้)
+//   - createdAt + publishAhead: เริ่มใช้เซ็น
+//   - เมื่อ key ถัดไปเริ่มใช้เซ็น: หยุดเซ็น แต่ยังตรวจได้จนกว่า token ที่เซ็นไว้จะหมดอายุ
+const (
+	publishAhead = 10 * time.Minute
+	// verifyGrace เผื่อเวลาคลาดเคลื่อนระหว่างเครื่องและ token อายุสั้นอื่นๆ เช่น challenge token ของ 2FA
+	verifyGrace = 5 * time.Minute
+	// reloadInterval คือระยะห่างขั้นต่ำของการอ่าน KeyDir ใหม่เมื่อพบ kid ที่ไม่รู้จัก
+	reloadInterval = 5 * time.Second
+	rsaBits        = 2048
+)
+
+type key struct {
+	kid       string
+	alg       string
+	private   crypto.Signer
+	createdAt time.Time
+}
+
+// KeySet คือชุด key สำหรับเซ็นและตรวจ JWT ถ้ากำหนด KeyDir จะอ่านและบันทึก key ใน directory นั้น
+// เพื่อให้ทุก instance ใช้ key ชุดเดียวกัน
+type KeySet struct {
+	cfg config.JWTConfig
+
+	mu       sync.RWMutex
+	keys     []key // เรียงจากเก่าไปใหม่
+	loadedAt time.Time
+
+	// Now คือเวลาปัจจุบัน เปลี่ยนได้ในการทดสอบ
+	Now func() time.Time
+}
+
+func NewKeySet(cfg config.JWTConfig) (*KeySet, error) {
+	if cfg.KeyDir != "" {
+		if err := os.MkdirAll(cfg.KeyDir, 0o700); err != nil {
+			return nil, fmt.Errorf("create key dir: %w", err)
+		}
+	}
+	ks := &KeySet{cfg: cfg, Now: time.Now}
+	return ks, ks.Rotate()
+}
+
+// Run หมุนเวียน key และอ่าน key ที่ instance อื่นสร้างทุกนาทีจนกว่า ctx จะถูกยกเลิก
+func (ks *KeySet) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ks.Rotate(); err != nil {
+				log.Println("rotate signing keys:", err)
+			}
+		}
+	}
+}
+
+// Rotate สร้าง key ใหม่ล่วงหน้า publishAhead ก่อนที่ key ปัจจุบันจะมีอายุครบ RotateEvery
+// และลบ key ที่ไม่มี token ที่ยังไม่หมดอายุเหลืออยู่แล้ว
+func (ks *KeySet) Rotate() error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	now := ks.Now()
+	if err := ks.load(now); err != nil {
+		return err
+	}
+	newest, ok := ks.newest()
+	if !ok || !now.Before(newest.createdAt.Add(time.Duration(ks.cfg.RotateEvery)-publishAhead)) {
+		k, err := generate(ks.cfg.Algorithm, now)
+		if err != nil {
+			return err
+		}
+		if err := ks.save(k); err != nil {
+			return err
+		}
+		ks.keys = append(ks.keys, k)
+	}
+	return ks.retire(now)
+}
+
+// newest คืน key ล่าสุดของ algorithm ที่ตั้งค่าไว้
+func (ks *KeySet) newest() (key, bool) {
+	for i := len(ks.keys) - 1; i >= 0; i-- {
+		if ks.keys[i].alg == ks.cfg.Algorithm {
+			return ks.keys[i], true
+		}
+	}
+	return key{}, false
+}
+
+// active คืน key ที่ใช้เซ็น: key ล่าสุดที่เผยแพร่มานานพอแล้ว หรือ key ล่าสุดถ้ายังไม่มี key ใดเผยแพร่นานพอ (ตอนเริ่มครั้งแรก)
+func (ks *KeySet) active(now time.Time) (key, bool) {
+	for i := len(ks.keys) - 1; i >= 0; i-- {
+		if k := ks.keys[i]; k.alg == ks.cfg.Algorithm && !k.createdAt.Add(publishAhead).After(now) {
+			return k, true
+		}
+	}
+	return ks.newest()
+}
+
+// retire ลบ key ที่หยุดเซ็นมานานกว่าอายุของ access token
+func (ks *KeySet) retire(now time.Time) error {
+	kept := ks.keys[:0]
+	for i, k := range ks.keys {
+		if i < len(ks.keys)-1 {
+			stoppedAt := ks.keys[i+1].createdAt.Add(publishAhead)
+			if now.After(stoppedAt.Add(time.Duration(ks.cfg.TTL) + verifyGrace)) {
+				if err := ks.remove(k); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		kept = append(kept, k)
+	}
+	ks.keys = kept
+	return nil
+}
+
+func generate(alg string, now time.Time) (key, error) {
+	var private crypto.Signer
+	var err error
+	switch alg {
+	case config.JWTRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaBits)
+	case config.JWTEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return key{}, err
+	}
+	kid, err := thumbprint(private.Public())
+	if err != nil {
+		return key{}, err
+	}
+	return key{kid: kid, alg: alg, private: private, createdAt: now}, nil
+}
+
+// algorithmOf คืน JWT algorithm ของ private key
+func algorithmOf(private crypto.Signer) (string, error) {
+	switch private.(type) {
+	case *rsa.PrivateKey:
+		return config.JWTRS256, nil
+	case ed25519.PrivateKey:
+		return config.JWTEdDSA, nil
+	}
+	return "", fmt.Errorf("unsupported key type %T", private)
+}
+
+// load อ่าน key ทั้งหมดจาก KeyDir แทนที่ key ในหน่วยความจำ เวลาสร้างของ key คือเวลาแก้ไขไฟล์
+func (ks *KeySet) load(now time.Time) error {
+	if ks.cfg.KeyDir == "" {
+		return nil
+	}
+	paths, err := filepath.Glob(filepath.Join(ks.cfg.KeyDir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	keys := make([]key, 0, len(paths))
+	for _, path := range paths {
+		k, err := readKey(path)
+		if errors.Is(err, os.ErrNotExist) {
+			// instance อื่นเพิ่งลบไป
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].createdAt.Equal(keys[j].createdAt) {
+			return keys[i].createdAt.Before(keys[j].createdAt)
+		}
+		return keys[i].kid < keys[j].kid
+	})
+	ks.keys = keys
+	ks.loadedAt = now
+	return nil
+}
+
+func readKey(path string) (key, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return key{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return key{}, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return key{}, fmt.Errorf("%s: not a PKCS #8 PEM private key", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return key{}, fmt.Errorf("%s: %w", path, err)
+	}
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return key{}, fmt.Errorf("%s: unsupported key type %T", path, parsed)
+	}
+	alg, err := algorithmOf(private)
+	if err != nil {
+		return key{}, fmt.Errorf("%s: %w", path, err)
+	}
+	kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+	return key{kid: kid, alg: alg, private: private, createdAt: info.ModTime()}, nil
+}
+
+// save เขียน key ลง KeyDir ผ่านไฟล์ชั่วคราวเพื่อไม่ให้ instance อื่นอ่านไฟล์ที่เขียนไม่เสร็จ
+func (ks *KeySet) save(k key) error {
+	if ks.cfg.KeyDir == "" {
+		return nil
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(k.private)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(ks.cfg.KeyDir, k.kid+".pem")
+	tmp := filepath.Join(ks.cfg.KeyDir, "."+k.kid+".tmp")
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp, k.createdAt, k.createdAt); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (ks *KeySet) remove(k key) error {
+	if ks.cfg.KeyDir == "" {
+		return nil
+	}
+	err := os.Remove(filepath.Join(ks.cfg.KeyDir, k.kid+".pem"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}